@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"golang.org/x/image/draw"
+	"image"
+	"math"
+	"math/rand/v2"
+	"os"
+	"randomart/nodes"
+	"randomart/render"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// approximateSize is the length of the longest side of the thumbnails that
+// candidates are compared to the source image at.
+const approximateSize = 64
+
+type candidate struct {
+	root       nodes.Node
+	scored     bool
+	difference float64
+}
+
+// fit returns the size of an image scaled so that its longest side is size.
+func fit(width, height, size int) (int, int) {
+	if width > height {
+		return size, max(height*size/width, 1)
+	}
+	return max(width*size/height, 1), size
+}
+
+func thumbnail(img image.Image, width, height int) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return dst
+}
+
+// difference returns the mean squared difference between the colours of two
+// images of the same size, from 0 for identical images to 1.
+func difference(a, b *image.NRGBA) float64 {
+	var sum float64
+	for i := 0; i < len(a.Pix); i += 4 {
+		for c := range 3 {
+			d := float64(a.Pix[i+c]) - float64(b.Pix[i+c])
+			sum += d * d
+		}
+	}
+	return sum / float64(len(a.Pix)/4*3) / (255 * 255)
+}
+
+// score renders a thumbnail of each candidate that hasn't been scored yet and
+// compares it to the target. Candidates that fail to render are as different
+// as can be.
+func score(ctx context.Context, candidates []*candidate, target *image.NRGBA) {
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, runtime.NumCPU())
+		b   = target.Bounds()
+	)
+	for _, c := range candidates {
+		if c.scored {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			c.difference = math.Inf(1)
+			img, err := render.Render(ctx, c.root, render.WithResolution(b.Dx(), b.Dy()))
+			if err != nil {
+				c.scored = ctx.Err() == nil
+				return
+			}
+			c.difference, c.scored = difference(target, thumbnail(img, b.Dx(), b.Dy())), true
+		}()
+	}
+	wg.Wait()
+}
+
+// runApproximate evolves a population of expressions towards the source image
+// by crossing over and mutating the expressions that look most like it, then
+// renders the closest one. Interrupting the search renders the closest
+// expression found so far.
+func runApproximate(ctx context.Context) error {
+	if *srcFilename == "" {
+		return fmt.Errorf("a src image to approximate must be given")
+	}
+	if *population < 2 {
+		return fmt.Errorf("population must be at least 2")
+	}
+	grammar, err := loadGrammar(*grammarFilename)
+	if err != nil {
+		return err
+	}
+	src, err := os.ReadFile(*srcFilename)
+	if err != nil {
+		return fmt.Errorf("could not read src file %q: %w", *srcFilename, err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(src))
+	if err != nil {
+		return fmt.Errorf("could not decode src file %q: %w", *srcFilename, err)
+	}
+	b := img.Bounds()
+	w, h := fit(b.Dx(), b.Dy(), approximateSize)
+	target := thumbnail(img, w, h)
+
+	var genOpts []nodes.GeneratorOption
+	if *optionsInputFilename != "" {
+		data, err := os.ReadFile(*optionsInputFilename)
+		if err != nil {
+			return fmt.Errorf("could not read input options file %q: %w", *optionsInputFilename, err)
+		}
+		genOpts = append(genOpts, nodes.FromJSON(bytes.NewReader(data)))
+	}
+	root, state, err := grammar.Gen(genOpts...)
+	if err != nil {
+		return fmt.Errorf("could not generate random AST: %w", err)
+	}
+	candidates := []*candidate{{root: root}}
+	for len(candidates) < *population {
+		if root, err = state.Gen(); err != nil {
+			return fmt.Errorf("could not generate random AST: %w", err)
+		}
+		candidates = append(candidates, &candidate{root: root})
+	}
+
+	rng := rand.New(rand.NewPCG(state.Seed, state.Seed+2))
+	for generation := 1; ; generation++ {
+		score(ctx, candidates, target)
+		slices.SortStableFunc(candidates, func(a, b *candidate) int {
+			return cmp.Compare(a.difference, b.difference)
+		})
+		fmt.Printf("generation %d: difference %.5f\n", generation, candidates[0].difference)
+		if generation == *generations || ctx.Err() != nil {
+			break
+		}
+
+		// The closest quarter survive and are the parents of the rest.
+		parents := candidates[:max(len(candidates)/4, 1)]
+		next := slices.Clone(parents)
+		for len(next) < len(candidates) {
+			a, b := parents[rng.IntN(len(parents))], parents[rng.IntN(len(parents))]
+			child, err := state.Crossover(a.root, b.root)
+			if err != nil {
+				child = a.root
+			}
+			if rng.Float64() < 0.5 {
+				if mutated, err := state.Mutate(child); err == nil {
+					child = mutated
+				}
+			}
+			next = append(next, &candidate{root: child})
+		}
+		candidates = next
+	}
+
+	best := candidates[0].root
+	fmt.Println(best)
+	w, h = b.Dx(), b.Dy()
+	if flagSet("width") || flagSet("height") {
+		w, h = *width, *height
+	}
+	// Render the closest expression even if the search was interrupted.
+	out, err := render.Render(context.WithoutCancel(ctx), best, render.WithResolution(w, h))
+	if err != nil {
+		return fmt.Errorf("could not render image: %w", err)
+	}
+	format, err := render.FormatFromFilename(*outputFilename)
+	if *outputFormat != "" {
+		format, err = render.ParseFormat(*outputFormat)
+	}
+	if err != nil {
+		return fmt.Errorf("could not determine output format: %w", err)
+	}
+	return writeImage(*outputFilename, out, format, render.WithQuality(*quality))
+}
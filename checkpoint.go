@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"randomart/nodes"
+	"slices"
+)
+
+// checkpoint records the frames of a render that have been written, along
+// with the expression and options that they were rendered with, so that the
+// render can be resumed with -checkpoint.
+type checkpoint struct {
+	Expression string          `json:"expression"`
+	Options    json.RawMessage `json:"options"`
+	Frames     []int           `json:"frames"`
+}
+
+func newCheckpoint(node nodes.Node, options string) *checkpoint {
+	return &checkpoint{Expression: node.String(), Options: json.RawMessage(options)}
+}
+
+// readCheckpoint reads the checkpoint written to filename. A nil checkpoint is
+// returned if it doesn't exist yet.
+func readCheckpoint(filename string) (*checkpoint, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read checkpoint file %q: %w", filename, err)
+	}
+	c := &checkpoint{}
+	if err = json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("cannot decode checkpoint from JSON: %w", err)
+	}
+	return c, nil
+}
+
+// next returns the first frame from the given frame that hasn't been written.
+func (c *checkpoint) next(frame int) int {
+	for slices.Contains(c.Frames, frame) {
+		frame++
+	}
+	return frame
+}
+
+// write records that the frame has been written. The checkpoint is written to
+// a temporary file first so that it isn't lost if the render is interrupted
+// while writing it.
+func (c *checkpoint) write(filename string, frame int) error {
+	if !slices.Contains(c.Frames, frame) {
+		c.Frames = append(c.Frames, frame)
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(filename+".tmp", data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(filename+".tmp", filename)
+}
@@ -0,0 +1,71 @@
+//go:build js && wasm
+
+// Command wasm exposes randomart to JavaScript. Build it with
+//
+//	GOOS=js GOARCH=wasm go build -o randomart.wasm ./cmd/wasm
+//
+// and load it alongside the wasm_exec.js shipped with Go, see index.html.
+package main
+
+import (
+	"context"
+	"image"
+	"randomart/nodes"
+	"randomart/render"
+	"strings"
+	"syscall/js"
+)
+
+var root nodes.Node
+
+func jsError(err error) js.Value {
+	return js.Global().Get("Error").New(err.Error())
+}
+
+// generate parses the given grammar and generates an expression from it with
+// the given seed, which is what render renders. It returns the expression as a
+// string.
+func generate(this js.Value, args []js.Value) any {
+	if len(args) != 2 {
+		return js.Global().Get("Error").New("usage: generate(grammar, seed)")
+	}
+	grammar, err := nodes.Parse(strings.NewReader(args[0].String()), "grammar")
+	if err != nil {
+		return jsError(err)
+	}
+	node, _, err := grammar.Gen(nodes.WithSeeds(uint64(args[1].Float())))
+	if err != nil {
+		return jsError(err)
+	}
+	root = node
+	return node.String()
+}
+
+// render renders the last generated expression and returns it as an ImageData
+// that can be drawn to a canvas with putImageData.
+func renderImage(this js.Value, args []js.Value) any {
+	if len(args) != 2 {
+		return js.Global().Get("Error").New("usage: render(width, height)")
+	}
+	if root == nil {
+		return js.Global().Get("Error").New("no expression has been generated yet")
+	}
+	width, height := args[0].Int(), args[1].Int()
+	img, err := render.Render(context.Background(), root, render.WithResolution(width, height))
+	if err != nil {
+		return jsError(err)
+	}
+
+	pix := img.(*image.NRGBA).Pix
+	data := js.Global().Get("Uint8ClampedArray").New(len(pix))
+	js.CopyBytesToJS(data, pix)
+	return js.Global().Get("ImageData").New(data, width, height)
+}
+
+func main() {
+	randomart := js.Global().Get("Object").New()
+	randomart.Set("generate", js.FuncOf(generate))
+	randomart.Set("render", js.FuncOf(renderImage))
+	js.Global().Set("randomart", randomart)
+	select {}
+}
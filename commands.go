@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"randomart/nodes"
+	"slices"
+	"strings"
+)
+
+// command is a subcommand of randomart, which only accepts the flags that it
+// uses.
+type command struct {
+	name    string
+	aliases []string
+	// args describes the positional arguments in the command's usage.
+	args        string
+	description string
+	flags       [][]string
+	run         func(ctx context.Context, args []string) error
+}
+
+// Groups of flags shared between commands.
+var (
+	grammarFlags  = []string{"grammar", "grammar-cache"}
+	generateFlags = []string{"seed-string", "candidates", "min-entropy", "min-depth", "max-nodes", "channel-rules", "production-streams", "require-components", "ioptions", "require-compatible", "ooptions"}
+	renderFlags   = []string{
+		"width", "height", "frames", "start-frame", "end-frame", "interpolate", "samples", "motion-blur", "shutter", "jitter", "param", "fast-math", "budget", "target-duration", "pixel-timeout", "error-color",
+		"src", "src-video", "mask", "tileable", "dithering", "mode", "heightmap", "lut", "palette", "palette-dither",
+		"cost-heatmap", "branch-overlay", "workers", "flush-on-cancel", "log-json", "verbose",
+	}
+	outputFlags = []string{"output", "thumb", "format", "grid", "fps", "quality", "preview", "preview-protocol", "stream", "manifest", "checkpoint"}
+	exportFlags = []string{"js", "ast-dot", "oast"}
+	liveFlags   = []string{"osc", "midi", "midi-cc"}
+	// profileFlags are accepted by every command.
+	profileFlags = []string{"cpuprofile", "memprofile", "trace"}
+)
+
+var commands = []*command{
+	{
+		name:        "render",
+		description: "Generate an expression from the grammar, or read one with -expression, and render it. This is the default command.",
+		flags:       [][]string{grammarFlags, {"expression"}, generateFlags, renderFlags, outputFlags, exportFlags},
+		run:         noArgs(runRender),
+	},
+	{
+		name:        "generate",
+		description: "Generate an expression from the grammar and print it along with the options that reproduce it, without rendering it.",
+		flags:       [][]string{grammarFlags, generateFlags},
+		run:         noArgs(runGenerate),
+	},
+	{
+		name:        "validate",
+		description: "Check that the grammar, and the expression if given, parse.",
+		flags:       [][]string{grammarFlags, {"expression"}},
+		run:         noArgs(runValidate),
+	},
+	{
+		name:        "reproduce",
+		args:        "options.json",
+		description: "Render the art that an options file written with -ooptions was written for again.",
+		flags:       [][]string{grammarFlags, {"require-compatible"}, renderFlags, outputFlags, exportFlags},
+		run:         runReproduce,
+	},
+	{
+		name:        "export",
+		description: "Write the expression, generated or read with -expression, as JavaScript or a Graphviz graph without rendering it.",
+		flags:       [][]string{grammarFlags, {"expression"}, generateFlags, exportFlags},
+		run:         noArgs(runExport),
+	},
+	{
+		name:        "explain",
+		description: "Print the expression, read with -iast or -expression or generated, as a tree annotated with the type, range of values and cost of each node, sampled over the image and its frames.",
+		flags:       [][]string{grammarFlags, {"iast", "expression"}, generateFlags},
+		run:         noArgs(runExplain),
+	},
+	{
+		name:        "diff",
+		args:        "a.json b.json",
+		description: "Report the differences between the options and expressions of two generations, saved with -ooptions or -oast, generating the expressions of options files from the grammar.",
+		flags:       [][]string{grammarFlags, {"diff-heatmap", "width", "height", "param"}},
+		run:         runDiff,
+	},
+	{
+		name:        "gallery",
+		description: "Render expressions generated from consecutive seeds to a directory with an index.html of their thumbnails, seeds and expressions for curating them.",
+		flags:       [][]string{grammarFlags, generateFlags, {"count", "dir", "thumb", "width", "height", "samples", "jitter", "param", "fast-math"}},
+		run:         noArgs(runGallery),
+	},
+	{
+		name:        "sweep",
+		description: "Render the expressions generated from the same seed while sweeping the weight of an alternative of -rule from -from to -to, tiled into a grid, to see how the weight affects them.",
+		flags:       [][]string{grammarFlags, generateFlags, {"rule", "alternative", "from", "to", "steps", "watch", "width", "height", "samples", "jitter", "param", "fast-math", "output", "format", "grid", "quality"}},
+		run:         noArgs(runSweep),
+	},
+	{
+		name:        "fuzz",
+		description: "Parse, generate from and render -count random grammars, reporting any that panic.",
+		flags:       [][]string{{"count", "seed-string"}},
+		run:         noArgs(runFuzz),
+	},
+	{
+		name:        "evolve",
+		aliases:     []string{"approximate"},
+		description: "Evolve expressions towards the src image and render the closest.",
+		flags:       [][]string{grammarFlags, {"src", "ioptions", "population", "generations", "width", "height", "output", "format", "quality"}},
+		run:         noArgs(runApproximate),
+	},
+	{
+		name:        "serve",
+		aliases:     []string{"grpc-serve"},
+		description: "Serve the Randomart gRPC service, generating from the grammar for requests that don't give their own.",
+		flags:       [][]string{grammarFlags, {"listen", "pixel-timeout", "metrics", "pprof"}, liveFlags},
+		run:         noArgs(runGRPCServer),
+	},
+	{
+		name:        "worker",
+		description: "Render bands of frames for the workers given to -workers. Workers aren't authenticated, so must only listen on trusted networks.",
+		flags:       [][]string{{"listen", "metrics", "pprof"}},
+		run:         noArgs(runWorker),
+	},
+	{
+		name:        "repl",
+		description: "Generate, mutate and render expressions interactively.",
+		flags:       [][]string{grammarFlags, {"width", "height", "samples", "jitter", "quality"}},
+		run: noArgs(func(ctx context.Context) error {
+			return runREPL(ctx, os.Stdin, os.Stdout)
+		}),
+	},
+	{
+		name:        "preview",
+		description: "Render expressions live in a window, requires building with -tags preview.",
+		flags:       [][]string{grammarFlags, {"width", "height", "samples", "jitter", "output", "quality"}, liveFlags},
+		run:         noArgs(runPreview),
+	},
+	{
+		name:        "graph",
+		description: "Draw the rule references of the grammar as an SVG, to stdout unless -output is given.",
+		flags:       [][]string{grammarFlags, {"output"}},
+		run: noArgs(func(context.Context) error {
+			return runGraph()
+		}),
+	},
+}
+
+// commandFlags are the flags of the command being run.
+var commandFlags *flag.FlagSet
+
+func noArgs(run func(ctx context.Context) error) func(ctx context.Context, args []string) error {
+	return func(ctx context.Context, args []string) error {
+		if len(args) > 0 {
+			return fmt.Errorf("unexpected arguments %q", args)
+		}
+		return run(ctx)
+	}
+}
+
+func lookupCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name || slices.Contains(cmd.aliases, name) {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// flagSet returns a flag set of the command's flags, which share their values
+// with those defined on the command line.
+func (cmd *command) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("randomart "+cmd.name, flag.ExitOnError)
+	for _, group := range append(cmd.flags, profileFlags) {
+		for _, name := range group {
+			f := flag.Lookup(name)
+			fs.Var(f.Value, f.Name, f.Usage)
+		}
+	}
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage: %s\n\n%s\n\nFlags:\n", strings.TrimSpace("randomart "+cmd.name+" [flags] "+cmd.args), cmd.description)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// helpCommand prints the usage of the command given to it, or lists the
+// commands. It is added to the commands by init as it looks them up.
+var helpCommand = &command{
+	name:        "help",
+	args:        "[command]",
+	description: "List the commands, or print the flags of the given command.",
+	run: func(ctx context.Context, args []string) error {
+		if len(args) == 0 {
+			usage()
+			return nil
+		}
+		cmd := lookupCommand(args[0])
+		if cmd == nil {
+			return fmt.Errorf("unknown command %q", args[0])
+		}
+		fs := cmd.flagSet()
+		fs.SetOutput(os.Stdout)
+		fs.Usage()
+		return nil
+	},
+}
+
+func init() {
+	commands = append(commands, helpCommand)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: randomart [command] [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		name := cmd.name
+		if len(cmd.aliases) > 0 {
+			name += " (" + strings.Join(cmd.aliases, ", ") + ")"
+		}
+		fmt.Fprintf(os.Stderr, "  %s\n    \t%s\n", name, cmd.description)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun randomart help [command] for the flags of a command.\n")
+}
+
+// runGenerate prints an expression generated from the grammar and its
+// generator options, which are also written to -ooptions if given.
+func runGenerate(ctx context.Context) error {
+	optionsFile, err := readOptionsFile()
+	if err != nil {
+		return err
+	}
+	genOpts, err := generatorOptions(optionsFile)
+	if err != nil {
+		return err
+	}
+	grammar, err := loadGrammar(*grammarFilename)
+	if err != nil {
+		return err
+	}
+	node, state, err := generate(ctx, grammar, genOpts)
+	if err != nil {
+		return err
+	}
+	fmt.Println(node)
+	fmt.Println(state.Options())
+	if *optionsOutputFilename != "" {
+		if err = os.WriteFile(*optionsOutputFilename, []byte(state.Options()), 0o644); err != nil {
+			return fmt.Errorf("could not write generator options to %q: %w", *optionsOutputFilename, err)
+		}
+	}
+	return nil
+}
+
+func runValidate(ctx context.Context) error {
+	if _, err := loadGrammar(*grammarFilename); err != nil {
+		return err
+	}
+	fmt.Printf("%s is valid\n", *grammarFilename)
+	if *expressionFilename != "" {
+		if _, err := loadExpression(*expressionFilename); err != nil {
+			return err
+		}
+		fmt.Printf("%s is valid\n", *expressionFilename)
+	}
+	return nil
+}
+
+// runReproduce renders with the options file given to it as if it were given
+// with -ioptions.
+func runReproduce(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("the options file to reproduce must be given")
+	}
+	*optionsInputFilename = args[0]
+	return runRender(ctx)
+}
+
+func runExplain(ctx context.Context) error {
+	var (
+		node nodes.Node
+		err  error
+	)
+	if *astInputFilename != "" {
+		node, err = loadAST(*astInputFilename)
+	} else {
+		node, err = loadOrGenerate(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Print(nodes.Explain(node))
+	return nil
+}
+
+func runExport(ctx context.Context) error {
+	if *jsFilename == "" && *astDotFilename == "" && *astOutputFilename == "" {
+		return fmt.Errorf("-js, -ast-dot or -oast must be given to export the expression to")
+	}
+	node, err := loadOrGenerate(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Println(node)
+	return exportExpression(node)
+}
+
+// loadOrGenerate loads the expression given with -expression or generates one
+// from the grammar.
+func loadOrGenerate(ctx context.Context) (nodes.Node, error) {
+	if *expressionFilename != "" {
+		return loadExpression(*expressionFilename)
+	}
+	optionsFile, err := readOptionsFile()
+	if err != nil {
+		return nil, err
+	}
+	genOpts, err := generatorOptions(optionsFile)
+	if err != nil {
+		return nil, err
+	}
+	grammar, err := loadGrammar(*grammarFilename)
+	if err != nil {
+		return nil, err
+	}
+	node, _, err := generate(ctx, grammar, genOpts)
+	return node, err
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// configFilenames are the names of the config files looked for in the current
+// directory and then in the randomart directory of the user's config
+// directory ($XDG_CONFIG_HOME), with the first found in each being read.
+var configFilenames = []string{"randomart.toml", "randomart.yaml", "randomart.yml"}
+
+// configured are the flags that were set by config files rather than on the
+// command line.
+var configured = make(map[string]bool)
+
+// loadConfig sets the flags that weren't given on the command line to the
+// values in the config files, keyed by the flags' names. The current
+// directory's config takes precedence over the user's. Lists are joined with
+// commas and tables, such as of params, set the flag once for each of their
+// name=value pairs.
+func loadConfig() error {
+	dirs := []string{"."}
+	if dir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(dir, "randomart"))
+	}
+	for _, dir := range dirs {
+		for _, name := range configFilenames {
+			filename := filepath.Join(dir, name)
+			data, err := os.ReadFile(filename)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("could not read config file %q: %w", filename, err)
+			}
+			if err = applyConfig(filename, data); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	return nil
+}
+
+func applyConfig(filename string, data []byte) error {
+	config := make(map[string]any)
+	var err error
+	if strings.HasSuffix(filename, ".toml") {
+		err = toml.Unmarshal(data, &config)
+	} else {
+		err = yaml.Unmarshal(data, &config)
+	}
+	if err != nil {
+		return fmt.Errorf("could not parse config file %q: %w", filename, err)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(config)) {
+		if flag.Lookup(name) == nil {
+			return fmt.Errorf("config file %q sets %q, which is not a flag", filename, name)
+		}
+		// Config files are shared by every command, which ignore the flags
+		// that they don't have.
+		if commandFlags.Lookup(name) == nil || configured[name] || flagSet(name) {
+			continue
+		}
+		var values []string
+		switch v := config[name].(type) {
+		case []any:
+			s := make([]string, len(v))
+			for i, e := range v {
+				s[i] = fmt.Sprint(e)
+			}
+			values = []string{strings.Join(s, ",")}
+		case map[string]any:
+			for _, k := range slices.Sorted(maps.Keys(v)) {
+				values = append(values, fmt.Sprintf("%s=%v", k, v[k]))
+			}
+		default:
+			values = []string{fmt.Sprint(v)}
+		}
+		for _, v := range values {
+			if err := commandFlags.Set(name, v); err != nil {
+				return fmt.Errorf("config file %q: invalid value %q for %s: %w", filename, v, name, err)
+			}
+		}
+		configured[name] = true
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"maps"
+	"os"
+	"randomart/nodes"
+	"randomart/render"
+	"slices"
+	"strings"
+)
+
+// maxDiffs is the most differences between expressions that are listed.
+const maxDiffs = 10
+
+// generation is what was saved of a generation, either an options file
+// written with -ooptions or an AST written with -oast.
+type generation struct {
+	filename string
+	options  map[string]any
+	node     nodes.Node
+}
+
+func readGeneration(ctx context.Context, filename string) (*generation, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %q: %w", filename, err)
+	}
+	g := &generation{filename: filename}
+	if err = json.Unmarshal(data, &g.options); err != nil {
+		return nil, fmt.Errorf("cannot decode %q from JSON: %w", filename, err)
+	}
+	if _, ok := g.options["type"]; ok {
+		g.options = nil
+		if g.node, err = nodes.UnmarshalNode(data); err != nil {
+			return nil, fmt.Errorf("could not decode AST in %q: %w", filename, err)
+		}
+		return g, nil
+	}
+
+	grammar, err := loadGrammar(*grammarFilename)
+	if err != nil {
+		return nil, err
+	}
+	if g.node, _, err = grammar.GenContext(ctx, nodes.FromJSON(bytes.NewReader(data))); err != nil {
+		return nil, fmt.Errorf("could not generate the expression of %q: %w", filename, err)
+	}
+	return g, nil
+}
+
+// runDiff reports the differences between the options and expressions of two
+// generations, and writes a heatmap of how different their images are to
+// -heatmap if given.
+func runDiff(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("the two options or AST files to compare must be given")
+	}
+	a, err := readGeneration(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	b, err := readGeneration(ctx, args[1])
+	if err != nil {
+		return err
+	}
+
+	if a.options != nil && b.options != nil {
+		var diffs []string
+		diffOptions("", a.options, b.options, &diffs)
+		if len(diffs) == 0 {
+			fmt.Println("options are identical")
+		} else {
+			fmt.Println("options:")
+			for _, d := range diffs {
+				fmt.Println("  " + d)
+			}
+		}
+	}
+
+	var diffs []string
+	diffNodes("root", a.node, b.node, &diffs)
+	if len(diffs) == 0 {
+		fmt.Println("expressions are identical")
+	} else {
+		fmt.Println("expressions:")
+		for i, d := range diffs {
+			if i == maxDiffs {
+				fmt.Printf("  and %d more\n", len(diffs)-maxDiffs)
+				break
+			}
+			fmt.Println("  " + d)
+		}
+	}
+
+	if *diffHeatmapFilename == "" {
+		return nil
+	}
+	imgs := make([]image.Image, 2)
+	for i, g := range []*generation{a, b} {
+		opts := append([]render.RenderOption{render.WithResolution(*width, *height)}, paramOptions()...)
+		if imgs[i], err = render.Render(ctx, g.node, opts...); err != nil {
+			return fmt.Errorf("could not render %q: %w", g.filename, err)
+		}
+	}
+	heatmap, most, differing := differenceHeatmap(imgs[0], imgs[1])
+	fmt.Printf("%d of %d pixels differ, by up to %d\n", differing, *width**height, most)
+	return writeImage(*diffHeatmapFilename, heatmap, render.PNG)
+}
+
+// diffOptions lists the differences between two decoded JSON values, with the
+// path of object keys to each.
+func diffOptions(path string, a, b any, diffs *[]string) {
+	am, aok := a.(map[string]any)
+	bm, bok := b.(map[string]any)
+	if !aok || !bok {
+		if fmt.Sprint(a) != fmt.Sprint(b) {
+			*diffs = append(*diffs, fmt.Sprintf("%s: %s != %s", path, optionString(a), optionString(b)))
+		}
+		return
+	}
+	keys := slices.Collect(maps.Keys(am))
+	for k := range bm {
+		if _, ok := am[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		p := k
+		if path != "" {
+			p = path + "." + k
+		}
+		diffOptions(p, am[k], bm[k], diffs)
+	}
+}
+
+func optionString(v any) string {
+	if v == nil {
+		return "unset"
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// diffNodes lists the outermost nodes that differ between two expressions,
+// with the path of child indices to each.
+func diffNodes(path string, a, b nodes.Node, diffs *[]string) {
+	ac, bc := nodes.Children(a), nodes.Children(b)
+	if len(ac) == 0 || len(ac) != len(bc) || shallow(a) != shallow(b) {
+		if a.String() != b.String() {
+			*diffs = append(*diffs, fmt.Sprintf("at %s: %s\n%*s vs %s", path, a, len(path)+4, "", b))
+		}
+		return
+	}
+	for i := range ac {
+		diffNodes(fmt.Sprintf("%s.%d", path, i), ac[i], bc[i], diffs)
+	}
+}
+
+// shallow returns the string of a node with its children replaced, so that
+// nodes can be compared without them.
+func shallow(n nodes.Node) string {
+	placeholders := make([]nodes.Node, len(nodes.Children(n)))
+	for i := range placeholders {
+		placeholders[i] = nodes.Val(0.0)
+	}
+	replaced, err := nodes.WithChildren(n, placeholders)
+	if err != nil {
+		return n.String()
+	}
+	return strings.TrimSpace(replaced.String())
+}
+
+// differenceHeatmap returns a greyscale image where the brightness of each
+// pixel is how different the colours of the two images are there, relative to
+// the most different pixel, along with that difference out of 255 and how
+// many pixels differ.
+func differenceHeatmap(a, b image.Image) (*image.Gray, int, int) {
+	bounds := a.Bounds()
+	diffs := make([]int, 0, bounds.Dx()*bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			ar, ag, ab, aa := a.At(x, y).RGBA()
+			br, bg, bb, ba := b.At(x, y).RGBA()
+			diffs = append(diffs, max(absDiff(ar, br), absDiff(ag, bg), absDiff(ab, bb), absDiff(aa, ba))>>8)
+		}
+	}
+	var (
+		img       = image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		most      = slices.Max(diffs)
+		differing int
+	)
+	for i, d := range diffs {
+		if d > 0 {
+			differing++
+			img.Pix[i] = uint8(d * 255 / most)
+		}
+	}
+	return img, most, differing
+}
+
+func absDiff(a, b uint32) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math/rand/v2"
+	"randomart/nodes"
+	"randomart/render"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// fuzzTimeout is how long rendering the expression of each fuzzed grammar may
+// take.
+const fuzzTimeout = 10 * time.Second
+
+// fuzzStages are what is done with each fuzzed grammar, in order.
+var fuzzStages = []string{"parsing", "generating", "rendering"}
+
+// runFuzz generates -count random grammars and parses, generates from and
+// renders each of them, printing those that panicked at any stage. Errors are
+// expected, as the grammars are often invalid.
+func runFuzz(ctx context.Context) error {
+	if *count < 1 {
+		return fmt.Errorf("count must be at least 1")
+	}
+	seed := uint64(time.Now().Unix())
+	if flagSet("seed-string") {
+		seed, _ = nodes.SeedFromString(*seedString)
+	}
+	fmt.Printf("fuzzing %d grammars from seed %d\n", *count, seed)
+
+	var (
+		passed   = make([]int, len(fuzzStages))
+		panicked int
+	)
+	for i := range *count {
+		if ctx.Err() != nil {
+			break
+		}
+		src := nodes.RandomGrammar(rand.New(rand.NewPCG(seed, uint64(i))))
+		stages, err := fuzzGrammar(ctx, src, seed+uint64(i))
+		if err != nil {
+			panicked++
+			fmt.Printf("grammar %d panicked while %s: %s\n%s\n", i, fuzzStages[stages], err, src)
+		}
+		for stage := range stages {
+			passed[stage]++
+		}
+	}
+	fmt.Printf("%d grammars parsed, %d generated from and %d rendered\n", passed[0], passed[1], passed[2])
+	if panicked > 0 {
+		return fmt.Errorf("%d grammars panicked", panicked)
+	}
+	return nil
+}
+
+// fuzzGrammar parses, generates from and renders the grammar, returning how
+// many of those stages succeeded and the panic of the next if it panicked.
+func fuzzGrammar(ctx context.Context, src string, seed uint64) (stages int, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("%v\n%s", p, debug.Stack())
+		}
+	}()
+
+	grammar, err := nodes.Parse(strings.NewReader(src), "fuzz")
+	if err != nil {
+		return stages, nil
+	}
+	stages++
+	// Few tries at a shallow depth, as generating from grammars that rarely
+	// terminate takes exponentially long in the depth.
+	root, _, err := grammar.GenContext(ctx, nodes.WithSeeds(seed), nodes.WithMaxDepth(5), nodes.WithMaxGenerationTries(3))
+	if err != nil {
+		return stages, nil
+	}
+	stages++
+	ctx, cancel := context.WithTimeout(ctx, fuzzTimeout)
+	defer cancel()
+	err = render.RenderOutputsCallback(ctx, root, func(int, map[string]image.Image) error {
+		return nil
+	}, render.WithResolution(16, 16), render.WithFrames(2))
+	if err != nil {
+		return stages, nil
+	}
+	return stages + 1, nil
+}
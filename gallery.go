@@ -0,0 +1,172 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"randomart/nodes"
+	"randomart/render"
+)
+
+// galleryThumbnailSize is the length of the longest side of the thumbnails in
+// the gallery, unless -thumb is given.
+const galleryThumbnailSize = 192
+
+var galleryTemplate = template.Must(template.New("index.html").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Grammar}} - randomart</title>
+<style>
+body { font-family: sans-serif; background: #111; color: #ddd; margin: 24px; }
+main { display: flex; flex-wrap: wrap; gap: 16px; }
+figure { margin: 0; }
+figure img { display: block; }
+figcaption { font-size: 12px; margin-top: 4px; }
+a { color: inherit; }
+</style>
+</head>
+<body>
+<h1>{{.Grammar}}</h1>
+<main>
+{{- range .Entries}}
+<figure>
+<a href="{{.Image}}"><img src="{{.Thumbnail}}" width="{{.Width}}" height="{{.Height}}" title="{{.Expression}}" alt="seed {{.Seed}}"></a>
+<figcaption>seed {{.Seed}} &middot; <a href="{{.Options}}">options</a></figcaption>
+</figure>
+{{- end}}
+</main>
+</body>
+</html>
+`))
+
+type galleryEntry struct {
+	Image, Thumbnail, Options string
+	Width, Height             int
+	Seed                      uint64
+	Expression                string
+}
+
+// runGallery generates -count expressions from consecutive seeds and writes
+// their images, thumbnails and options to -dir, along with an index.html
+// showing them all. Interrupting it writes the index of the images rendered
+// so far.
+func runGallery(ctx context.Context) error {
+	if *count < 1 {
+		return fmt.Errorf("count must be at least 1")
+	}
+	optionsFile, err := readOptionsFile()
+	if err != nil {
+		return err
+	}
+	genOpts, err := generatorOptions(optionsFile)
+	if err != nil {
+		return err
+	}
+	grammar, err := loadGrammar(*grammarFilename)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(*galleryDir, 0o755); err != nil {
+		return fmt.Errorf("could not create gallery directory %q: %w", *galleryDir, err)
+	}
+
+	renOpts := []render.RenderOption{
+		render.WithResolution(*width, *height),
+		render.WithSamples(*samples),
+		render.WithJitter(*jitter),
+	}
+	renOpts = append(renOpts, paramOptions()...)
+	if *fastMath {
+		renOpts = append(renOpts, render.WithFastMath())
+	}
+	tw, th := fit(*width, *height, cmp.Or(*thumbSize, galleryThumbnailSize))
+
+	var (
+		entries []galleryEntry
+		opts    nodes.GeneratorOptions
+	)
+	for i := range *count {
+		if ctx.Err() != nil {
+			break
+		}
+		var (
+			node  nodes.Node
+			state *nodes.GeneratorState
+		)
+		if i == 0 {
+			node, state, err = grammar.GenContext(ctx, genOpts...)
+			if err == nil {
+				opts = state.Opts()
+			}
+		} else {
+			o := opts
+			o.Seed += uint64(i)
+			node, state, err = grammar.GenContext(ctx, nodes.FromOptions(o))
+		}
+		if err != nil {
+			if i == 0 {
+				return fmt.Errorf("could not generate random AST: %w", err)
+			}
+			fmt.Printf("could not generate expression %d: %s\n", i, err)
+			continue
+		}
+
+		fmt.Printf("rendering %d of %d... ", i+1, *count)
+		img, err := render.Render(ctx, node, renOpts...)
+		if err != nil {
+			fmt.Println()
+			if ctx.Err() != nil {
+				break
+			}
+			fmt.Printf("could not render expression %d: %s\n", i, err)
+			continue
+		}
+		entry := galleryEntry{
+			Image:      fmt.Sprintf("%03d.png", i),
+			Thumbnail:  fmt.Sprintf("%03d-thumb.png", i),
+			Options:    fmt.Sprintf("%03d.json", i),
+			Width:      tw,
+			Height:     th,
+			Seed:       state.Opts().Seed,
+			Expression: node.String(),
+		}
+		if err = writeImage(filepath.Join(*galleryDir, entry.Image), img, render.PNG); err != nil {
+			return err
+		}
+		if err = writeImage(filepath.Join(*galleryDir, entry.Thumbnail), thumbnail(img, tw, th), render.PNG); err != nil {
+			return err
+		}
+		runOptions, err := marshalOptions(state.Options(), effectiveRunOptions(*width, *height, nil, render.PNG))
+		if err != nil {
+			return fmt.Errorf("could not encode options: %w", err)
+		}
+		if err = os.WriteFile(filepath.Join(*galleryDir, entry.Options), []byte(runOptions), 0o644); err != nil {
+			return fmt.Errorf("could not write options: %w", err)
+		}
+		entries = append(entries, entry)
+		fmt.Println("Done!")
+	}
+
+	index := filepath.Join(*galleryDir, "index.html")
+	f, err := os.Create(index)
+	if err != nil {
+		return fmt.Errorf("could not create %q: %w", index, err)
+	}
+	err = galleryTemplate.Execute(f, map[string]any{
+		"Grammar": filepath.Base(*grammarFilename),
+		"Entries": entries,
+	})
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("could not write %q: %w", index, err)
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("could not write %q: %w", index, err)
+	}
+	fmt.Printf("wrote %d images to %s\n", len(entries), index)
+	return nil
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"randomart/nodes"
+	"strings"
+)
+
+const (
+	graphBoxWidth  = 110
+	graphBoxHeight = 44
+	graphColumn    = 170
+	graphRow       = 130
+	graphMargin    = 40
+)
+
+type graphRule struct {
+	name         string
+	x, y         float64
+	missing      bool
+	dead         bool
+	unproductive bool
+}
+
+// recursiveRules returns the strongly connected components of the reference
+// graph using Tarjan's algorithm, keyed by rule name. References between rules
+// in the same component are recursive.
+func recursiveRules(names []string, refs []nodes.RuleReference) map[string]int {
+	var (
+		index    = make(map[string]int)
+		low      = make(map[string]int)
+		onStack  = make(map[string]bool)
+		stack    []string
+		comp     = make(map[string]int)
+		nextComp int
+		connect  func(name string)
+	)
+	connect = func(name string) {
+		index[name], low[name] = len(index), len(index)
+		stack = append(stack, name)
+		onStack[name] = true
+		for _, ref := range refs {
+			if ref.From != name {
+				continue
+			}
+			if _, ok := index[ref.To]; !ok {
+				connect(ref.To)
+				low[name] = min(low[name], low[ref.To])
+			} else if onStack[ref.To] {
+				low[name] = min(low[name], index[ref.To])
+			}
+		}
+		if low[name] == index[name] {
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				comp[top] = nextComp
+				if top == name {
+					break
+				}
+			}
+			nextComp++
+		}
+	}
+	for _, name := range names {
+		if _, ok := index[name]; !ok {
+			connect(name)
+		}
+	}
+	return comp
+}
+
+// layoutGraph places the rules in rows by how many references they are from
+// the first production. Rules that can't be reached are placed in a final row.
+func layoutGraph(g *nodes.Grammar, refs []nodes.RuleReference) ([]*graphRule, map[string]*graphRule, float64, float64) {
+	var (
+		rules  []*graphRule
+		byName = make(map[string]*graphRule)
+		rows   [][]*graphRule
+	)
+	add := func(name string, row int) *graphRule {
+		r := &graphRule{name: name}
+		rules = append(rules, r)
+		byName[name] = r
+		for len(rows) <= row {
+			rows = append(rows, nil)
+		}
+		rows[row] = append(rows[row], r)
+		return r
+	}
+
+	defined := make(map[string]bool)
+	for _, p := range g.Productions {
+		defined[p.Name] = true
+	}
+	queue := []*graphRule{add(g.Productions[0].Name, 0)}
+	depth := map[string]int{g.Productions[0].Name: 0}
+	for len(queue) > 0 {
+		r := queue[0]
+		queue = queue[1:]
+		for _, ref := range refs {
+			if ref.From != r.name {
+				continue
+			}
+			if _, ok := byName[ref.To]; ok {
+				continue
+			}
+			depth[ref.To] = depth[r.name] + 1
+			next := add(ref.To, depth[ref.To])
+			next.missing = !defined[ref.To]
+			queue = append(queue, next)
+		}
+	}
+	deadRow := len(rows)
+	for _, p := range g.Productions {
+		if _, ok := byName[p.Name]; !ok {
+			add(p.Name, deadRow).dead = true
+		}
+	}
+	for _, name := range g.Unproductive() {
+		if r, ok := byName[name]; ok {
+			r.unproductive = true
+		}
+	}
+
+	widest := 0
+	for _, row := range rows {
+		widest = max(widest, len(row))
+	}
+	// Leave room for the legend below narrow graphs.
+	width := float64(max(widest*graphColumn, 560) + 2*graphMargin)
+	for y, row := range rows {
+		offset := (width - float64(len(row)*graphColumn)) / 2
+		for x, r := range row {
+			r.x = offset + float64(x*graphColumn) + graphColumn/2
+			r.y = float64(graphMargin + y*graphRow + graphBoxHeight/2)
+		}
+	}
+	height := float64(len(rows)*graphRow + 2*graphMargin)
+	return rules, byName, width, height
+}
+
+// clipToBox moves the point at x and y, the centre of a box, towards the point
+// at tx and ty until it is on the edge of the box.
+func clipToBox(x, y, tx, ty float64) (float64, float64) {
+	dx, dy := tx-x, ty-y
+	if dx == 0 && dy == 0 {
+		return x, y
+	}
+	t := math.Min(
+		graphBoxWidth/2/math.Max(math.Abs(dx), 1e-9),
+		graphBoxHeight/2/math.Max(math.Abs(dy), 1e-9),
+	)
+	return x + dx*t, y + dy*t
+}
+
+// writeGraph draws the grammar's productions and the references between them
+// as an SVG. Recursive references are drawn in orange, productions that can't
+// be reached from the first production are greyed out and productions that
+// can never finish generating are outlined in red.
+func writeGraph(w io.Writer, g *nodes.Grammar) error {
+	refs := g.References()
+	rules, byName, width, height := layoutGraph(g, refs)
+	names := make([]string, len(rules))
+	for i, r := range rules {
+		names[i] = r.name
+	}
+	components := recursiveRules(names, refs)
+
+	var b strings.Builder
+	legend := 4 * 18.0
+	_, _ = fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" font-family="monospace" font-size="13">`+"\n", width, height+legend)
+	b.WriteString(`<defs>
+<marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="7" markerHeight="7" orient="auto-start-reverse"><path d="M 0 0 L 10 5 L 0 10 z" fill="context-stroke"/></marker>
+</defs>
+<rect width="100%" height="100%" fill="white"/>
+`)
+
+	for _, ref := range refs {
+		from, to := byName[ref.From], byName[ref.To]
+		recursive := components[ref.From] == components[ref.To]
+		colour := "#555"
+		if recursive {
+			colour = "#e07000"
+		}
+		label := fmt.Sprintf("%.3g", ref.Weight)
+
+		if from == to {
+			x, y := from.x+graphBoxWidth/2, from.y
+			_, _ = fmt.Fprintf(&b, `<path d="M %.1f %.1f C %.1f %.1f, %.1f %.1f, %.1f %.1f" fill="none" stroke="%s" stroke-width="1.5" marker-end="url(#arrow)"/>`+"\n",
+				x, y-8, x+45, y-35, x+45, y+35, x, y+8, colour)
+			_, _ = fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" fill="%s">%s</text>`+"\n", x+40, y+4, colour, label)
+			continue
+		}
+
+		x1, y1 := clipToBox(from.x, from.y, to.x, to.y)
+		x2, y2 := clipToBox(to.x, to.y, from.x, from.y)
+		mx, my := (x1+x2)/2, (y1+y2)/2
+		if recursive {
+			// Bend recursive references so that references in both
+			// directions between two rules don't overlap.
+			dx, dy := x2-x1, y2-y1
+			l := math.Hypot(dx, dy)
+			cx, cy := mx-dy/l*40, my+dx/l*40
+			_, _ = fmt.Fprintf(&b, `<path d="M %.1f %.1f Q %.1f %.1f, %.1f %.1f" fill="none" stroke="%s" stroke-width="1.5" marker-end="url(#arrow)"/>`+"\n",
+				x1, y1, cx, cy, x2, y2, colour)
+			mx, my = (mx+cx)/2, (my+cy)/2
+		} else {
+			_, _ = fmt.Fprintf(&b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="1.5" marker-end="url(#arrow)"/>`+"\n",
+				x1, y1, x2, y2, colour)
+		}
+		_, _ = fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" fill="%s" text-anchor="middle" paint-order="stroke" stroke="white" stroke-width="3">%s</text>`+"\n", mx, my+4, colour, label)
+	}
+
+	for _, r := range rules {
+		fill, stroke, dash, note := "#eef2ff", "#4050a0", "", ""
+		switch {
+		case r.missing:
+			fill, stroke, dash, note = "#fff0f0", "#d00000", ` stroke-dasharray="5 3"`, "missing"
+		case r.dead:
+			fill, stroke, note = "#eeeeee", "#999999", "unreachable"
+		}
+		if r.unproductive && !r.missing {
+			stroke, note = "#d00000", "never finishes"
+		}
+		_, _ = fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%d" height="%d" rx="6" fill="%s" stroke="%s" stroke-width="2"%s/>`+"\n",
+			r.x-graphBoxWidth/2, r.y-graphBoxHeight/2, graphBoxWidth, graphBoxHeight, fill, stroke, dash)
+		nameY := r.y + 5
+		if note != "" {
+			nameY = r.y
+			_, _ = fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="middle" font-size="10" fill="%s">%s</text>`+"\n", r.x, r.y+14, stroke, note)
+		}
+		_, _ = fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="middle" font-weight="bold">%s</text>`+"\n", r.x, nameY, html.EscapeString(r.name))
+	}
+
+	for i, entry := range []struct{ colour, text string }{
+		{"#555", "reference, labelled with the weight of the alternatives that make it"},
+		{"#e07000", "recursive reference"},
+		{"#999999", "unreachable from the first production"},
+		{"#d00000", "missing production or production that can never finish generating"},
+	} {
+		y := height + float64(i)*18
+		_, _ = fmt.Fprintf(&b, `<rect x="%d" y="%.1f" width="12" height="12" fill="%s"/>`+"\n", graphMargin, y-10, entry.colour)
+		_, _ = fmt.Fprintf(&b, `<text x="%d" y="%.1f">%s</text>`+"\n", graphMargin+20, y, entry.text)
+	}
+	b.WriteString("</svg>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func runGraph() error {
+	grammar, err := loadGrammar(*grammarFilename)
+	if err != nil {
+		return err
+	}
+	if !flagSet("output") || *outputFilename == "-" {
+		return writeGraph(stdout, grammar)
+	}
+	if !strings.EqualFold(filepath.Ext(*outputFilename), ".svg") {
+		return fmt.Errorf("the grammar graph can only be written as an SVG")
+	}
+	out, err := os.Create(*outputFilename)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return writeGraph(out, grammar)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path"
+	"randomart/render"
+	"strconv"
+	"strings"
+)
+
+var (
+	oscAddr  = flag.String("osc", "", "The UDP address, such as :9001, to receive OSC messages on, setting the parameter named by the last part of each message's address, such as speed for /1/speed, to its first argument")
+	midiPath = flag.String("midi", "", "The MIDI device, such as /dev/snd/midiC1D0, to read control changes from, setting the parameters that they are mapped to with -midi-cc")
+)
+
+// midiCCs are the parameters that MIDI control changes are mapped to with
+// -midi-cc.
+var midiCCs = make(map[byte]string)
+
+func init() {
+	flag.Func("midi-cc", "Map the MIDI control change with the given number to a parameter as number=name, scaling its value to between -1 and 1, can be given multiple times", func(s string) error {
+		cc, name, ok := strings.Cut(s, "=")
+		if !ok {
+			return fmt.Errorf("%q is not number=name", s)
+		}
+		n, err := strconv.ParseUint(cc, 10, 7)
+		if err != nil {
+			return fmt.Errorf("invalid control change number %q: %w", cc, err)
+		}
+		midiCCs[byte(n)] = strings.TrimPrefix(name, "$")
+		return nil
+	})
+}
+
+// startLiveParams starts receiving the parameters given by -osc and -midi
+// until the context is done, or returns nil if neither is given.
+func startLiveParams(ctx context.Context) (*render.LiveParams, error) {
+	if *oscAddr == "" && *midiPath == "" {
+		return nil, nil
+	}
+	live := render.NewLiveParams()
+	if *oscAddr != "" {
+		conn, err := net.ListenPacket("udp", *oscAddr)
+		if err != nil {
+			return nil, fmt.Errorf("could not listen for OSC on %q: %w", *oscAddr, err)
+		}
+		context.AfterFunc(ctx, func() { conn.Close() })
+		fmt.Printf("Receiving OSC on %s\n", conn.LocalAddr())
+		go receiveOSC(conn, live)
+	}
+	if *midiPath != "" {
+		if len(midiCCs) == 0 {
+			return nil, fmt.Errorf("-midi-cc must map control changes to parameters to read MIDI")
+		}
+		f, err := os.Open(*midiPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not open MIDI device: %w", err)
+		}
+		context.AfterFunc(ctx, func() { f.Close() })
+		go func() {
+			if err := readMIDI(f, live); err != nil && ctx.Err() == nil {
+				fmt.Printf("could not read MIDI from %q: %s\n", *midiPath, err)
+			}
+		}()
+	}
+	return live, nil
+}
+
+// receiveOSC sets the parameters of the OSC messages received on conn until it
+// is closed. Messages that can't be decoded are ignored.
+func receiveOSC(conn net.PacketConn, live *render.LiveParams) {
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		decodeOSC(buf[:n], func(address string, value float64) {
+			live.Set(path.Base(address), value)
+		})
+	}
+}
+
+// decodeOSC calls set with the address and first numeric argument of each
+// message of the OSC packet, which may be a bundle of them.
+func decodeOSC(packet []byte, set func(address string, value float64)) {
+	if bundle, ok := strings.CutPrefix(string(packet), "#bundle\x00"); ok {
+		// The time tag is ignored, as messages are applied as they arrive.
+		if len(bundle) < 8 {
+			return
+		}
+		elements := []byte(bundle[8:])
+		for len(elements) >= 4 {
+			size := int(binary.BigEndian.Uint32(elements))
+			if size > len(elements)-4 {
+				return
+			}
+			decodeOSC(elements[4:4+size], set)
+			elements = elements[4+size:]
+		}
+		return
+	}
+	address, rest, ok := oscString(packet)
+	if !ok || !strings.HasPrefix(address, "/") {
+		return
+	}
+	tags, args, ok := oscString(rest)
+	if !ok || !strings.HasPrefix(tags, ",") || len(tags) < 2 {
+		return
+	}
+	var value float64
+	switch tag := tags[1]; {
+	case tag == 'f' && len(args) >= 4:
+		value = float64(math.Float32frombits(binary.BigEndian.Uint32(args)))
+	case tag == 'i' && len(args) >= 4:
+		value = float64(int32(binary.BigEndian.Uint32(args)))
+	case tag == 'd' && len(args) >= 8:
+		value = math.Float64frombits(binary.BigEndian.Uint64(args))
+	case tag == 'h' && len(args) >= 8:
+		value = float64(int64(binary.BigEndian.Uint64(args)))
+	case tag == 'T':
+		value = 1
+	case tag == 'F':
+		value = 0
+	default:
+		return
+	}
+	set(address, value)
+}
+
+// oscString returns the null terminated string that data starts with and
+// what follows its padding to a multiple of 4 bytes.
+func oscString(data []byte) (string, []byte, bool) {
+	end := strings.IndexByte(string(data), 0)
+	if end < 0 {
+		return "", nil, false
+	}
+	padded := min((end/4+1)*4, len(data))
+	return string(data[:end]), data[padded:], true
+}
+
+// readMIDI sets the parameters mapped to the control changes read from r,
+// scaled to between -1 and 1, until it fails.
+func readMIDI(r io.Reader, live *render.LiveParams) error {
+	br := bufio.NewReader(r)
+	var (
+		status byte
+		data   []byte
+	)
+	for {
+		b, err := br.ReadByte()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		switch {
+		case b >= 0xF8:
+			// Real time messages can come between the bytes of others and
+			// don't change the running status.
+			continue
+		case b >= 0x80:
+			status, data = b, data[:0]
+			continue
+		case status == 0 || status >= 0xF0:
+			// The data of system messages, such as system exclusives.
+			continue
+		}
+		data = append(data, b)
+		// Program changes and channel pressure have one data byte, and the
+		// other channel messages two.
+		n := 2
+		if kind := status & 0xF0; kind == 0xC0 || kind == 0xD0 {
+			n = 1
+		}
+		if len(data) < n {
+			continue
+		}
+		if status&0xF0 == 0xB0 {
+			if name, ok := midiCCs[data[0]]; ok {
+				live.Set(name, float64(data[1])/127*2-1)
+			}
+		}
+		// Running status lets the next message leave out the status.
+		data = data[:0]
+	}
+}
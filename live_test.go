@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"maps"
+	"math"
+	"randomart/render"
+	"testing"
+)
+
+// oscPad pads s with nulls to a multiple of 4 bytes, as OSC strings are.
+func oscPad(s string) []byte {
+	return append([]byte(s), make([]byte, 4-len(s)%4)...)
+}
+
+func oscMessage(address, tags string, args ...byte) []byte {
+	return append(append(oscPad(address), oscPad(tags)...), args...)
+}
+
+func oscBundle(elements ...[]byte) []byte {
+	bundle := append(oscPad("#bundle"), make([]byte, 8)...)
+	for _, e := range elements {
+		bundle = binary.BigEndian.AppendUint32(bundle, uint32(len(e)))
+		bundle = append(bundle, e...)
+	}
+	return bundle
+}
+
+func TestDecodeOSC(t *testing.T) {
+	half := binary.BigEndian.AppendUint32(nil, math.Float32bits(0.5))
+	for _, test := range []struct {
+		name   string
+		packet []byte
+		want   map[string]float64
+	}{
+		{"float", oscMessage("/1/speed", ",f", half...), map[string]float64{"/1/speed": 0.5}},
+		{"true", oscMessage("/on", ",T"), map[string]float64{"/on": 1}},
+		{"bundle", oscBundle(
+			oscMessage("/a", ",i", binary.BigEndian.AppendUint32(nil, uint32(3))...),
+			oscMessage("/b", ",d", binary.BigEndian.AppendUint64(nil, math.Float64bits(-0.25))...),
+		), map[string]float64{"/a": 3, "/b": -0.25}},
+		{"truncated argument", oscMessage("/1/speed", ",f", half[:2]...), map[string]float64{}},
+		{"truncated address", []byte("/1/sp"), map[string]float64{}},
+		{"truncated bundle", oscBundle(oscMessage("/a", ",T"), oscMessage("/b", ",T"))[:36], map[string]float64{"/a": 1}},
+		{"unsupported tag", oscMessage("/name", ",s", oscPad("fast")...), map[string]float64{}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := make(map[string]float64)
+			decodeOSC(test.packet, func(address string, value float64) {
+				got[address] = value
+			})
+			if !maps.Equal(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReadMIDI(t *testing.T) {
+	saved := maps.Clone(midiCCs)
+	t.Cleanup(func() { midiCCs = saved })
+	midiCCs = map[byte]string{7: "volume", 10: "pan"}
+	for _, test := range []struct {
+		name string
+		midi []byte
+		want map[string]float64
+	}{
+		{"control change", []byte{0xB0, 7, 127}, map[string]float64{"volume": 1}},
+		{"unmapped", []byte{0xB0, 8, 127}, map[string]float64{}},
+		// The second control change leaves out its status and has a timing
+		// clock between its data bytes.
+		{"running status", []byte{0xB0, 7, 0, 10, 0xF8, 127}, map[string]float64{"volume": -1, "pan": 1}},
+		// The data bytes of program changes and system exclusives aren't
+		// control changes.
+		{"other messages", []byte{0xC0, 7, 10, 0xF0, 7, 127, 0xF7}, map[string]float64{}},
+		{"truncated", []byte{0xB0, 7}, map[string]float64{}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			live := render.NewLiveParams()
+			if err := readMIDI(bytes.NewReader(test.midi), live); err != nil {
+				t.Fatal(err)
+			}
+			if got := live.Values(); !maps.Equal(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -1,34 +1,167 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"cmp"
 	"context"
+	"encoding/hex"
+	"errors"
+	"expvar"
 	"flag"
 	"fmt"
+	"google.golang.org/grpc"
 	"image"
-	"image/png"
+	"image/jpeg"
+	"io"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"path"
 	"randomart/nodes"
 	"randomart/render"
+	"randomart/rpc"
+	"runtime/debug"
+	"slices"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 )
 
 var (
-	grammarFilename       = flag.String("grammar", "grammar.bnf", "Path to the grammar file to generate from")
-	outputFilename        = flag.String("output", "output.png", "Path to output file that the randomart will be written to")
+	grammarFilename       = flag.String("grammar", "grammar.bnf", "Path to the grammar file to generate from, or - to read it from stdin")
+	grammarCache          = flag.String("grammar-cache", "", "Directory to cache parsed grammars in, keyed by the hash of their source, so that the same grammar is only parsed once")
+	expressionFilename    = flag.String("expression", "", "Path to a file containing an expression, as printed when it was generated, to render instead of generating one from the grammar, or - to read it from stdin")
+	outputFilename        = flag.String("output", "output.png", "Path to output file that the randomart will be written to, or an s3://bucket/key or http(s) URL to upload it to, or - to write it to stdout. {frame} is replaced with the frame number")
 	width                 = flag.Int("width", 400, "The width of the produced randomart")
 	height                = flag.Int("height", 400, "The height of the produced randomart")
 	frames                = flag.Int("frames", 1, "The number of frames of randomart to generate")
+	startFrame            = flag.Int("start-frame", 0, "The first frame to render, so that the frames can be split between machines")
+	endFrame              = flag.Int("end-frame", 0, "The frame to stop rendering before, or 0 to render up to the last frame")
+	samples               = flag.Int("samples", 1, "The number of samples to average for each pixel")
+	jitter                = flag.Float64("jitter", 0, "How far, as a fraction of a pixel, each sample can be randomly offset from the pixel's position")
+	candidates            = flag.Int("candidates", 1, "Generate this many expressions from consecutive seeds and keep the one whose first frame has the highest entropy")
+	minEntropy            = flag.Float64("min-entropy", 0, "Regenerate expressions from the next seed until one's colours have at least this entropy in bits, up to 10, to skip flat images")
+	minDepth              = flag.Int("min-depth", 0, "Regenerate expressions from the next seed until one is at least this many nodes deep")
+	maxNodes              = flag.Int("max-nodes", 0, "Regenerate expressions from the next seed until one has at most this many nodes, to bound how long it takes to render")
+	seedString            = flag.String("seed-string", "", "Generate from a seed hashed from this string, such as a name or email address, instead of from the time")
+	channelRules          = flag.String("channel-rules", "", "Comma separated productions to generate the red, green and blue channels from separately instead of the first production")
+	productionStreams     = flag.Bool("production-streams", false, "Give each production its own stream of random numbers so that editing one changes less of what the others generate, the same seed generates something else with it")
+	requireComponents     = flag.String("require-components", "", "Comma separated components, such as x,y, to regenerate expressions from the next seed until one uses all of")
+	stream                = flag.Bool("stream", false, "Render and encode a single frame to PNG a band of rows at a time, for resolutions too large to hold in memory")
+	fastMath              = flag.Bool("fast-math", false, "Evaluate expensive functions with faster approximations")
+	errorColor            = flag.String("error-color", "", "Hex colour, such as ff00ff, to give the pixels that can't be evaluated instead of failing the render, reporting the errors of the first of them")
+	budget                = flag.Duration("budget", 0, "Regenerate expressions from the next seed until one is estimated to render within this long, such as 30s, and refuse to render those given with -expression that aren't")
+	targetDuration        = flag.Duration("target-duration", 0, "Lower the resolution, keeping its aspect ratio, to the largest estimated to render within this long, such as 2s, from timing a few pixels first")
+	interpolate           = flag.Int("interpolate", 1, "Render every this many frames, and the last, and blend the frames between them, for long animations that change slowly")
+	motionBlur            = flag.Int("motion-blur", 1, "The number of times across the shutter to evaluate f at for each pixel, averaging them to blur fast motion")
+	shutter               = flag.Float64("shutter", 0.5, "The fraction of the time between frames that -motion-blur samples f across")
+	pixelTimeout          = flag.Duration("pixel-timeout", 0, "Fail rendering rows that take longer than this for each of their pixels, such as 1ms, so that expressions too large to render give up rather than run indefinitely")
+	costHeatmapFilename   = flag.String("cost-heatmap", "", "Path to write a PNG to where the brightness of each pixel is how many nodes were evaluated for it")
+	branchOverlay         = flag.Bool("branch-overlay", false, "Tint each pixel by the if/then/else branches taken to evaluate it, for debugging")
+	srcVideoFilename      = flag.String("src-video", "", "Path to a video whose frames are used as the source for each frame of the randomart, requires ffmpeg")
 	srcFilename           = flag.String("src", "", "Path to the source image to use as a starting point for the randomart algorithm")
-	optionsOutputFilename = flag.String("ooptions", "", "Path to output generator options to so that the randomart image can be reproduced")
-	optionsInputFilename  = flag.String("ioptions", "", "Path to a JSON file containing options to pass to the generator")
+	maskFilename          = flag.String("mask", "", "Path to an image where only the pixels that are opaque are rendered, the rest are copied from the src image or left transparent")
+	tileable              = flag.Bool("tileable", false, "Map x and y through a cosine so that they go across the image and back again, mirroring the randomart so that it tiles seamlessly")
+	dithering             = flag.String("dithering", "none", "How the colours of the randomart are dithered when rounded to 8 bits (none, floyd-steinberg or ordered), to hide the banding of smooth gradients")
+	mode                  = flag.String("mode", "rgba", "How the colours of the expression are rendered (rgba, grayscale, gray16 or normal), the other modes render the luminance of expressions that can be numbers rather than triples and normal renders it as a normal map")
+	heightmap             = flag.Bool("heightmap", false, "Also write the 16-bit heights that normal maps are rendered from, to the output filename with -height added")
+	lutFilename           = flag.String("lut", "", "Path to a 3D LUT in the .cube format to colour grade the randomart with")
+	paletteFilename       = flag.String("palette", "", "Path to a palette with a hex colour on each line, such as a lospec .hex file, to map the colours of the randomart onto")
+	paletteDither         = flag.Bool("palette-dither", false, "Dither the colours of the palette in an ordered pattern instead of mapping each pixel to the nearest")
+	optionsOutputFilename = flag.String("ooptions", "", "Path to output generator and render options to so that the randomart image can be reproduced")
+	optionsInputFilename  = flag.String("ioptions", "", "Path to a JSON file containing options to pass to the generator and renderer, flags given explicitly take precedence")
+	requireCompatible     = flag.Bool("require-compatible", false, "Fail instead of warning when the options given with -ioptions were written by an incompatible generator or from a different grammar, so their seed may generate something else")
+	manifestFilename      = flag.String("manifest", "", "Path to write a JSON manifest of every image written to, with the seed, options, hash of the expression, resolution and render time needed to reproduce it")
+	checkpointFilename    = flag.String("checkpoint", "", "Path to record the frames that have been written to, along with the expression and options, so that running again with it resumes at the first frame that wasn't")
+	thumbSize             = flag.Int("thumb", 0, "Also write a thumbnail of each image, with the output filename with -thumb added, whose longest side is this many pixels")
+	outputFormat          = flag.String("format", "", "The format to encode the randomart as, inferred from the output filename if not given")
+	grid                  = flag.Int("grid", 0, "Tile all frames into a single image with the given number of columns")
+	fps                   = flag.Int("fps", 24, "The frame rate of animated output formats")
+	quality               = flag.Int("quality", jpeg.DefaultQuality, "The quality of the produced randomart when encoding to a lossy format")
+	preview               = flag.String("preview", "", "Preview the rendered randomart, the only supported mode is \"term\" which prints the images to the terminal")
+	previewProtocol       = flag.String("preview-protocol", "auto", "The terminal image protocol to preview with (auto, halfblocks, kitty, iterm or sixel)")
+	jsFilename            = flag.String("js", "", "Path to write the generated expression to as a JavaScript function that draws it onto a canvas")
+	astDotFilename        = flag.String("ast-dot", "", "Path to write the generated expression to as a Graphviz graph")
+	astOutputFilename     = flag.String("oast", "", "Path to write the AST of the expression to as JSON, which can be read with -iast")
+	astInputFilename      = flag.String("iast", "", "Path to a JSON file containing the AST of an expression, as written with -oast")
+	workers               = flag.String("workers", "", "Comma separated addresses of workers started with the worker command to render on")
+	population            = flag.Int("population", 32, "The number of expressions evolved at once")
+	generations           = flag.Int("generations", 100, "The number of generations to evolve expressions for")
+	diffHeatmapFilename   = flag.String("diff-heatmap", "", "Path to write a PNG to where the brightness of each pixel is how different the images of the two generations compared by the diff command are")
+	count                 = flag.Int("count", 24, "The number of expressions to generate from consecutive seeds for the gallery, or of grammars to generate for fuzz")
+	galleryDir            = flag.String("dir", "gallery", "The directory to write the gallery's images, thumbnails, options and index.html to")
+	sweepRule             = flag.String("rule", "", "The production whose alternative's weight is swept")
+	sweepAlternative      = flag.Int("alternative", 0, "The index of the alternative of -rule whose weight is swept, counting from 0 in the order of the grammar")
+	sweepFrom             = flag.Float64("from", 0, "The weight that the sweep starts at")
+	sweepTo               = flag.Float64("to", 1, "The weight that the sweep ends at")
+	sweepSteps            = flag.Int("steps", 5, "The number of weights to render in the sweep")
+	watch                 = flag.Bool("watch", false, "Render the sweep again whenever the grammar file changes")
+	metrics               = flag.String("metrics", "", "The address to serve metrics on at /metrics, in the Prometheus text format, and /debug/vars")
+	listen                = flag.String("listen", ":9000", "The address to listen on")
+	pprofAddr             = flag.String("pprof", "", "The address to serve the profiles of net/http/pprof on at /debug/pprof/")
+	cpuProfile            = flag.String("cpuprofile", "", "Path to write a CPU profile of the command to, for go tool pprof")
+	memProfile            = flag.String("memprofile", "", "Path to write a heap profile to once the command finishes, for go tool pprof")
+	traceFilename         = flag.String("trace", "", "Path to write an execution trace of the command to, for go tool trace")
+	flushOnCancel         = flag.Bool("flush-on-cancel", false, "Write the frames rendered before the render is interrupted, including the rows of the frame being rendered, rather than discarding them")
+	logJSON               = flag.Bool("log-json", false, "Log structured events of the render, such as how long each frame took, as JSON to stderr")
 	verbose               = flag.Bool("verbose", false, "Output more logs")
 )
 
+// stdout is where images are written to with -output -, in which case the
+// logs are written to stderr instead.
+var stdout io.Writer = os.Stdout
+
+// params are the values of the expression's parameters given with -param.
+var params = make(map[string]float64)
+
+func init() {
+	flag.Func("param", "Bind a parameter of the expression, written $name in the grammar, as name=value, can be given multiple times", func(s string) error {
+		name, v, ok := strings.Cut(s, "=")
+		if !ok {
+			return fmt.Errorf("%q is not name=value", s)
+		}
+		value, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid value for parameter %s: %w", name, err)
+		}
+		params[strings.TrimPrefix(name, "$")] = value
+		return nil
+	})
+}
+
+func paramOptions() []render.RenderOption {
+	var opts []render.RenderOption
+	for name, value := range params {
+		opts = append(opts, render.WithParam(name, value))
+	}
+	return opts
+}
+
 func main() {
-	flag.Parse()
+	name, args := "render", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	cmd := lookupCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+		usage()
+		os.Exit(2)
+	}
+	commandFlags = cmd.flagSet()
+	_ = commandFlags.Parse(args)
+	if err := loadConfig(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if *outputFilename == "-" {
+		os.Stdout = os.Stderr
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -44,52 +177,271 @@ func main() {
 	}()
 	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
 
-	grammarFile, err := os.Open(*grammarFilename)
+	stopProfiling, err := startProfiling()
 	if err != nil {
-		fmt.Printf("could not open grammar file %q: %s\n", *grammarFilename, err)
-		return
+		fmt.Println(err)
+		os.Exit(1)
 	}
-	defer grammarFile.Close()
+	err = cmd.run(ctx, commandFlags.Args())
+	if perr := stopProfiling(); perr != nil {
+		fmt.Println(perr)
+	}
+	if err != nil {
+		fmt.Println(err)
+		cancel()
+		os.Exit(1)
+	}
+}
 
-	grammar, err := nodes.Parse(grammarFile, *grammarFilename)
+// runRender renders the expression given with -expression, or one generated
+// from the grammar, and writes the frames to the output.
+func runRender(ctx context.Context) error {
+	var (
+		restored           *runOptions
+		explicitResolution = flagSet("width") || flagSet("height")
+	)
+	optionsFile, err := readOptionsFile()
 	if err != nil {
-		fmt.Printf("could not parse grammar: %s\n", err)
-		return
+		return err
+	}
+	if optionsFile != nil {
+		if restored, err = readRunOptions(optionsFile); err != nil {
+			return fmt.Errorf("could not read render options: %w", err)
+		}
+		explicitResolution = explicitResolution || restored != nil
+	}
+	genOpts, err := generatorOptions(optionsFile)
+	if err != nil {
+		return err
 	}
-	fmt.Println(grammar.String())
 
-	var genOpts []nodes.GeneratorOption
-	if *optionsInputFilename != "" {
-		optionsInputFile, err := os.Open(*optionsInputFilename)
-		if err != nil {
-			fmt.Printf("could not open input options file %q: %s\n", *optionsInputFilename, err)
-			return
+	var resume *checkpoint
+	if *checkpointFilename != "" {
+		if resume, err = readCheckpoint(*checkpointFilename); err != nil {
+			return err
+		}
+		if resume != nil {
+			if restored, err = readRunOptions(resume.Options); err != nil {
+				return fmt.Errorf("could not read render options from checkpoint: %w", err)
+			}
+			explicitResolution = explicitResolution || restored != nil
+		}
+	}
+
+	var video *videoSource
+	if *srcVideoFilename != "" {
+		if *srcFilename != "" {
+			return fmt.Errorf("cannot use both a src image and a src video")
+		}
+		if video, err = openVideo(ctx, *srcVideoFilename); err != nil {
+			return fmt.Errorf("could not open src video: %w", err)
+		}
+		defer video.Close()
+		if !flagSet("frames") && restored == nil {
+			*frames = video.frames
+		}
+		if !explicitResolution {
+			*width, *height = video.width, video.height
 		}
-		defer optionsInputFile.Close()
-		genOpts = append(genOpts, nodes.FromJSON(optionsInputFile))
 	}
 
-	node, state, err := grammar.Gen(genOpts...)
+	if *budget > 0 {
+		genOpts = append(genOpts, nodes.WithAcceptFunc(func(root nodes.Node) bool {
+			return estimateCost(root) <= *budget
+		}))
+	}
+
+	var (
+		node  nodes.Node
+		state *nodes.GeneratorState
+	)
+	switch {
+	case resume != nil:
+		node, err = nodes.ParseExpression(strings.NewReader(resume.Expression), *checkpointFilename)
+	case *expressionFilename != "":
+		node, err = loadExpression(*expressionFilename)
+	default:
+		var grammar *nodes.Grammar
+		if grammar, err = loadGrammar(*grammarFilename); err != nil {
+			return err
+		}
+		fmt.Println(grammar.String())
+		if optionsFile != nil {
+			if err = checkCompatible(optionsFile, grammar, restored); err != nil {
+				return err
+			}
+		}
+		node, state, err = generate(ctx, grammar, genOpts)
+	}
 	if err != nil {
-		fmt.Printf("could not generate random AST: %s\n", err)
-		return
+		return err
+	}
+	// Expressions that weren't generated only have render options.
+	options := "{}"
+	if state != nil {
+		options = state.Options()
+	} else if resume != nil {
+		options = string(resume.Options)
 	}
-	options := state.Options()
 	fmt.Println(node)
 	fmt.Println(options)
+	if cost := estimateCost(node); *budget > 0 && cost > *budget {
+		return fmt.Errorf("rendering the expression is estimated to take %s, more than the budget of %s", cost.Round(time.Millisecond), *budget)
+	}
+
+	if err = exportExpression(node); err != nil {
+		return err
+	}
 
 	renOpts := []render.RenderOption{
-		render.WithResolution(*width, *height),
 		render.WithFrames(*frames),
+		render.WithSamples(*samples),
+		render.WithJitter(*jitter),
+	}
+	renOpts = append(renOpts, paramOptions()...)
+	if *fastMath {
+		renOpts = append(renOpts, render.WithFastMath())
+	}
+	if *pixelTimeout > 0 {
+		renOpts = append(renOpts, render.WithPixelTimeout(*pixelTimeout))
+	}
+	if *targetDuration > 0 {
+		renOpts = append(renOpts, render.WithTargetDuration(*targetDuration))
+	}
+	if *interpolate != 1 {
+		renOpts = append(renOpts, render.WithInterpolatedFrames(*interpolate))
+	}
+	if *motionBlur != 1 {
+		renOpts = append(renOpts, render.WithMotionBlur(*motionBlur, *shutter))
+	}
+	if *branchOverlay {
+		renOpts = append(renOpts, render.WithBranchOverlay())
+	}
+	if *workers != "" {
+		renOpts = append(renOpts, render.WithRemoteWorkers(strings.Split(*workers, ",")...))
+	}
+	var (
+		srcHash                         []byte
+		effectiveWidth, effectiveHeight = *width, *height
+	)
+	if *srcFilename == "" || explicitResolution {
+		renOpts = append(renOpts, render.WithResolution(*width, *height))
 	}
 	if *srcFilename != "" {
-		srcFile, err := os.Open(*srcFilename)
+		src, err := os.ReadFile(*srcFilename)
 		if err != nil {
-			fmt.Printf("could not open src file %q: %s\n", *srcFilename, err)
-			return
+			return fmt.Errorf("could not read src file %q: %w", *srcFilename, err)
+		}
+		srcHash = hashSource(src)
+		if restored != nil && restored.SrcSHA256 != "" && restored.SrcSHA256 != hex.EncodeToString(srcHash) {
+			fmt.Printf("warning: src file %q has changed since the options were written\n", *srcFilename)
+		}
+		if !explicitResolution {
+			config, _, err := image.DecodeConfig(bytes.NewReader(src))
+			if err != nil {
+				return fmt.Errorf("could not decode src file %q: %w", *srcFilename, err)
+			}
+			effectiveWidth, effectiveHeight = config.Width, config.Height
+		}
+		renOpts = append(renOpts, render.WithSourceImage(bytes.NewReader(src)))
+	}
+	if video != nil {
+		renOpts = append(renOpts, render.WithSourceSequence(video.frame))
+	}
+	if *maskFilename != "" {
+		data, err := os.ReadFile(*maskFilename)
+		if err != nil {
+			return fmt.Errorf("could not read mask file %q: %w", *maskFilename, err)
+		}
+		mask, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("could not decode mask file %q: %w", *maskFilename, err)
+		}
+		renOpts = append(renOpts, render.WithMask(mask))
+	}
+	if *tileable {
+		renOpts = append(renOpts, render.WithTileable())
+	}
+	if *dithering != string(render.NoDithering) {
+		d, err := render.ParseDithering(*dithering)
+		if err != nil {
+			return err
+		}
+		renOpts = append(renOpts, render.WithDithering(d))
+	}
+	if *mode != string(render.RGBA) {
+		m, err := render.ParseMode(*mode)
+		if err != nil {
+			return err
 		}
-		defer srcFile.Close()
-		renOpts = append(renOpts, render.WithSourceImage(srcFile))
+		renOpts = append(renOpts, render.WithMode(m))
+	}
+	// The manifest is created once the output format is known, before any
+	// images are written.
+	var mf *manifest
+	if *heightmap {
+		names := nodes.OutputNames(node)
+		if len(names) == 0 {
+			names = []string{""}
+		}
+		renOpts = append(renOpts, render.WithHeightmaps(func(no int, heightmaps []image.Image) error {
+			for i, img := range heightmaps {
+				name := "height"
+				if names[i] != "" {
+					name = names[i] + "-height"
+				}
+				if err := writeImage(outputFilenameFor(name, no), img, render.PNG); err != nil {
+					return fmt.Errorf("could not write heightmap of frame %d: %w", no, err)
+				}
+				mf.add(outputFilenameFor(name, no), no)
+			}
+			return nil
+		}))
+	}
+	if *lutFilename != "" {
+		lut, err := os.ReadFile(*lutFilename)
+		if err != nil {
+			return fmt.Errorf("could not read LUT file %q: %w", *lutFilename, err)
+		}
+		renOpts = append(renOpts, render.WithLUT(bytes.NewReader(lut)))
+	}
+	if *paletteFilename != "" {
+		f, err := os.Open(*paletteFilename)
+		if err != nil {
+			return fmt.Errorf("could not open palette file %q: %w", *paletteFilename, err)
+		}
+		palette, err := render.ReadPalette(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("could not read palette file %q: %w", *paletteFilename, err)
+		}
+		renOpts = append(renOpts, render.WithPalette(palette))
+		if *paletteDither {
+			renOpts = append(renOpts, render.WithPaletteDither())
+		}
+	}
+	if *errorColor != "" {
+		c, err := render.ReadPalette(strings.NewReader(*errorColor))
+		if err != nil || len(c) != 1 {
+			return fmt.Errorf("%q is not a hex colour", *errorColor)
+		}
+		renOpts = append(renOpts, render.WithErrorColor(c[0]))
+	}
+	if *costHeatmapFilename != "" {
+		heatmap, err := os.Create(*costHeatmapFilename)
+		if err != nil {
+			return fmt.Errorf("could not create cost heatmap file %q: %w", *costHeatmapFilename, err)
+		}
+		defer heatmap.Close()
+		renOpts = append(renOpts, render.WithCostHeatmap(heatmap))
+	}
+	if *flushOnCancel {
+		// The partially rendered frame is rendered again when resuming from
+		// a checkpoint instead.
+		renOpts = append(renOpts, render.WithFlushOnCancel(*checkpointFilename == ""))
+	}
+	if *logJSON {
+		renOpts = append(renOpts, render.WithSlog(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))))
 	}
 	if *verbose {
 		renOpts = append(renOpts, render.WithLogger(func(f string, args ...any) {
@@ -97,44 +449,600 @@ func main() {
 		}))
 	}
 
-	err = render.RenderCallback(ctx, node, func(no int, img image.Image) error {
-		filename := *outputFilename
-		if *frames > 1 {
-			ext := path.Ext(filename)
-			filename = fmt.Sprintf("%s-%03d%s", strings.TrimSuffix(filename, ext), no, ext)
+	var format render.Format
+	if *outputFormat != "" {
+		format, err = render.ParseFormat(*outputFormat)
+	} else {
+		format, err = render.FormatFromFilename(*outputFilename)
+	}
+	if err != nil {
+		return fmt.Errorf("could not determine output format: %w", err)
+	}
+	if *preview != "" && *preview != "term" {
+		return fmt.Errorf("%q is not a supported preview mode", *preview)
+	}
+	if *preview != "" && *outputFilename == "-" {
+		return fmt.Errorf("cannot preview in the terminal while writing to stdout")
+	}
+	protocol, err := terminalProtocol()
+	if err != nil {
+		return err
+	}
+	showPreview := func(img image.Image) {
+		if *preview == "" {
+			return
+		}
+		if err := render.EncodeTerminal(os.Stdout, img, protocol); err != nil {
+			fmt.Printf("could not preview image: %s\n", err)
+		}
+	}
+
+	encOpts := []render.EncodeOption{
+		render.WithQuality(*quality),
+		render.WithFrameRate(*fps),
+	}
+
+	if *grid > 0 && format == render.APNG {
+		return fmt.Errorf("cannot tile frames into a grid when writing an animated format")
+	}
+
+	start, end := *startFrame, *endFrame
+	if end == 0 {
+		end = *frames
+	}
+	if *checkpointFilename != "" {
+		if format == render.APNG || *grid > 0 {
+			return fmt.Errorf("cannot checkpoint frames that are written to one file")
+		}
+		if resume == nil {
+			runOptions, err := marshalOptions(options, effectiveRunOptions(effectiveWidth, effectiveHeight, srcHash, format))
+			if err != nil {
+				return fmt.Errorf("could not encode options: %w", err)
+			}
+			resume = newCheckpoint(node, runOptions)
+		} else if next := resume.next(start); next >= end {
+			fmt.Printf("frames %d to %d in checkpoint %q have already been rendered\n", start, end-1, *checkpointFilename)
+			return nil
+		} else if next > start {
+			fmt.Printf("resuming from frame %d\n", next)
+			start = next
 		}
+	}
+	if start != 0 || end != *frames {
+		renOpts = append(renOpts, render.WithFrameRange(start, end))
+	}
 
-		fmt.Printf("rendering frame %d to %s... ", no, filename)
-		defer fmt.Println("Done!")
+	if *stream && (format != render.PNG || end-start > 1) {
+		return fmt.Errorf("can only stream a single frame to PNG")
+	}
+	if *thumbSize > 0 && (*stream || *outputFilename == "-") {
+		return fmt.Errorf("cannot write thumbnails when streaming or writing to stdout")
+	}
 
-		out, err := os.Create(filename)
+	if *manifestFilename != "" {
+		runOptions, err := marshalOptions(options, effectiveRunOptions(effectiveWidth, effectiveHeight, srcHash, format))
 		if err != nil {
-			return fmt.Errorf("could not open output file %q for frame %d: %w", filename, no, err)
+			return fmt.Errorf("could not encode options: %w", err)
 		}
-		defer out.Close()
+		mf = newManifest(node, state, runOptions, effectiveWidth, effectiveHeight)
+	}
+	if mf != nil || *errorColor != "" {
+		renOpts = append(renOpts, render.WithStatsCollector(func(stats render.Stats) {
+			if mf != nil {
+				mf.setStats(start, stats)
+			}
+			reportPixelErrors(stats)
+		}))
+	}
 
-		if err = png.Encode(out, img); err != nil {
-			return fmt.Errorf("could not write PNG for frame %d: %w", no, err)
+	animations := make(map[string][]image.Image)
+	if format == render.APNG || *grid > 0 {
+		renOpts = append(renOpts, render.WithRetainFrames())
+	}
+	writeFrame := func(no int, outputs map[string]image.Image) error {
+		for _, name := range slices.Sorted(maps.Keys(outputs)) {
+			img := outputs[name]
+			if format == render.APNG || *grid > 0 {
+				fmt.Printf("rendered frame %d of output %q\n", no, name)
+				animations[name] = append(animations[name], img)
+				if *grid == 0 {
+					showPreview(img)
+				}
+				continue
+			}
+
+			filename := outputFilenameFor(name, no)
+			fmt.Printf("rendering frame %d to %s... ", no, filename)
+			if err := writeImage(filename, img, format, encOpts...); err != nil {
+				return fmt.Errorf("could not write frame %d: %w", no, err)
+			}
+			mf.add(filename, no)
+			if err := writeThumbnail(filename, []image.Image{img}, format, encOpts...); err != nil {
+				return fmt.Errorf("could not write thumbnail of frame %d: %w", no, err)
+			}
+			fmt.Println("Done!")
+			showPreview(img)
+		}
+		if resume != nil {
+			if err := resume.write(*checkpointFilename, no); err != nil {
+				return fmt.Errorf("could not write checkpoint: %w", err)
+			}
 		}
 		return nil
-	}, renOpts...)
+	}
+	if *stream {
+		err = streamImage(ctx, outputFilenameFor("", start), node, renOpts...)
+		if err == nil {
+			mf.add(outputFilenameFor("", start), start)
+		}
+	} else {
+		err = render.RenderOutputsCallback(ctx, node, writeFrame, renOpts...)
+	}
 	if err != nil {
-		fmt.Printf("could not render image: %s\n", err)
-		return
+		if !*flushOnCancel || !errors.Is(err, context.Canceled) {
+			return fmt.Errorf("could not render image: %w", err)
+		}
+		fmt.Println("render was interrupted, writing the frames that were rendered")
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(animations)) {
+		filename := outputFilenameFor(name, -1)
+		fmt.Printf("writing %d frames to %s... ", len(animations[name]), filename)
+		if *grid > 0 {
+			img := render.Grid(animations[name], *grid)
+			if err = writeImage(filename, img, format, encOpts...); err == nil {
+				err = writeThumbnail(filename, []image.Image{img}, format, encOpts...)
+			}
+			showPreview(img)
+		} else if err = writeAnimation(filename, animations[name], encOpts...); err == nil {
+			err = writeThumbnail(filename, animations[name], format, encOpts...)
+		}
+		if err != nil {
+			return fmt.Errorf("could not write frames: %w", err)
+		}
+		mf.add(filename, -1)
+		fmt.Println("Done!")
+	}
+
+	if mf != nil {
+		if err = mf.write(*manifestFilename); err != nil {
+			return fmt.Errorf("could not write manifest to %q: %w", *manifestFilename, err)
+		}
 	}
 
 	if *optionsOutputFilename != "" {
 		optionsOutputFile, err := os.Create(*optionsOutputFilename)
 		if err != nil {
-			fmt.Printf("could not open output options file %q: %s\n", *optionsOutputFilename, err)
-			return
+			return fmt.Errorf("could not open output options file %q: %w", *optionsOutputFilename, err)
 		}
 		defer optionsOutputFile.Close()
 
-		_, err = optionsOutputFile.WriteString(options)
+		runOptions, err := marshalOptions(options, effectiveRunOptions(effectiveWidth, effectiveHeight, srcHash, format))
 		if err != nil {
-			fmt.Printf("could not write generator options to file: %s\n", err)
-			return
+			return fmt.Errorf("could not encode options: %w", err)
+		}
+		_, err = optionsOutputFile.WriteString(runOptions)
+		if err != nil {
+			return fmt.Errorf("could not write generator options to file: %w", err)
+		}
+	}
+	return nil
+}
+
+// flagSet returns whether the flag was given on the command line, rather than
+// defaulted or set by a config file.
+func flagSet(name string) bool {
+	set := false
+	commandFlags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set && !configured[name]
+}
+
+// outputFilenameFor returns the filename for the given named output and
+// frame. A negative frame number means all frames are written to one file.
+// The frame number replaces {frame} in the output filename if it is there.
+// Every image is written to stdout one after the other with -output -.
+func outputFilenameFor(name string, no int) string {
+	if *outputFilename == "-" {
+		return "-"
+	}
+	var frame string
+	if *frames > 1 && no >= 0 {
+		frame = fmt.Sprintf("%03d", no)
+	}
+	filename := *outputFilename
+	ext := path.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+	if name != "" {
+		base += "-" + name
+	}
+	if strings.Contains(base, "{frame}") {
+		base = strings.ReplaceAll(base, "{frame}", frame)
+	} else if frame != "" {
+		base += "-" + frame
+	}
+	return base + ext
+}
+
+// createOutput creates the output file, or the object that a URL refers to,
+// see render.ParseSink, or stdout if it is -. It has only been written once
+// it is closed.
+func createOutput(filename string) (io.WriteCloser, error) {
+	if filename == "-" {
+		return render.WriterSink(stdout).Create(context.Background(), filename)
+	}
+	sink, name, err := render.ParseSink(filename)
+	if err != nil {
+		return nil, err
+	}
+	return sink.Create(context.Background(), name)
+}
+
+func terminalProtocol() (render.TerminalProtocol, error) {
+	if *previewProtocol == "auto" {
+		return render.DetectTerminalProtocol(), nil
+	}
+	return render.ParseTerminalProtocol(*previewProtocol)
+}
+
+func writeImage(filename string, img image.Image, format render.Format, opts ...render.EncodeOption) error {
+	out, err := createOutput(filename)
+	if err != nil {
+		return fmt.Errorf("could not open output file %q: %w", filename, err)
+	}
+
+	if err = render.Encode(out, img, format, opts...); err != nil {
+		out.Close()
+		return fmt.Errorf("could not write %s: %w", format, err)
+	}
+	if err = out.Close(); err != nil {
+		return fmt.Errorf("could not write %q: %w", filename, err)
+	}
+	return nil
+}
+
+func streamImage(ctx context.Context, filename string, node nodes.Node, opts ...render.RenderOption) error {
+	out, err := createOutput(filename)
+	if err != nil {
+		return fmt.Errorf("could not open output file %q: %w", filename, err)
+	}
+
+	fmt.Printf("streaming frame to %s... ", filename)
+	w := bufio.NewWriter(out)
+	if err = render.RenderPNG(ctx, node, w, opts...); err != nil {
+		out.Close()
+		fmt.Println()
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		out.Close()
+		return fmt.Errorf("could not write PNG: %w", err)
+	}
+	if err = out.Close(); err != nil {
+		return fmt.Errorf("could not write %q: %w", filename, err)
+	}
+	fmt.Println("Done!")
+	return nil
+}
+
+// writeThumbnail writes the image, or animation if there are multiple, scaled
+// down to -thumb to the filename with -thumb added, if -thumb is given.
+func writeThumbnail(filename string, imgs []image.Image, format render.Format, opts ...render.EncodeOption) error {
+	if *thumbSize <= 0 {
+		return nil
+	}
+	ext := path.Ext(filename)
+	filename = strings.TrimSuffix(filename, ext) + "-thumb" + ext
+	thumbs := make([]image.Image, len(imgs))
+	for i, img := range imgs {
+		w, h := fit(img.Bounds().Dx(), img.Bounds().Dy(), *thumbSize)
+		thumbs[i] = thumbnail(img, w, h)
+	}
+	if format == render.APNG {
+		return writeAnimation(filename, thumbs, opts...)
+	}
+	return writeImage(filename, thumbs[0], format, opts...)
+}
+
+func writeAnimation(filename string, frames []image.Image, opts ...render.EncodeOption) error {
+	out, err := createOutput(filename)
+	if err != nil {
+		return fmt.Errorf("could not open output file %q: %w", filename, err)
+	}
+
+	if err = render.EncodeAPNG(out, frames, opts...); err != nil {
+		out.Close()
+		return fmt.Errorf("could not write APNG: %w", err)
+	}
+	if err = out.Close(); err != nil {
+		return fmt.Errorf("could not write %q: %w", filename, err)
+	}
+	return nil
+}
+
+func runWorker(ctx context.Context) error {
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return fmt.Errorf("could not listen on %q: %w", *listen, err)
+	}
+	fmt.Printf("Listening for frames on %s\n", l.Addr())
+	if *pprofAddr != "" {
+		defer servePprof(*pprofAddr)()
+	}
+	if *metrics != "" {
+		defer serveMetrics(*metrics, render.MetricsHandler())()
+	}
+	return render.Serve(ctx, l)
+}
+
+// serveMetrics serves the metrics of the handler on addr at /metrics, and
+// those published with expvar at /debug/vars, until the returned function is
+// called.
+func serveMetrics(addr string, metrics http.Handler) func() {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	mux.Handle("/debug/vars", expvar.Handler())
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("could not serve metrics on %q: %s\n", addr, err)
 		}
+	}()
+	fmt.Printf("Serving metrics on %s\n", addr)
+	return func() {
+		server.Close()
+	}
+}
+
+// estimateCost estimates how long rendering the root with the render flags
+// takes, see render.EstimateCost.
+func estimateCost(root nodes.Node) time.Duration {
+	frames := cmp.Or(*endFrame, *frames) - *startFrame
+	return render.EstimateCost(root, *width, *height, frames) * time.Duration(max(*samples, 1)*max(*motionBlur, 1))
+}
+
+// maxReportedPixelErrors is how many of the errors of pixels given the
+// -error-color are printed.
+const maxReportedPixelErrors = 10
+
+// reportPixelErrors prints the errors of the first pixels that couldn't be
+// evaluated, if any.
+func reportPixelErrors(stats render.Stats) {
+	if stats.FailedPixels == 0 {
+		return
+	}
+	fmt.Printf("%d pixels could not be evaluated and were given the error colour:\n", stats.FailedPixels)
+	for _, err := range stats.PixelErrors[:min(len(stats.PixelErrors), maxReportedPixelErrors)] {
+		fmt.Printf("  %s\n", err)
+	}
+	if more := stats.FailedPixels - maxReportedPixelErrors; more > 0 {
+		fmt.Printf("  and %d more\n", more)
+	}
+}
+
+// runGRPCServer serves the Randomart gRPC service, generating from the grammar
+// given with -grammar when requests don't give their own.
+func runGRPCServer(ctx context.Context) error {
+	grammar, err := loadGrammar(*grammarFilename)
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return fmt.Errorf("could not listen on %q: %w", *listen, err)
+	}
+	if *pprofAddr != "" {
+		defer servePprof(*pprofAddr)()
+	}
+	var opts []grpc.ServerOption
+	if *metrics != "" {
+		defer serveMetrics(*metrics, rpc.MetricsHandler())()
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(rpc.UnaryMetricsInterceptor),
+			grpc.ChainStreamInterceptor(rpc.StreamMetricsInterceptor),
+		)
+	}
+	server := grpc.NewServer(opts...)
+	randomart := rpc.NewServer(grammar)
+	randomart.PixelTimeout = *pixelTimeout
+	if randomart.LiveParams, err = startLiveParams(ctx); err != nil {
+		return err
+	}
+	rpc.RegisterRandomartServer(server, randomart)
+	stop := context.AfterFunc(ctx, server.GracefulStop)
+	defer stop()
+	fmt.Printf("Serving gRPC on %s\n", l.Addr())
+	return server.Serve(l)
+}
+
+// readOptionsFile reads the options file given with -ioptions, or returns nil
+// if there isn't one.
+func readOptionsFile() ([]byte, error) {
+	if *optionsInputFilename == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(*optionsInputFilename)
+	if err != nil {
+		return nil, fmt.Errorf("could not read input options file %q: %w", *optionsInputFilename, err)
+	}
+	return data, nil
+}
+
+// generatorOptions returns the options given by the generator flags, which
+// take precedence over those in the options file if there is one.
+func generatorOptions(optionsFile []byte) ([]nodes.GeneratorOption, error) {
+	var genOpts []nodes.GeneratorOption
+	if optionsFile != nil {
+		genOpts = append(genOpts, nodes.FromJSON(bytes.NewReader(optionsFile)))
+	}
+	if flagSet("seed-string") {
+		genOpts = append(genOpts, nodes.WithSeedString(*seedString))
+	}
+	if flagSet("min-entropy") {
+		genOpts = append(genOpts, nodes.WithQualityFilter(*minEntropy))
+	}
+	if flagSet("min-depth") {
+		genOpts = append(genOpts, nodes.WithMinDepth(*minDepth))
+	}
+	if flagSet("max-nodes") {
+		genOpts = append(genOpts, nodes.WithMaxNodes(*maxNodes))
+	}
+	if flagSet("channel-rules") {
+		rules := strings.Split(*channelRules, ",")
+		if len(rules) != 3 {
+			return nil, fmt.Errorf("-channel-rules must name 3 productions, not %d", len(rules))
+		}
+		genOpts = append(genOpts, nodes.WithChannelRules(rules[0], rules[1], rules[2]))
+	}
+	if *productionStreams {
+		genOpts = append(genOpts, nodes.WithProductionStreams())
+	}
+	if flagSet("require-components") {
+		var components []string
+		if *requireComponents != "" {
+			components = strings.Split(*requireComponents, ",")
+		}
+		genOpts = append(genOpts, nodes.WithRequireComponents(components...))
+	}
+	return genOpts, nil
+}
+
+// checkCompatible warns if the options file may not generate the same
+// expression as when it was written, or fails with -require-compatible.
+func checkCompatible(optionsFile []byte, grammar *nodes.Grammar, restored *runOptions) error {
+	err := nodes.CheckCompatible(optionsFile, grammar)
+	if err == nil {
+		return nil
+	}
+	if restored != nil && restored.Version != "" && restored.Version != version() {
+		err = fmt.Errorf("%w, and by randomart %s rather than %s", err, restored.Version, version())
+	}
+	if *requireCompatible {
+		return err
+	}
+	fmt.Printf("warning: %s\n", err)
+	return nil
+}
+
+// version returns the version of randomart that is running.
+func version() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		return info.Main.Version
+	}
+	return "(unknown)"
+}
+
+// generate generates an expression from the grammar, keeping the best of
+// -candidates if more than one.
+func generate(ctx context.Context, grammar *nodes.Grammar, genOpts []nodes.GeneratorOption) (nodes.Node, *nodes.GeneratorState, error) {
+	var (
+		node  nodes.Node
+		state *nodes.GeneratorState
+		err   error
+	)
+	if *candidates > 1 {
+		node, state, err = grammar.GenBest(ctx, *candidates, func(root nodes.Node, _ image.Image) float64 {
+			entropy, _ := nodes.Entropy(root)
+			return entropy
+		}, genOpts...)
+	} else {
+		node, state, err = grammar.GenContext(ctx, genOpts...)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not generate random AST: %w", err)
+	}
+	return node, state, nil
+}
+
+// exportExpression writes the expression to the files given with -ast-dot,
+// -js and -oast.
+func exportExpression(node nodes.Node) error {
+	if *astOutputFilename != "" {
+		data, err := nodes.MarshalNode(node)
+		if err != nil {
+			return fmt.Errorf("could not encode AST: %w", err)
+		}
+		if err = os.WriteFile(*astOutputFilename, data, 0o644); err != nil {
+			return fmt.Errorf("could not write AST to %q: %w", *astOutputFilename, err)
+		}
+	}
+	if *astDotFilename != "" {
+		if err := os.WriteFile(*astDotFilename, []byte(nodes.ToDOT(node)), 0o644); err != nil {
+			return fmt.Errorf("could not write AST graph to %q: %w", *astDotFilename, err)
+		}
+	}
+	if *jsFilename != "" {
+		js, err := nodes.ToJS(node)
+		if err != nil {
+			return fmt.Errorf("could not export expression to JavaScript: %w", err)
+		}
+		if err = os.WriteFile(*jsFilename, []byte(js), 0o644); err != nil {
+			return fmt.Errorf("could not write JavaScript to %q: %w", *jsFilename, err)
+		}
+	}
+	return nil
+}
+
+// openInput opens the input file, or stdin if it is -, returning the name to
+// report errors in it with.
+func openInput(filename string) (io.ReadCloser, string, error) {
+	if filename == "-" {
+		return io.NopCloser(os.Stdin), "stdin", nil
+	}
+	f, err := os.Open(filename)
+	return f, filename, err
+}
+
+func loadExpression(filename string) (nodes.Node, error) {
+	f, name, err := openInput(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not open expression file %q: %w", filename, err)
+	}
+	defer f.Close()
+
+	node, err := nodes.ParseExpression(f, name)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse expression: %w", err)
+	}
+	return node, nil
+}
+
+func loadAST(filename string) (nodes.Node, error) {
+	f, _, err := openInput(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not open AST file %q: %w", filename, err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not read AST file %q: %w", filename, err)
+	}
+	node, err := nodes.UnmarshalNode(data)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode AST: %w", err)
+	}
+	return node, nil
+}
+
+func loadGrammar(filename string) (*nodes.Grammar, error) {
+	grammarFile, name, err := openInput(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not open grammar file %q: %w", filename, err)
+	}
+	defer grammarFile.Close()
+
+	var grammar *nodes.Grammar
+	if *grammarCache != "" {
+		grammar, err = nodes.ParseCached(grammarFile, name, *grammarCache)
+	} else {
+		grammar, err = nodes.Parse(grammarFile, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse grammar: %w", err)
 	}
+	return grammar, nil
 }
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"randomart/nodes"
+	"randomart/render"
+	"sync"
+)
+
+// manifest records every image written by a run along with what is needed to
+// reproduce it, for -manifest.
+type manifest struct {
+	mu        sync.Mutex
+	Artifacts []artifact `json:"artifacts"`
+
+	seed    *uint64
+	options json.RawMessage
+	astHash string
+	width   int
+	height  int
+	start   int
+	stats   *render.Stats
+}
+
+type artifact struct {
+	Filename string          `json:"filename"`
+	Frame    int             `json:"frame"`
+	Seed     *uint64         `json:"seed,omitempty"`
+	Options  json.RawMessage `json:"options"`
+	ASTHash  string          `json:"ast_sha256"`
+	Width    int             `json:"width"`
+	Height   int             `json:"height"`
+	// RenderSeconds is how long the frame took to render, or the whole render
+	// for images of every frame.
+	RenderSeconds float64 `json:"render_seconds,omitempty"`
+}
+
+func newManifest(node nodes.Node, state *nodes.GeneratorState, options string, width, height int) *manifest {
+	hash := sha256.Sum256([]byte(node.String()))
+	m := &manifest{
+		options: json.RawMessage(options),
+		astHash: hex.EncodeToString(hash[:]),
+		width:   width,
+		height:  height,
+	}
+	if state != nil {
+		m.seed = &state.Seed
+	}
+	return m
+}
+
+// add records that the frame was written to filename. A negative frame means
+// that every frame was written to it.
+func (m *manifest) add(filename string, frame int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Artifacts = append(m.Artifacts, artifact{
+		Filename: filename,
+		Frame:    frame,
+		Seed:     m.seed,
+		Options:  m.options,
+		ASTHash:  m.astHash,
+		Width:    m.width,
+		Height:   m.height,
+	})
+}
+
+// setStats records how long the render took, the first frame of the stats
+// being the given frame.
+func (m *manifest) setStats(start int, stats render.Stats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.start, m.stats = start, &stats
+}
+
+// write writes the manifest to filename, with how long each artifact took to
+// render if the render finished.
+func (m *manifest) write(filename string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, a := range m.Artifacts {
+		switch f := a.Frame - m.start; {
+		case m.stats == nil:
+		case a.Frame < 0:
+			m.Artifacts[i].RenderSeconds = m.stats.Duration.Seconds()
+		case f < len(m.stats.FrameDurations):
+			m.Artifacts[i].RenderSeconds = m.stats.FrameDurations[f].Seconds()
+		}
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,92 @@
+package nodes
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// grammarCacheVersion is incremented whenever the types of the grammar change
+// so that grammars cached before can no longer be decoded the same way.
+const grammarCacheVersion = 1
+
+func init() {
+	// The alternates are registered so that gob can decode them from the
+	// Alternate interface.
+	for _, a := range []Alternate{
+		Outputs{}, Triplet{}, IfThenElse{}, Let{}, Element{}, Swizzle{}, Warp{}, Cellular{},
+		Number{}, Bool{}, Component{}, Rule{}, Random{}, Func{}, Call{}, CustomComponent{}, Param{},
+	} {
+		gob.Register(a)
+	}
+}
+
+// cachedGrammar is a parsed grammar as it is written to the cache.
+type cachedGrammar struct {
+	Grammar *Grammar
+	SHA256  string
+}
+
+// ParseCached parses a grammar like Parse, but caches the parsed grammar in the
+// directory, keyed by the hash of its source, so that parsing the same source
+// again only decodes it. The cache is also keyed by the operators and
+// components registered, which change how grammars are parsed. The directory is
+// created if it doesn't exist, and the grammar is parsed as usual if the cache
+// can't be read or written.
+func ParseCached(r io.Reader, filename, dir string) (*Grammar, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\x00%s\x00%s\x00%s\x00", grammarCacheVersion, filename, strings.Join(operatorNames(), ","), strings.Join(componentNames(), ","))
+	h.Write(src)
+	path := filepath.Join(dir, hex.EncodeToString(h.Sum(nil))+".gob")
+
+	if data, err := os.ReadFile(path); err == nil {
+		var cached cachedGrammar
+		if err = gob.NewDecoder(bytes.NewReader(data)).Decode(&cached); err == nil && cached.Grammar != nil {
+			cached.Grammar.hash = cached.SHA256
+			return cached.Grammar, nil
+		}
+	}
+
+	g, err := Parse(bytes.NewReader(src), filename)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err = gob.NewEncoder(&buf).Encode(cachedGrammar{Grammar: g, SHA256: g.SHA256()}); err == nil {
+		writeCache(path, buf.Bytes())
+	}
+	return g, nil
+}
+
+// writeCache writes the data to the path through a temporary file, so that
+// concurrent readers never see it half written. Errors are ignored as the
+// grammar is parsed again if it isn't cached.
+func writeCache(path string, data []byte) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".grammar-*")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
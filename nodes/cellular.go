@@ -0,0 +1,101 @@
+package nodes
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+)
+
+// cellPoints is the number of points in the set that cellular nodes divide the
+// plane into cells around.
+const cellPoints = 16
+
+type cellularType string
+
+const (
+	// voronoiCellular is the distance to the nearest point.
+	voronoiCellular cellularType = "voronoi"
+	// cellCellular is a random value that is the same within each cell.
+	cellCellular cellularType = "cell"
+)
+
+// cellular divides the plane into the cells around a set of random points,
+// derived from the seed, that repeats every 2 units so that the cells tile
+// beyond [-1, 1]. The seed is printed as a third argument so that the points
+// can be derived again by ParseExpression.
+type cellular struct {
+	pos
+	t      cellularType
+	seed   uint64
+	a      Node
+	b      Node
+	points [cellPoints][3]float64
+}
+
+func newCellular(at pos, t cellularType, seed uint64, a, b Node) *cellular {
+	c := &cellular{pos: at, t: t, seed: seed, a: a, b: b}
+	rng := rand.New(rand.NewPCG(seed, seed+1))
+	for i := range c.points {
+		c.points[i] = [3]float64{rng.Float64()*2 - 1, rng.Float64()*2 - 1, rng.Float64()*2 - 1}
+	}
+	return c
+}
+
+func (c *cellular) String() string {
+	return fmt.Sprintf("%s(%s, %s, %d)", c.t, c.a, c.b, c.seed)
+}
+
+// at returns the value of the node at the point (a, b).
+func (c *cellular) at(a, b float64) float64 {
+	nearest, distance := 0, math.Inf(1)
+	for i, p := range c.points {
+		dx := math.Abs(math.Mod(a-p[0], 2))
+		dy := math.Abs(math.Mod(b-p[1], 2))
+		dx, dy = min(dx, 2-dx), min(dy, 2-dy)
+		if d := dx*dx + dy*dy; d < distance {
+			nearest, distance = i, d
+		}
+	}
+	if c.t == cellCellular {
+		return c.points[nearest][2]
+	}
+	// The points are about 2/sqrt(cellPoints) apart, so few positions are
+	// further than that from the nearest.
+	return min(math.Sqrt(distance)*math.Sqrt(cellPoints)/2, 1)*2 - 1
+}
+
+func (c *cellular) Eval(state State) (Node, error) {
+	v, err := c.EvalNum(state)
+	if err != nil {
+		return nil, err
+	}
+	return &value[float64]{pos: c.pos, v: v}, nil
+}
+
+func (c *cellular) EvalNum(state State) (float64, error) {
+	a, err := evalNumber(c.a, state)
+	if err != nil {
+		return 0, err
+	}
+	b, err := evalNumber(c.b, state)
+	if err != nil {
+		return 0, err
+	}
+	return c.at(a, b), nil
+}
+
+func (c *cellular) evalRow(a *Arena, states []State) (*row, error) {
+	as, err := evalNumberRow(a, c.a, states)
+	if err != nil {
+		return nil, err
+	}
+	bs, err := evalNumberRow(a, c.b, states)
+	if err != nil {
+		return nil, err
+	}
+	r := a.newRow(numberRow, len(states))
+	for i := range r.nums[0] {
+		r.nums[0][i] = c.at(as[i], bs[i])
+	}
+	return r, nil
+}
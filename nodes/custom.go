@@ -0,0 +1,183 @@
+package nodes
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+type customOp struct {
+	name  string
+	arity int
+	fn    func(args ...float64) float64
+}
+
+type customComponent struct {
+	name string
+	fn   func(s State) float64
+}
+
+var (
+	registryMu       sync.RWMutex
+	customOps        = make(map[string]*customOp)
+	customComponents = make(map[string]*customComponent)
+	customName       = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+	reserved         = []string{"true", "false", "if", "then", "else", "let", "in", "first", "second", "third", "fourth", "swizzle", "warp", "voronoi", "cell"}
+)
+
+// RegisterOp adds an operator that grammars can call by name with arity
+// numbers, such as noise(x, y) for an operator named noise with an arity of 2.
+// fn must always return the same result for the same arguments as constant
+// calls are only evaluated once, and must be safe to call concurrently.
+// Operators must be registered before the grammars that call them are parsed
+// and on every worker that renders expressions calling them. RegisterOp panics
+// if the name is not a lowercase identifier, is already taken or the arity is
+// not positive.
+func RegisterOp(name string, arity int, fn func(args ...float64) float64) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	checkCustomName("operator", name)
+	if arity <= 0 {
+		panic(fmt.Sprintf("operator %s must take at least one argument", name))
+	}
+	customOps[name] = &customOp{name: name, arity: arity, fn: fn}
+	parser = nil
+}
+
+// RegisterComponent adds a component that grammars can use by name like x or
+// y, whose value at a state is given by fn. Components can use the state's
+// Data to expose values that aren't part of the state, such as the amplitude
+// of audio or the position of the mouse, but must cope with it being nil. The
+// same rules as RegisterOp apply to the name and when components must be
+// registered.
+func RegisterComponent(name string, fn func(s State) float64) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	checkCustomName("component", name)
+	customComponents[name] = &customComponent{name: name, fn: fn}
+	parser = nil
+}
+
+// checkCustomName panics if the name can't be used by a registered operator
+// or component.
+func checkCustomName(kind, name string) {
+	if !customName.MatchString(name) {
+		panic(fmt.Sprintf("%s name %q is not a lowercase identifier", kind, name))
+	}
+	_, isOp := customOps[name]
+	_, isComponent := customComponents[name]
+	if isOp || isComponent || slices.Contains(opTypes(), opType(name)) ||
+		componentType(name).Valid() || slices.Contains(reserved, name) {
+		panic(fmt.Sprintf("%s name %q is already taken", kind, name))
+	}
+}
+
+func lookupComponent(name string) (*customComponent, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	c, ok := customComponents[name]
+	return c, ok
+}
+
+func lookupOp(name string) (*customOp, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	op, ok := customOps[name]
+	return op, ok
+}
+
+// customPattern matches any of the given names, longest first so that no name
+// is matched by one of its prefixes. If there are no names it matches nothing.
+func customPattern[T any](registry map[string]T) string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, regexp.QuoteMeta(name))
+	}
+	if len(names) == 0 {
+		return `[^\s\S]`
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		return cmp.Or(len(b)-len(a), strings.Compare(a, b))
+	})
+	return `(?:` + strings.Join(names, "|") + `)\b`
+}
+
+type call struct {
+	pos
+	op   *customOp
+	args []Node
+}
+
+func (c *call) String() string {
+	args := make([]string, len(c.args))
+	for i, a := range c.args {
+		args[i] = a.String()
+	}
+	return fmt.Sprintf("%s(%s)", c.op.name, strings.Join(args, ", "))
+}
+
+func (c *call) Eval(state State) (Node, error) {
+	v, err := c.EvalNum(state)
+	if err != nil {
+		return nil, err
+	}
+	return &value[float64]{pos: c.pos, v: v}, nil
+}
+
+func (c *call) EvalNum(state State) (float64, error) {
+	args := make([]float64, len(c.args))
+	for i, a := range c.args {
+		var err error
+		if args[i], err = evalNumber(a, state); err != nil {
+			return 0, err
+		}
+	}
+	return c.op.fn(args...), nil
+}
+
+func (c *call) evalRow(a *Arena, states []State) (*row, error) {
+	args := make([][]float64, len(c.args))
+	for i, arg := range c.args {
+		var err error
+		if args[i], err = evalNumberRow(a, arg, states); err != nil {
+			return nil, err
+		}
+	}
+	r := a.newRow(numberRow, len(states))
+	buf := a.floats.alloc(len(args))
+	for i := range r.nums[0] {
+		for j, arg := range args {
+			buf[j] = arg[i]
+		}
+		r.nums[0][i] = c.op.fn(buf...)
+	}
+	return r, nil
+}
+
+type custom struct {
+	pos
+	c *customComponent
+}
+
+func (c *custom) String() string {
+	return c.c.name
+}
+
+func (c *custom) Eval(state State) (Node, error) {
+	return &value[float64]{pos: c.pos, v: c.c.fn(state)}, nil
+}
+
+func (c *custom) EvalNum(state State) (float64, error) {
+	return c.c.fn(state), nil
+}
+
+func (c *custom) evalRow(a *Arena, states []State) (*row, error) {
+	r := a.newRow(numberRow, len(states))
+	for i := range states {
+		r.nums[0][i] = c.c.fn(states[i])
+	}
+	return r, nil
+}
@@ -0,0 +1,80 @@
+package nodes
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// dedupeKey identifies a node by its type, its own values and the identity of
+// its already deduplicated children.
+func dedupeKey(n Node, cs []Node) (string, bool) {
+	var b strings.Builder
+	switch n := n.(type) {
+	case *value[float64]:
+		_, _ = fmt.Fprintf(&b, "number %x", math.Float64bits(n.v))
+	case *value[bool]:
+		_, _ = fmt.Fprintf(&b, "bool %t", n.v)
+	case *component:
+		_, _ = fmt.Fprintf(&b, "component %s", n.ct)
+	case *custom:
+		_, _ = fmt.Fprintf(&b, "custom %s", n.c.name)
+	case *param:
+		_, _ = fmt.Fprintf(&b, "param %s", n.name)
+	case *op:
+		_, _ = fmt.Fprintf(&b, "op %s", n.t)
+	case *triple:
+		b.WriteString("triple")
+	case *quad:
+		b.WriteString("quad")
+	case *named:
+		_, _ = fmt.Fprintf(&b, "named %q", n.names)
+	case *ifThenElse:
+		b.WriteString("if")
+	case *call:
+		_, _ = fmt.Fprintf(&b, "call %s", n.op.name)
+	case *swizzle:
+		_, _ = fmt.Fprintf(&b, "swizzle %s", n.elements)
+	case *warp:
+		b.WriteString("warp")
+	case *cellular:
+		_, _ = fmt.Fprintf(&b, "%s %d", n.t, n.seed)
+	default:
+		return "", false
+	}
+	for _, c := range cs {
+		_, _ = fmt.Fprintf(&b, " %p", c)
+	}
+	return b.String(), true
+}
+
+func dedupe(n Node, seen map[string]Node) Node {
+	cs := children(n)
+	deduped := make([]Node, len(cs))
+	changed := false
+	for i, c := range cs {
+		deduped[i] = dedupe(c, seen)
+		changed = changed || deduped[i] != c
+	}
+	if changed {
+		n = withChildren(n, deduped)
+	}
+
+	key, ok := dedupeKey(n, deduped)
+	if !ok {
+		return n
+	}
+	if existing, ok := seen[key]; ok {
+		return existing
+	}
+	seen[key] = n
+	return n
+}
+
+// Dedupe eliminates common subexpressions by returning a copy of the root in
+// which identical subtrees are the same node, so that they are only evaluated
+// once per row by EvalRow. Errors in a deduplicated subtree are reported at
+// the position of its first occurrence.
+func Dedupe(root Node) Node {
+	return dedupe(root, make(map[string]Node))
+}
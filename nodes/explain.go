@@ -0,0 +1,189 @@
+package nodes
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	// explainSize is the width and height of the grid of states that
+	// Explain evaluates each node at.
+	explainSize = 16
+	// explainFrames is the number of frames that Explain evaluates each
+	// node at, the first, middle and last.
+	explainFrames = 3
+)
+
+// Explanation is a node of an expression annotated with what it evaluated to
+// at the states that Explain sampled.
+type Explanation struct {
+	Node Node
+	// Type is the type of the values that the node evaluates to, such as
+	// number, boolean or triple.
+	Type string
+	// Min and Max are the range of each element of the values, booleans are
+	// 0 or 1. They are empty if the values have no elements that are
+	// numbers, such as named outputs.
+	Min, Max []float64
+	// Cost is the mean number of nodes evaluated to evaluate the node.
+	Cost float64
+	// Err is the first error that evaluating the node returned, the other
+	// fields are only of the states that it evaluated at without one.
+	Err      error
+	Children []*Explanation
+}
+
+// Explain evaluates every node of the root at a 16x16 grid of states over the
+// first, middle and last frames, recording the type and range of the values
+// that it evaluates to and how many nodes evaluating it costs. Nodes are
+// evaluated at the unwarped states even if warped by their parents, and the
+// branches of if/then/else at every state even if not taken.
+func Explain(root Node) *Explanation {
+	states := make([]State, 0, explainSize*explainSize*explainFrames)
+	for frame := range explainFrames {
+		for y := range explainSize {
+			for x := range explainSize {
+				states = append(states, S(x, y, explainSize, explainSize, frame, explainFrames, color.White))
+			}
+		}
+	}
+	return explain(root, states)
+}
+
+func explain(n Node, states []State) *Explanation {
+	e := &Explanation{Node: n}
+	var (
+		cost      int
+		evaluated int
+	)
+	for _, state := range states {
+		v, err := n.Eval(state)
+		if err == nil {
+			var c int
+			if c, err = Cost(n, state); err == nil {
+				err = e.add(v)
+				cost += c
+			}
+		}
+		if err != nil {
+			if e.Err == nil {
+				e.Err = err
+			}
+			continue
+		}
+		evaluated++
+	}
+	if evaluated > 0 {
+		e.Cost = float64(cost) / float64(evaluated)
+	}
+	for _, c := range children(n) {
+		e.Children = append(e.Children, explain(c, states))
+	}
+	return e
+}
+
+// add widens the ranges of the explanation to include the value.
+func (e *Explanation) add(v Node) error {
+	var (
+		t        string
+		elements []float64
+	)
+	switch v := v.(type) {
+	case *value[float64]:
+		t, elements = string(number), []float64{v.v}
+	case *value[bool]:
+		t = string(boolean)
+		elements = []float64{0}
+		if v.v {
+			elements[0] = 1
+		}
+	case *triple:
+		r, g, b, err := IsRoot(v)
+		if err != nil {
+			return err
+		}
+		t, elements = "triple", []float64{r, g, b}
+	case *quad:
+		r, g, b, a, err := IsRGBA(v)
+		if err != nil {
+			return err
+		}
+		t, elements = "quad", []float64{r, g, b, a}
+	case *named:
+		t = "named"
+	default:
+		t = fmt.Sprintf("%T", v)
+	}
+
+	if e.Type == "" {
+		e.Type = t
+		e.Min = append([]float64(nil), elements...)
+		e.Max = append([]float64(nil), elements...)
+		return nil
+	}
+	if e.Type != t || len(e.Min) != len(elements) {
+		return fmt.Errorf("%s evaluates to both %s and %s", e.Node, e.Type, t)
+	}
+	for i, el := range elements {
+		e.Min[i] = math.Min(e.Min[i], el)
+		e.Max[i] = math.Max(e.Max[i], el)
+	}
+	return nil
+}
+
+// String returns the explanation as an indented tree with a line for each
+// node, giving its type, range and cost.
+func (e *Explanation) String() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	e.write(w, 0)
+	_ = w.Flush()
+	return b.String()
+}
+
+func (e *Explanation) write(w *tabwriter.Writer, depth int) {
+	var ranges []string
+	for i := range e.Min {
+		if e.Min[i] == e.Max[i] {
+			ranges = append(ranges, fmt.Sprintf("%.3g", e.Min[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("[%.3g, %.3g]", e.Min[i], e.Max[i]))
+		}
+	}
+	line := fmt.Sprintf("%s%s\t%s\t%s\tcost %.1f", strings.Repeat("  ", depth), label(e.Node), e.Type, strings.Join(ranges, " "), e.Cost)
+	if e.Err != nil {
+		line += "\terror: " + e.Err.Error()
+	}
+	fmt.Fprintln(w, line)
+	for _, c := range e.Children {
+		c.write(w, depth+1)
+	}
+}
+
+// label returns what a node is without its children, such as its operator.
+func label(n Node) string {
+	switch n := n.(type) {
+	case *op:
+		return string(n.t)
+	case *triple:
+		return "triple"
+	case *quad:
+		return "quad"
+	case *named:
+		return "named " + strings.Join(n.names, ", ")
+	case *ifThenElse:
+		return "if"
+	case *call:
+		return n.op.name
+	case *swizzle:
+		return "swizzle ." + n.elements
+	case *warp:
+		return "warp"
+	case *cellular:
+		return string(n.t)
+	}
+	return n.String()
+}
@@ -0,0 +1,393 @@
+package nodes
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// dialect is how expressions are written in a language that nodes can be
+// exported to.
+type dialect struct {
+	number func(v float64) string
+	mod    func(left, right string) string
+	// choose returns an expression of the given type, either "float64" or
+	// "bool", that evaluates to then if cond is true and otherwise if not.
+	choose func(t, cond, then, otherwise string) string
+	// warp returns an expression of the given type that evaluates expr with
+	// x and y offset by dx and dy.
+	warp func(t, expr, dx, dy string) string
+}
+
+var goDialect = dialect{
+	number: func(v float64) string {
+		switch {
+		case math.IsNaN(v):
+			return "math.NaN()"
+		case math.IsInf(v, 0):
+			return fmt.Sprintf("math.Inf(%d)", int(math.Copysign(1, v)))
+		case v < 0:
+			return "(" + strconv.FormatFloat(v, 'g', -1, 64) + ")"
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	},
+	mod: func(left, right string) string {
+		return fmt.Sprintf("math.Mod(%s, %s)", left, right)
+	},
+	choose: func(t, cond, then, otherwise string) string {
+		return fmt.Sprintf("func() %s { if %s { return %s }; return %s }()", t, cond, then, otherwise)
+	},
+	warp: func(t, expr, dx, dy string) string {
+		return fmt.Sprintf("func(x, y float64) %s { return %s }(x + %s, y + %s)", t, expr, dx, dy)
+	},
+}
+
+var jsDialect = dialect{
+	number: func(v float64) string {
+		switch {
+		case math.IsNaN(v):
+			return "NaN"
+		case math.IsInf(v, 0):
+			return fmt.Sprintf("(%d * Infinity)", int(math.Copysign(1, v)))
+		case v < 0:
+			return "(" + strconv.FormatFloat(v, 'g', -1, 64) + ")"
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	},
+	mod: func(left, right string) string {
+		return fmt.Sprintf("(%s %% %s)", left, right)
+	},
+	choose: func(t, cond, then, otherwise string) string {
+		return fmt.Sprintf("(%s ? %s : %s)", cond, then, otherwise)
+	},
+	warp: func(t, expr, dx, dy string) string {
+		return fmt.Sprintf("((x, y) => %s)(x + %s, y + %s)", expr, dx, dy)
+	},
+}
+
+// expr returns the expression for a number or boolean node and whether it is
+// a boolean.
+func (d dialect) expr(n Node) (string, bool, error) {
+	switch n := n.(type) {
+	case *value[float64]:
+		return d.number(n.v), false, nil
+	case *value[bool]:
+		return strconv.FormatBool(n.v), true, nil
+	case *component:
+		return string(n.ct), false, nil
+	case *op:
+		left, leftBool, err := d.expr(n.left)
+		if err != nil {
+			return "", false, err
+		}
+		right, rightBool, err := d.expr(n.right)
+		if err != nil {
+			return "", false, err
+		}
+		if leftBool || rightBool {
+			return "", false, fmt.Errorf("%s at %s:%d has boolean operands", n, n.File(), n.Line())
+		}
+		switch n.t {
+		case add:
+			return fmt.Sprintf("(%s + %s)", left, right), false, nil
+		case sub:
+			return fmt.Sprintf("(%s - %s)", left, right), false, nil
+		case mul:
+			return fmt.Sprintf("(%s * %s)", left, right), false, nil
+		case div:
+			return fmt.Sprintf("(%s / %s)", left, right), false, nil
+		case mod:
+			return d.mod(left, right), false, nil
+		case gt:
+			return fmt.Sprintf("(%s > %s)", left, right), true, nil
+		case ge:
+			return fmt.Sprintf("(%s >= %s)", left, right), true, nil
+		case lt:
+			return fmt.Sprintf("(%s < %s)", left, right), true, nil
+		case le:
+			return fmt.Sprintf("(%s <= %s)", left, right), true, nil
+		}
+		return "", false, fmt.Errorf("%q operator is not handled", n.t)
+	case *ifThenElse:
+		cond, condBool, err := d.expr(n.cond)
+		if err != nil {
+			return "", false, err
+		}
+		then, thenBool, err := d.expr(n.then)
+		if err != nil {
+			return "", false, err
+		}
+		otherwise, otherwiseBool, err := d.expr(n.otherwise)
+		if err != nil {
+			return "", false, err
+		}
+		if !condBool || thenBool != otherwiseBool {
+			return "", false, fmt.Errorf("%s at %s:%d cannot be typed", n, n.File(), n.Line())
+		}
+		t := "float64"
+		if thenBool {
+			t = "bool"
+		}
+		return d.choose(t, cond, then, otherwise), thenBool, nil
+	case *call:
+		return "", false, fmt.Errorf("%s at %s:%d calls %s which was added with RegisterOp so cannot be exported", n, n.File(), n.Line(), n.op.name)
+	case *custom:
+		return "", false, fmt.Errorf("%s at %s:%d was added with RegisterComponent so cannot be exported", n, n.File(), n.Line())
+	case *param:
+		return "", false, fmt.Errorf("parameter %s at %s:%d must be bound before exporting", n, n.File(), n.Line())
+	case *cellular:
+		return "", false, fmt.Errorf("%s at %s:%d cannot be exported as its points are only known when rendering", n, n.File(), n.Line())
+	case *warp:
+		expr, isBool, err := d.expr(n.t)
+		if err != nil {
+			return "", false, err
+		}
+		offsets, err := d.numbers(n.dx, n.dy)
+		if err != nil {
+			return "", false, err
+		}
+		t := "float64"
+		if isBool {
+			t = "bool"
+		}
+		return d.warp(t, expr, offsets[0], offsets[1]), isBool, nil
+	case *swizzle:
+		// Only elements of triples and quadruples that are written out can
+		// be picked, as exported expressions are numbers.
+		elements := vectorElements(n.t)
+		if e := strings.IndexByte(elementNames, n.elements[0]); len(n.elements) == 1 && e < len(elements) {
+			return d.expr(elements[e])
+		}
+		return "", false, fmt.Errorf("%s at %s:%d cannot be exported as a number", n, n.File(), n.Line())
+	}
+	return "", false, fmt.Errorf("%s at %s:%d cannot be exported as a number", n, n.File(), n.Line())
+}
+
+func (d dialect) numbers(values ...Node) ([]string, error) {
+	exprs := make([]string, len(values))
+	for i, v := range values {
+		expr, isBool, err := d.expr(v)
+		if err != nil {
+			return nil, err
+		}
+		if isBool {
+			return nil, fmt.Errorf("%s at %s:%d is not a number", v, v.File(), v.Line())
+		}
+		exprs[i] = expr
+	}
+	return exprs, nil
+}
+
+func (d dialect) cond(n Node) (string, error) {
+	cond, isBool, err := d.expr(n)
+	if err != nil {
+		return "", err
+	}
+	if !isBool {
+		return "", fmt.Errorf("%s at %s:%d is not a boolean", n, n.File(), n.Line())
+	}
+	return cond, nil
+}
+
+// goRoot writes the statements that return the elements of the triple or
+// quadruple that n evaluates to, of which there must be size.
+func goRoot(b *strings.Builder, n Node, indent string, size int) error {
+	switch n := n.(type) {
+	case *triple, *quad:
+		elements := vectorElements(n)
+		if len(elements) != size {
+			return fmt.Errorf("%s at %s:%d has %d elements but the rest of the root has %d", n, n.File(), n.Line(), len(elements), size)
+		}
+		values, err := goDialect.numbers(elements...)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(b, "%sreturn %s\n", indent, strings.Join(values, ", "))
+		return nil
+	case *ifThenElse:
+		cond, err := goDialect.cond(n.cond)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(b, "%sif %s {\n", indent, cond)
+		if err = goRoot(b, n.then, indent+"\t", size); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(b, "%s}\n", indent)
+		return goRoot(b, n.otherwise, indent, size)
+	}
+	return fmt.Errorf("%s at %s:%d is not a triple or quadruple", n, n.File(), n.Line())
+}
+
+// ToGo returns the root as a Go function literal that computes the colour of
+// a pixel from its components, which are all in the range [-1, 1]. The only
+// dependency of the function is the math package, when mod, NaN or infinities
+// are used. Roots that evaluate to triples return the red, green and blue of
+// the colour and those that evaluate to quadruples its alpha too. Other roots,
+// such as those with outputs, can't be exported.
+func ToGo(root Node) (string, error) {
+	// Constant subexpressions are folded up front as Go would otherwise
+	// evaluate them with arbitrary precision rather than as float64s.
+	root, _ = hoist(root, nil)
+	// Every branch of the root must have as many elements as the first.
+	first := root
+	for n, ok := first.(*ifThenElse); ok; n, ok = first.(*ifThenElse) {
+		first = n.then
+	}
+	size := max(len(vectorElements(first)), 3)
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "func(x, y, f, r, g, b float64) (%s) {\n", strings.TrimSuffix(strings.Repeat("float64, ", size), ", "))
+	if err := goRoot(&b, root, "\t", size); err != nil {
+		return "", err
+	}
+	b.WriteString("}\n")
+	return b.String(), nil
+}
+
+func jsRoot(n Node) (string, error) {
+	switch n := n.(type) {
+	case *triple:
+		values, err := jsDialect.numbers(n.one, n.two, n.three)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("[%s, 1]", strings.Join(values, ", ")), nil
+	case *quad:
+		values, err := jsDialect.numbers(n.one, n.two, n.three, n.four)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("[%s]", strings.Join(values, ", ")), nil
+	case *ifThenElse:
+		cond, err := jsDialect.cond(n.cond)
+		if err != nil {
+			return "", err
+		}
+		then, err := jsRoot(n.then)
+		if err != nil {
+			return "", err
+		}
+		otherwise, err := jsRoot(n.otherwise)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("(%s ? %s : %s)", cond, then, otherwise), nil
+	}
+	return "", fmt.Errorf("%s at %s:%d is not a triple or quadruple", n, n.File(), n.Line())
+}
+
+const jsDraw = `
+function randomartCoordinate(v, size) {
+    return size > 1 ? v / (size - 1) * 2 - 1 : 0;
+}
+
+function drawRandomart(canvas, frame = 0, frames = 1) {
+    const ctx = canvas.getContext("2d");
+    const img = ctx.createImageData(canvas.width, canvas.height);
+    const f = randomartCoordinate(frame, frames);
+    for (let py = 0; py < canvas.height; py++) {
+        const y = randomartCoordinate(py, canvas.height);
+        for (let px = 0; px < canvas.width; px++) {
+            const x = randomartCoordinate(px, canvas.width);
+            const c = randomart(x, y, f, 1, 1, 1);
+            const i = (py * canvas.width + px) * 4;
+            for (let j = 0; j < 4; j++) {
+                img.data[i + j] = (c[j] + 1) / 2 * 255;
+            }
+        }
+    }
+    ctx.putImageData(img, 0, 0);
+}
+`
+
+// ToJS returns the root as a JavaScript function, randomart(x, y, f, r, g, b),
+// that computes the RGBA colour of a pixel from its components, which are all
+// in the range [-1, 1]. It is followed by drawRandomart(canvas, frame, frames)
+// which draws a frame of the expression onto a canvas.
+func ToJS(root Node) (string, error) {
+	root, _ = hoist(root, nil)
+	expr, err := jsRoot(root)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("function randomart(x, y, f, r, g, b) {\n    return %s;\n}\n%s", expr, jsDraw), nil
+}
+
+func dotLabel(n Node) string {
+	switch n := n.(type) {
+	case *value[float64], *value[bool], *component, *custom, *param:
+		return n.String()
+	case *op:
+		return string(n.t)
+	case *triple:
+		return "triple"
+	case *quad:
+		return "quad"
+	case *named:
+		return "outputs"
+	case *ifThenElse:
+		return "if"
+	case *call:
+		return n.op.name
+	case *warp:
+		return "warp"
+	case *cellular:
+		return string(n.t)
+	case *swizzle:
+		if len(n.elements) == 1 {
+			return elementFuncs[strings.IndexByte(elementNames, n.elements[0])]
+		}
+		return fmt.Sprintf("swizzle %s", n.elements)
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%T", n), "*")
+}
+
+func dotEdgeLabels(n Node) []string {
+	switch n := n.(type) {
+	case *named:
+		return n.names
+	case *ifThenElse:
+		return []string{"cond", "then", "else"}
+	case *warp:
+		return []string{"", "dx", "dy"}
+	}
+	return nil
+}
+
+// ToDOT returns the expression as a Graphviz graph in which each node is
+// labelled with what it is and the position it was generated from. Subtrees
+// shared by Dedupe are only drawn once.
+func ToDOT(root Node) string {
+	var b strings.Builder
+	b.WriteString("digraph randomart {\n")
+	b.WriteString("\tordering=out;\n")
+	b.WriteString("\tnode [shape=box, fontname=\"monospace\"];\n")
+
+	ids := make(map[Node]int)
+	var visit func(n Node) int
+	visit = func(n Node) int {
+		if id, ok := ids[n]; ok {
+			return id
+		}
+		id := len(ids)
+		ids[n] = id
+		label := fmt.Sprintf("%s\n%s:%d", dotLabel(n), filepath.Base(n.File()), n.Line())
+		_, _ = fmt.Fprintf(&b, "\tn%d [label=%s];\n", id, strconv.Quote(label))
+
+		edgeLabels := dotEdgeLabels(n)
+		for i, c := range children(n) {
+			cid := visit(c)
+			if edgeLabels != nil {
+				_, _ = fmt.Fprintf(&b, "\tn%d -> n%d [label=%s];\n", id, cid, strconv.Quote(edgeLabels[i]))
+			} else {
+				_, _ = fmt.Fprintf(&b, "\tn%d -> n%d;\n", id, cid)
+			}
+		}
+		return id
+	}
+	visit(root)
+	b.WriteString("}\n")
+	return b.String()
+}
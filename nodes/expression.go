@@ -0,0 +1,222 @@
+package nodes
+
+import (
+	"fmt"
+	"github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+	"io"
+	"slices"
+	"strconv"
+)
+
+// expression is an expression as printed by the String method of nodes. Names
+// are only told apart once parsed, so that components and operators don't
+// need to be kept out of each other's way by the lexer.
+type expression struct {
+	Pos    lexer.Position
+	If     *ifExpression `  @@`
+	Tuple  []*expression `| "(" @@ ( "," @@ )* ")"`
+	Named  []*namedValue `| "{" @@ ( "," @@ )* "}"`
+	Number *string       `| @Number`
+	Param  *string       `| @Param`
+	String *string       `| @String`
+	Apply  *application  `| @@`
+	Name   *string       `| @Name`
+}
+
+type ifExpression struct {
+	Cond *expression `"if" @@`
+	Then *expression `"then" @@`
+	Else *expression `"else" @@`
+}
+
+type namedValue struct {
+	Name  string      `@Name ":"`
+	Value *expression `@@`
+}
+
+type application struct {
+	Name string        `@Name "("`
+	Args []*expression `@@ ( "," @@ )* ")"`
+}
+
+var expressionParser = participle.MustBuild[expression](
+	participle.Lexer(lexer.MustSimple([]lexer.SimpleRule{
+		{"Number", `[-+]?(Inf|NaN|(\d*\.)?\d+([eE][-+]?\d+)?)`},
+		{"Param", `\$[a-z_][a-z0-9_]*`},
+		{"String", `"[^"]*"`},
+		{"Name", `[a-z_][a-z0-9_]*`},
+		{"Punct", `[(){},:]`},
+		{"Whitespace", `\s+`},
+	})),
+	participle.Elide("Whitespace"),
+	participle.UseLookahead(2),
+)
+
+// ParseExpression parses an expression in the format printed by the String
+// method of nodes, so that printed expressions can be stored, edited by hand
+// and rendered again. Subtrees shared by let or Dedupe are no longer shared
+// once printed.
+func ParseExpression(r io.Reader, filename string) (Node, error) {
+	e, err := expressionParser.Parse(filename, r)
+	if err != nil {
+		return nil, err
+	}
+	return e.node()
+}
+
+func (e *expression) node() (Node, error) {
+	at := pToP(e.Pos)
+	switch {
+	case e.If != nil:
+		cond, err := e.If.Cond.node()
+		if err != nil {
+			return nil, err
+		}
+		then, err := e.If.Then.node()
+		if err != nil {
+			return nil, err
+		}
+		otherwise, err := e.If.Else.node()
+		if err != nil {
+			return nil, err
+		}
+		return &ifThenElse{pos: at, cond: cond, then: then, otherwise: otherwise}, nil
+	case e.Tuple != nil:
+		values, err := expressionNodes(e.Tuple)
+		if err != nil {
+			return nil, err
+		}
+		switch len(values) {
+		case 3:
+			return &triple{pos: at, one: values[0], two: values[1], three: values[2]}, nil
+		case 4:
+			return &quad{pos: at, one: values[0], two: values[1], three: values[2], four: values[3]}, nil
+		}
+		return nil, fmt.Errorf("%s: tuple of %d values is neither a triple nor a quadruple", e.Pos, len(values))
+	case e.Named != nil:
+		n := &named{pos: at, names: make([]string, len(e.Named)), values: make([]Node, len(e.Named))}
+		for i, v := range e.Named {
+			if slices.Contains(n.names[:i], v.Name) {
+				return nil, fmt.Errorf("%s: output %s has been defined multiple times", e.Pos, v.Name)
+			}
+			var err error
+			if n.values[i], err = v.Value.node(); err != nil {
+				return nil, err
+			}
+			n.names[i] = v.Name
+		}
+		return n, nil
+	case e.Number != nil:
+		v, err := strconv.ParseFloat(*e.Number, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Pos, err)
+		}
+		return &value[float64]{pos: at, v: v}, nil
+	case e.Param != nil:
+		return &param{pos: at, name: (*e.Param)[1:]}, nil
+	case e.String != nil:
+		return nil, fmt.Errorf("%s: strings can only be the elements of a swizzle", e.Pos)
+	case e.Apply != nil:
+		return e.Apply.node(at, e.Pos)
+	}
+
+	switch name := *e.Name; {
+	case name == "true" || name == "false":
+		return &value[bool]{pos: at, v: name == "true"}, nil
+	case componentType(name).Valid():
+		return &component{pos: at, ct: componentType(name)}, nil
+	default:
+		c, ok := lookupComponent(name)
+		if !ok {
+			return nil, fmt.Errorf("%s: %s is not a component", e.Pos, name)
+		}
+		return &custom{pos: at, c: c}, nil
+	}
+}
+
+func expressionNodes(es []*expression) ([]Node, error) {
+	ns := make([]Node, len(es))
+	for i, e := range es {
+		var err error
+		if ns[i], err = e.node(); err != nil {
+			return nil, err
+		}
+	}
+	return ns, nil
+}
+
+func (a *application) node(at pos, p lexer.Position) (Node, error) {
+	arity := func(n int) error {
+		if len(a.Args) != n {
+			return fmt.Errorf("%s: %s takes %d arguments, not %d", p, a.Name, n, len(a.Args))
+		}
+		return nil
+	}
+	if a.Name == "swizzle" {
+		if err := arity(2); err != nil {
+			return nil, err
+		}
+		if a.Args[1].String == nil {
+			return nil, fmt.Errorf("%s: the elements of a swizzle must be a string", p)
+		}
+		elements, err := strconv.Unquote(*a.Args[1].String)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		if err = checkElements(elements); err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		t, err := a.Args[0].node()
+		if err != nil {
+			return nil, err
+		}
+		return &swizzle{pos: at, t: t, elements: elements}, nil
+	}
+
+	args, err := expressionNodes(a.Args)
+	if err != nil {
+		return nil, err
+	}
+	switch name := a.Name; {
+	case slices.Contains(opTypes(), opType(name)):
+		if err = arity(2); err != nil {
+			return nil, err
+		}
+		return &op{pos: at, t: opType(name), left: args[0], right: args[1]}, nil
+	case slices.Contains(elementFuncs, name):
+		if err = arity(1); err != nil {
+			return nil, err
+		}
+		e := elementNames[slices.Index(elementFuncs, name)]
+		return &swizzle{pos: at, t: args[0], elements: string(e)}, nil
+	case name == "warp":
+		if err = arity(3); err != nil {
+			return nil, err
+		}
+		return &warp{pos: at, t: args[0], dx: args[1], dy: args[2]}, nil
+	case name == string(voronoiCellular) || name == string(cellCellular):
+		if err = arity(3); err != nil {
+			return nil, err
+		}
+		// Seeds are parsed from the text as they can be too large to be
+		// numbers without losing precision.
+		var seed uint64
+		if a.Args[2].Number != nil {
+			seed, err = strconv.ParseUint(*a.Args[2].Number, 10, 64)
+		}
+		if a.Args[2].Number == nil || err != nil {
+			return nil, fmt.Errorf("%s: the seed of %s must be a whole number", p, name)
+		}
+		return newCellular(at, cellularType(name), seed, args[0], args[1]), nil
+	}
+
+	op, ok := lookupOp(a.Name)
+	if !ok {
+		return nil, fmt.Errorf("%s: %s is not an operator", p, a.Name)
+	}
+	if err = arity(op.arity); err != nil {
+		return nil, err
+	}
+	return &call{pos: at, op: op, args: args}, nil
+}
@@ -0,0 +1,180 @@
+package nodes
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+)
+
+// RandomGrammar returns the source of a grammar with a few productions of
+// random alternates, using every kind of alternate of the syntax. The grammar
+// may not be valid, as its productions may reference ones that don't exist,
+// be weighted more than 1 or not terminate, so that the errors of parsing and
+// generating are exercised as well.
+func RandomGrammar(r *rand.Rand) string {
+	names := make([]string, 1+r.IntN(4))
+	for i := range names {
+		names[i] = string(rune('A' + i))
+	}
+	params := make(map[string][]string)
+	for _, name := range names[1:] {
+		if r.IntN(4) == 0 {
+			params[name] = []string{"P", "Q"}[:1+r.IntN(2)]
+		}
+	}
+
+	var b strings.Builder
+	for _, name := range names {
+		g := randomGrammar{r: r, names: names, params: params, scope: params[name]}
+		b.WriteString(name)
+		if len(g.scope) > 0 {
+			fmt.Fprintf(&b, "(%s)", strings.Join(g.scope, ", "))
+		}
+		b.WriteString(" ::= ")
+		alternatives := 1 + r.IntN(4)
+		// Weights usually add up to at most 1, but not always.
+		excess := r.IntN(20) == 0
+		for i := range alternatives {
+			if i > 0 {
+				b.WriteString(" | ")
+			}
+			g.alternate(&b, 0)
+			weight := 1 / float64(alternatives)
+			if excess {
+				weight = r.Float64() * 2
+			}
+			fmt.Fprintf(&b, " %%%s", strconv.FormatFloat(weight, 'f', 3, 64))
+		}
+		b.WriteString(" .\n")
+	}
+	return b.String()
+}
+
+type randomGrammar struct {
+	r      *rand.Rand
+	names  []string
+	params map[string][]string
+	// scope is the parameters of the production being written.
+	scope []string
+	// lets is how many lets the alternate being written is the body of.
+	lets int
+}
+
+func (g *randomGrammar) alternate(b *strings.Builder, depth int) {
+	// Alternates without children become more likely the deeper they are,
+	// so that the grammar is a manageable size.
+	if depth > 3 || g.r.IntN(3) <= depth/2 {
+		g.leaf(b)
+		return
+	}
+	args := func(n int) {
+		for i := range n {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			g.alternate(b, depth+1)
+		}
+	}
+	switch g.r.IntN(11) {
+	case 0, 1:
+		fmt.Fprintf(b, "%s(", opTypes()[g.r.IntN(len(opTypes()))])
+		args(2)
+		b.WriteString(")")
+	case 2:
+		b.WriteString("{")
+		args(3 + g.r.IntN(2))
+		b.WriteString("}")
+	case 3:
+		b.WriteString("{")
+		for i := range 1 + g.r.IntN(3) {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(b, "out%d: ", i)
+			g.alternate(b, depth+1)
+		}
+		b.WriteString("}")
+	case 4:
+		b.WriteString("if ")
+		g.alternate(b, depth+1)
+		b.WriteString(" then ")
+		g.alternate(b, depth+1)
+		b.WriteString(" else ")
+		g.alternate(b, depth+1)
+	case 5:
+		b.WriteString("let V = ")
+		g.alternate(b, depth+1)
+		b.WriteString(" in ")
+		g.lets++
+		g.alternate(b, depth+1)
+		g.lets--
+	case 6:
+		fmt.Fprintf(b, "%s(", []string{"first", "second", "third", "fourth"}[g.r.IntN(4)])
+		args(1)
+		b.WriteString(")")
+	case 7:
+		b.WriteString("swizzle(")
+		args(1)
+		elements := make([]byte, []int{1, 3, 4}[g.r.IntN(3)])
+		for i := range elements {
+			elements[i] = "xyzw"[g.r.IntN(4)]
+		}
+		fmt.Fprintf(b, ", %q)", elements)
+	case 8:
+		b.WriteString("warp(")
+		args(3)
+		b.WriteString(")")
+	case 9:
+		fmt.Fprintf(b, "%s(", []string{"voronoi", "cell"}[g.r.IntN(2)])
+		args(2)
+		b.WriteString(")")
+	default:
+		// A production with arguments, whose number may not match its
+		// parameters.
+		name := g.names[g.r.IntN(len(g.names))]
+		n := len(g.params[name])
+		if g.r.IntN(4) == 0 {
+			n++
+		}
+		b.WriteString(name)
+		if n > 0 {
+			b.WriteString("(")
+			args(n)
+			b.WriteString(")")
+		}
+	}
+}
+
+func (g *randomGrammar) leaf(b *strings.Builder) {
+	switch g.r.IntN(8) {
+	case 0:
+		b.WriteString(strconv.FormatFloat(g.r.Float64()*4-2, 'f', 2, 64))
+	case 1:
+		b.WriteString([]string{"true", "false"}[g.r.IntN(2)])
+	case 2:
+		b.WriteString("?")
+	case 3:
+		fmt.Fprintf(b, "$p%d", g.r.IntN(2))
+	case 4:
+		if g.lets > 0 && g.r.IntN(2) == 0 {
+			b.WriteString("V")
+			return
+		}
+		// A production that may not exist, or may need arguments.
+		name := string(rune('A' + g.r.IntN(len(g.names)+1)))
+		if len(g.params[name]) == 0 || g.r.IntN(4) == 0 {
+			b.WriteString(name)
+			return
+		}
+		fallthrough
+	case 5:
+		if len(g.scope) > 0 && g.r.IntN(2) == 0 {
+			b.WriteString(g.scope[g.r.IntN(len(g.scope))])
+			return
+		}
+		fallthrough
+	default:
+		b.WriteString(string(componentTypes()[g.r.IntN(len(componentTypes()))]))
+	}
+}
@@ -0,0 +1,62 @@
+package nodes
+
+import (
+	"image/color"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"testing"
+)
+
+// addGrammars adds the repository's grammar and random grammars to the seed
+// corpus.
+func addGrammars(f *testing.F, args ...any) {
+	if data, err := os.ReadFile("../grammar.bnf"); err == nil {
+		f.Add(append([]any{string(data)}, args...)...)
+	}
+	for i := range 16 {
+		f.Add(append([]any{RandomGrammar(rand.New(rand.NewPCG(uint64(i), 0)))}, args...)...)
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	addGrammars(f)
+	f.Fuzz(func(t *testing.T, src string) {
+		g, err := Parse(strings.NewReader(src), "fuzz")
+		if err != nil {
+			return
+		}
+		// Printed grammars must parse to the same grammar.
+		printed := g.String()
+		reparsed, err := Parse(strings.NewReader(printed), "printed")
+		if err != nil {
+			t.Fatalf("could not parse printed grammar %q: %s", printed, err)
+		}
+		if reparsed.String() != printed {
+			t.Fatalf("printed grammar %q parsed to %q", printed, reparsed)
+		}
+	})
+}
+
+func FuzzGen(f *testing.F) {
+	addGrammars(f, uint64(1))
+	f.Fuzz(func(t *testing.T, src string, seed uint64) {
+		g, err := Parse(strings.NewReader(src), "fuzz")
+		if err != nil {
+			return
+		}
+		// Few tries at a shallow depth, as generating from grammars that
+		// rarely terminate takes exponentially long in the depth.
+		root, _, err := g.Gen(WithSeeds(seed), WithMaxDepth(5), WithMaxGenerationTries(3))
+		if err != nil {
+			return
+		}
+		for frame := range 2 {
+			for y := range 4 {
+				for x := range 4 {
+					_, _ = root.Eval(S(x, y, 4, 4, frame, 2, color.White))
+				}
+			}
+		}
+	})
+}
@@ -1,12 +1,21 @@
 package nodes
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"github.com/alecthomas/participle/v2"
 	"github.com/alecthomas/participle/v2/lexer"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"hash/fnv"
 	"io"
+	"maps"
 	"math/rand/v2"
 	"slices"
 	"strconv"
@@ -20,6 +29,25 @@ var (
 	ErrRuleDoesNotExist          = fmt.Errorf("rule does not exist")
 )
 
+// GenError is the error of generating an expression from a production of a
+// grammar, wrapping why it couldn't be, such as ErrReachedMaxGenerationTries.
+type GenError struct {
+	// Rule is the production that was being generated, defined at Pos.
+	Rule string
+	Pos  lexer.Position
+	// Seed is the seed that the expression was being generated from.
+	Seed uint64
+	Err  error
+}
+
+func (e *GenError) Error() string {
+	return fmt.Sprintf("generating %s (at %s) from seed %d: %s", e.Rule, e.Pos, e.Seed, e.Err)
+}
+
+func (e *GenError) Unwrap() error {
+	return e.Err
+}
+
 func pToP(p lexer.Position) pos {
 	return pos{p.Filename, p.Line}
 }
@@ -28,20 +56,48 @@ type production struct {
 	*Production
 	max    float64
 	totals []float64
+	// seed is the production's own stream of random numbers if the
+	// generator uses production streams.
+	seed *rand.Rand
+}
+
+type origin struct {
+	rule   string
+	depth  int
+	params []binding
+}
+
+// binding is what a name refers to within an alternate, either a node bound by
+// a let or an argument of a production with parameters. Arguments are
+// generated afresh, in the scope they were passed from, wherever they are used.
+type binding struct {
+	name  string
+	node  Node
+	arg   Alternate
+	scope []binding
 }
 
 type GeneratorState struct {
-	*generatorStateOptions
-	seed  *rand.Rand
-	rules map[string]*production
+	*GeneratorOptions
+	seed    *rand.Rand
+	entry   string
+	rules   map[string]*production
+	origins map[Node]origin
+	scope   []binding
 }
 
 func (s *GeneratorState) Options() string {
 	var b strings.Builder
-	_ = json.NewEncoder(&b).Encode(s.generatorStateOptions)
+	_ = json.NewEncoder(&b).Encode(s.GeneratorOptions)
 	return b.String()
 }
 
+// Opts returns a copy of the options used by the generator, which can be
+// modified and passed back to Grammar.Gen using FromOptions.
+func (s *GeneratorState) Opts() GeneratorOptions {
+	return *s.GeneratorOptions
+}
+
 type Generator interface {
 	fmt.Stringer
 	Gen(state *GeneratorState, depth int) (Node, error)
@@ -104,16 +160,59 @@ func (f Component) Gen(state *GeneratorState, depth int) (Node, error) {
 	return &component{pos: pToP(f.Pos), ct: f.Component}, nil
 }
 
+// Param is a parameter whose value is given at render time, see Bind.
+type Param struct {
+	Pos  lexer.Position
+	Name string `@Param`
+}
+
+func (f Param) alt() {}
+
+func (f Param) String() string {
+	return f.Name
+}
+
+func (f Param) Gen(state *GeneratorState, depth int) (Node, error) {
+	return &param{pos: pToP(f.Pos), name: strings.TrimPrefix(f.Name, "$")}, nil
+}
+
+// CustomComponent is a component added with RegisterComponent.
+type CustomComponent struct {
+	Pos  lexer.Position
+	Name string `@CustomComponent`
+}
+
+func (f CustomComponent) alt() {}
+
+func (f CustomComponent) String() string {
+	return f.Name
+}
+
+func (f CustomComponent) Gen(state *GeneratorState, depth int) (Node, error) {
+	c, ok := lookupComponent(f.Name)
+	if !ok {
+		return nil, fmt.Errorf("component %s used at %s is not registered", f.Name, f.Pos)
+	}
+	return &custom{pos: pToP(f.Pos), c: c}, nil
+}
+
+// Triplet is either a triple or, when the optional fourth alpha element is
+// given, a quadruple. Both are parsed by the same rule as participle cannot
+// backtrack far enough to tell them apart.
 type Triplet struct {
 	Pos   lexer.Position
 	One   Alternate `LCurly @@ Comma`
 	Two   Alternate `       @@ Comma`
-	Three Alternate `       @@ RCurly`
+	Three Alternate `       @@`
+	Four  Alternate `       ( Comma @@ )? RCurly`
 }
 
 func (f Triplet) alt() {}
 
 func (f Triplet) String() string {
+	if f.Four != nil {
+		return fmt.Sprintf("{%s, %s, %s, %s}", f.One, f.Two, f.Three, f.Four)
+	}
 	return fmt.Sprintf("{%s, %s, %s}", f.One, f.Two, f.Three)
 }
 
@@ -130,6 +229,19 @@ func (f Triplet) Gen(state *GeneratorState, depth int) (Node, error) {
 	if err != nil {
 		return nil, err
 	}
+	if f.Four != nil {
+		four, err := f.Four.Gen(state, depth)
+		if err != nil {
+			return nil, err
+		}
+		return &quad{
+			pos:   pToP(f.Pos),
+			one:   one,
+			two:   two,
+			three: three,
+			four:  four,
+		}, nil
+	}
 	return &triple{
 		pos:   pToP(f.Pos),
 		one:   one,
@@ -138,23 +250,117 @@ func (f Triplet) Gen(state *GeneratorState, depth int) (Node, error) {
 	}, nil
 }
 
+type Label string
+
+func (l *Label) Capture(values []string) error {
+	*l = Label(strings.TrimSuffix(values[0], ":"))
+	return nil
+}
+
+type Output struct {
+	Pos       lexer.Position
+	Name      Label     `@Label`
+	Alternate Alternate `@@`
+}
+
+func (o *Output) String() string {
+	return fmt.Sprintf("%s: %s", o.Name, o.Alternate)
+}
+
+type Outputs struct {
+	Pos     lexer.Position
+	Outputs []*Output `LCurly @@ ( Comma @@ )* RCurly`
+}
+
+func (f Outputs) alt() {}
+
+func (f Outputs) String() string {
+	var outs []string
+	for _, o := range f.Outputs {
+		outs = append(outs, o.String())
+	}
+	return fmt.Sprintf("{%s}", strings.Join(outs, ", "))
+}
+
+func (f Outputs) Gen(state *GeneratorState, depth int) (Node, error) {
+	n := &named{
+		pos:    pToP(f.Pos),
+		names:  make([]string, len(f.Outputs)),
+		values: make([]Node, len(f.Outputs)),
+	}
+	for i, o := range f.Outputs {
+		if slices.Contains(n.names[:i], string(o.Name)) {
+			return nil, fmt.Errorf("output %s has been defined multiple times (at %s)", o.Name, o.Pos)
+		}
+		value, err := o.Alternate.Gen(state, depth)
+		if err != nil {
+			return nil, err
+		}
+		n.names[i] = string(o.Name)
+		n.values[i] = value
+	}
+	return n, nil
+}
+
+// Rule is a reference to a production, which is passed arguments if the
+// production has parameters, or to a name bound by a let or a parameter.
 type Rule struct {
 	Pos  lexer.Position
-	Name string `@Ident`
+	Name string      `@Ident`
+	Args []Alternate `( LParen @@ ( Comma @@ )* RParen )?`
 }
 
 func (f Rule) alt() {}
 
 func (f Rule) String() string {
-	return f.Name
+	if len(f.Args) == 0 {
+		return f.Name
+	}
+	args := make([]string, len(f.Args))
+	for i, a := range f.Args {
+		args[i] = a.String()
+	}
+	return fmt.Sprintf("%s(%s)", f.Name, strings.Join(args, ", "))
 }
 
 func (f Rule) Gen(state *GeneratorState, depth int) (Node, error) {
+	for i := len(state.scope) - 1; i >= 0; i-- {
+		b := state.scope[i]
+		if b.name != f.Name {
+			continue
+		}
+		if len(f.Args) > 0 {
+			return nil, fmt.Errorf("%s referenced at %s is not a production so cannot be passed arguments", f.Name, f.Pos)
+		}
+		if b.arg == nil {
+			return b.node, nil
+		}
+		scope := state.scope
+		state.scope = b.scope
+		defer func() {
+			state.scope = scope
+		}()
+		return b.arg.Gen(state, depth)
+	}
+
 	rule, ok := state.rules[f.Name]
 	if !ok {
 		return nil, errors.Wrapf(ErrRuleDoesNotExist, "%s referenced at %s", f.Name, f.Pos)
 	}
-	return rule.Gen(state, depth)
+	if len(f.Args) != len(rule.Params) {
+		return nil, fmt.Errorf("%s referenced at %s with %d arguments, expected %d", f.Name, f.Pos, len(f.Args), len(rule.Params))
+	}
+	var params []binding
+	if len(f.Args) > 0 {
+		// The scope is copied as it changes once this reference has been
+		// generated, but the arguments may be generated again by Mutate.
+		scope := slices.Clone(state.scope)
+		params = make([]binding, len(f.Args))
+		for i, a := range f.Args {
+			params[i] = binding{name: rule.Params[i], arg: a, scope: scope}
+		}
+	}
+	return rule.gen(state, depth, params)
 }
 
 type Random struct {
@@ -207,6 +413,205 @@ func (f Func) Gen(state *GeneratorState, depth int) (Node, error) {
 	}, nil
 }
 
+// Call is a call to an operator added with RegisterOp.
+type Call struct {
+	Pos  lexer.Position
+	Name string      `@Custom LParen`
+	Args []Alternate `@@ ( Comma @@ )* RParen`
+}
+
+func (f Call) alt() {}
+
+func (f Call) String() string {
+	args := make([]string, len(f.Args))
+	for i, a := range f.Args {
+		args[i] = a.String()
+	}
+	return fmt.Sprintf("%s(%s)", f.Name, strings.Join(args, ", "))
+}
+
+func (f Call) Gen(state *GeneratorState, depth int) (Node, error) {
+	op, ok := lookupOp(f.Name)
+	if !ok {
+		return nil, fmt.Errorf("operator %s called at %s is not registered", f.Name, f.Pos)
+	}
+	c := &call{pos: pToP(f.Pos), op: op, args: make([]Node, len(f.Args))}
+	for i, a := range f.Args {
+		var err error
+		if c.args[i], err = a.Gen(state, depth); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// checkAlternate checks that every call in the alternate passes as many
+// arguments as its operator takes and that every swizzle can be swizzled.
+func checkAlternate(a Alternate) error {
+	switch a := a.(type) {
+	case Call:
+		op, ok := lookupOp(a.Name)
+		if !ok {
+			return fmt.Errorf("operator %s called at %s is not registered", a.Name, a.Pos)
+		}
+		if len(a.Args) != op.arity {
+			return fmt.Errorf("operator %s called at %s with %d arguments, expected %d", a.Name, a.Pos, len(a.Args), op.arity)
+		}
+	case Swizzle:
+		if err := checkElements(string(a.Elements)); err != nil {
+			return fmt.Errorf("swizzle at %s: %w", a.Pos, err)
+		}
+	}
+	for _, child := range alternateChildren(a) {
+		if err := checkAlternate(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Let generates Value once and binds it to Name within Body, where Name refers
+// to the generated expression rather than the production of the same name.
+// Every use of the name is the same node, like the subtrees shared by Dedupe,
+// so symmetric designs can use one random subtree multiple times. Bindings are
+// only visible within the alternate that makes them, not within the
+// productions that it references.
+type Let struct {
+	Pos   lexer.Position
+	Name  string    `Let @Ident Equals`
+	Value Alternate `@@ In`
+	Body  Alternate `@@`
+}
+
+func (f Let) alt() {}
+
+func (f Let) String() string {
+	return fmt.Sprintf("let %s = %s in %s", f.Name, f.Value, f.Body)
+}
+
+func (f Let) Gen(state *GeneratorState, depth int) (Node, error) {
+	value, err := f.Value.Gen(state, depth)
+	if err != nil {
+		return nil, err
+	}
+	state.scope = append(state.scope, binding{name: f.Name, node: value})
+	defer func() {
+		state.scope = state.scope[:len(state.scope)-1]
+	}()
+	return f.Body.Gen(state, depth)
+}
+
+// Element picks a single element of a triple or quadruple, such as first(T).
+type Element struct {
+	Pos     lexer.Position
+	Element string    `@Element LParen`
+	Value   Alternate `@@ RParen`
+}
+
+func (f Element) alt() {}
+
+func (f Element) String() string {
+	return fmt.Sprintf("%s(%s)", f.Element, f.Value)
+}
+
+func (f Element) Gen(state *GeneratorState, depth int) (Node, error) {
+	value, err := f.Value.Gen(state, depth)
+	if err != nil {
+		return nil, err
+	}
+	e := elementNames[slices.Index(elementFuncs, f.Element)]
+	return &swizzle{pos: pToP(f.Pos), t: value, elements: string(e)}, nil
+}
+
+type Elements string
+
+func (e *Elements) Capture(values []string) error {
+	elements, err := strconv.Unquote(values[0])
+	*e = Elements(elements)
+	return err
+}
+
+// Swizzle picks elements of a triple or quadruple by name, such as
+// swizzle(T, "zyx") to reverse a triple.
+type Swizzle struct {
+	Pos      lexer.Position
+	Value    Alternate `Swizzle LParen @@ Comma`
+	Elements Elements  `@String RParen`
+}
+
+func (f Swizzle) alt() {}
+
+func (f Swizzle) String() string {
+	return fmt.Sprintf("swizzle(%s, %q)", f.Value, string(f.Elements))
+}
+
+func (f Swizzle) Gen(state *GeneratorState, depth int) (Node, error) {
+	value, err := f.Value.Gen(state, depth)
+	if err != nil {
+		return nil, err
+	}
+	return &swizzle{pos: pToP(f.Pos), t: value, elements: string(f.Elements)}, nil
+}
+
+// Warp evaluates Value with x and y offset by DX and DY.
+type Warp struct {
+	Pos   lexer.Position
+	Value Alternate `Warp LParen @@ Comma`
+	DX    Alternate `@@ Comma`
+	DY    Alternate `@@ RParen`
+}
+
+func (f Warp) alt() {}
+
+func (f Warp) String() string {
+	return fmt.Sprintf("warp(%s, %s, %s)", f.Value, f.DX, f.DY)
+}
+
+func (f Warp) Gen(state *GeneratorState, depth int) (Node, error) {
+	value, err := f.Value.Gen(state, depth)
+	if err != nil {
+		return nil, err
+	}
+	dx, err := f.DX.Gen(state, depth)
+	if err != nil {
+		return nil, err
+	}
+	dy, err := f.DY.Gen(state, depth)
+	if err != nil {
+		return nil, err
+	}
+	return &warp{pos: pToP(f.Pos), t: value, dx: dx, dy: dy}, nil
+}
+
+// Cellular divides the plane into cells around a set of random points drawn
+// when it is generated, such as voronoi(x, y) for the distance from (x, y) to
+// the nearest point or cell(x, y) for a random value for each cell.
+type Cellular struct {
+	Pos  lexer.Position
+	Type cellularType `@Cellular LParen`
+	A    Alternate    `@@ Comma`
+	B    Alternate    `@@ RParen`
+}
+
+func (f Cellular) alt() {}
+
+func (f Cellular) String() string {
+	return fmt.Sprintf("%s(%s, %s)", f.Type, f.A, f.B)
+}
+
+func (f Cellular) Gen(state *GeneratorState, depth int) (Node, error) {
+	seed := state.seed.Uint64()
+	a, err := f.A.Gen(state, depth)
+	if err != nil {
+		return nil, err
+	}
+	b, err := f.B.Gen(state, depth)
+	if err != nil {
+		return nil, err
+	}
+	return newCellular(pToP(f.Pos), f.Type, seed, a, b), nil
+}
+
 type IfThenElse struct {
 	Pos  lexer.Position
 	If   Alternate `If @@`
@@ -251,9 +656,13 @@ func (a *AlternateWithProb) String() string {
 	return fmt.Sprintf("%s %%%s", a.Alternate, strconv.FormatFloat(a.Probability, 'f', -1, 64))
 }
 
+// Production is a rule of the grammar. Productions with parameters, such as
+// Mix(P, Q), are passed an alternate for each parameter wherever they are
+// referenced, which is generated wherever the parameter is used.
 type Production struct {
 	Pos          lexer.Position
-	Name         string               `@Ident ProductionEquals`
+	Name         string               `@Ident`
+	Params       []string             `( LParen @Ident ( Comma @Ident )* RParen )? ProductionEquals`
 	Alternatives []*AlternateWithProb `@@ ( Pipe @@ )* Dot`
 }
 
@@ -262,10 +671,18 @@ func (p *Production) String() string {
 	for _, a := range p.Alternatives {
 		as = append(as, a.String())
 	}
-	return fmt.Sprintf("%s ::= %s .", p.Name, strings.Join(as, " | "))
+	name := p.Name
+	if len(p.Params) > 0 {
+		name = fmt.Sprintf("%s(%s)", p.Name, strings.Join(p.Params, ", "))
+	}
+	return fmt.Sprintf("%s ::= %s .", name, strings.Join(as, " | "))
+}
+
+func (p *Production) Gen(state *GeneratorState, depth int) (Node, error) {
+	return p.gen(state, depth, nil)
 }
 
-func (p *Production) Gen(state *GeneratorState, depth int) (node Node, err error) {
+func (p *Production) gen(state *GeneratorState, depth int, params []binding) (node Node, err error) {
 	if depth <= 0 {
 		return nil, errors.Wrapf(ErrReachedMaxDepth, "%d depth", state.MaxDepth)
 	}
@@ -274,6 +691,14 @@ func (p *Production) Gen(state *GeneratorState, depth int) (node Node, err error
 	if !ok {
 		panic(errors.Wrap(ErrRuleDoesNotExist, "in it's own method?"))
 	}
+	scope, seed := state.scope, state.seed
+	state.scope = slices.Clip(params)
+	if prod.seed != nil {
+		state.seed = prod.seed
+	}
+	defer func() {
+		state.scope, state.seed = scope, seed
+	}()
 
 	for try := 0; try < state.MaxGenerationTries; try++ {
 		x := state.seed.Float64() * prod.max
@@ -281,6 +706,7 @@ func (p *Production) Gen(state *GeneratorState, depth int) (node Node, err error
 		aNo = min(aNo, len(p.Alternatives)-1)
 		node, err = p.Alternatives[aNo].Alternate.Gen(state, depth-1)
 		if err == nil {
+			state.origins[node] = origin{rule: p.Name, depth: depth, params: params}
 			return node, nil
 		} else if errors.Is(err, ErrRuleDoesNotExist) {
 			return nil, err
@@ -289,9 +715,114 @@ func (p *Production) Gen(state *GeneratorState, depth int) (node Node, err error
 	return nil, errors.Wrapf(ErrReachedMaxGenerationTries, "%d tries", state.MaxGenerationTries)
 }
 
+// Mutate regenerates a randomly chosen subtree of a root previously generated
+// by this state from the production that generated it, returning the new root.
+// The given root is left untouched.
+func (s *GeneratorState) Mutate(root Node) (Node, error) {
+	var candidates []Node
+	walk(root, func(n Node) {
+		if _, ok := s.origins[n]; ok && n != root {
+			candidates = append(candidates, n)
+		}
+	})
+	if len(candidates) == 0 {
+		if _, ok := s.origins[root]; !ok {
+			return nil, fmt.Errorf("%s was not generated by this generator", root)
+		}
+		candidates = append(candidates, root)
+	}
+
+	for try := 0; try < s.MaxGenerationTries; try++ {
+		target := candidates[s.seed.IntN(len(candidates))]
+		o := s.origins[target]
+		replacement, err := s.rules[o.rule].gen(s, o.depth, o.params)
+		if err == nil {
+			return replace(root, target, replacement, func(from, to Node) {
+				if o, ok := s.origins[from]; ok {
+					s.origins[to] = o
+				}
+			}), nil
+		} else if errors.Is(err, ErrRuleDoesNotExist) {
+			return nil, err
+		}
+	}
+	return nil, errors.Wrapf(ErrReachedMaxGenerationTries, "%d tries", s.MaxGenerationTries)
+}
+
+// Gen generates another expression from the first production of the grammar
+// that created the state, continuing on from the state's seed. Expressions
+// generated this way can be mutated and crossed over with each other.
+func (s *GeneratorState) Gen() (Node, error) {
+	if len(s.ChannelRules) == 0 {
+		return s.genRule(s.entry)
+	}
+	var channels [3]Node
+	for i, name := range s.ChannelRules {
+		var err error
+		if channels[i], err = s.genRule(name); err != nil {
+			return nil, err
+		}
+	}
+	return &triple{
+		pos: pToP(s.rules[s.ChannelRules[0]].Pos),
+		one: channels[0], two: channels[1], three: channels[2],
+	}, nil
+}
+
+// genRule generates an expression from the rule at the max depth, returning a
+// GenError if it can't.
+func (s *GeneratorState) genRule(name string) (Node, error) {
+	rule := s.rules[name]
+	node, err := rule.Gen(s, s.MaxDepth)
+	if err != nil {
+		return nil, &GenError{Rule: name, Pos: rule.Pos, Seed: s.Seed, Err: err}
+	}
+	return node, nil
+}
+
+// Crossover replaces a randomly chosen subtree of a with a subtree of b that
+// was generated from the same production, returning the new root. Subtrees of
+// b are only chosen if they are no deeper than the subtree they replace could
+// have been, so the max depth is still respected. Both roots must have been
+// generated by this state and are left untouched.
+func (s *GeneratorState) Crossover(a, b Node) (Node, error) {
+	var targets []Node
+	walk(a, func(n Node) {
+		if _, ok := s.origins[n]; ok {
+			targets = append(targets, n)
+		}
+	})
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("%s was not generated by this generator", a)
+	}
+
+	for _, i := range s.seed.Perm(len(targets)) {
+		target := s.origins[targets[i]]
+		var donors []Node
+		walk(b, func(n Node) {
+			if o, ok := s.origins[n]; ok && o.rule == target.rule && o.depth <= target.depth {
+				donors = append(donors, n)
+			}
+		})
+		if len(donors) == 0 {
+			continue
+		}
+		donor := donors[s.seed.IntN(len(donors))]
+		return replace(a, targets[i], donor, func(from, to Node) {
+			if o, ok := s.origins[from]; ok {
+				s.origins[to] = o
+			}
+		}), nil
+	}
+	return nil, fmt.Errorf("%s has no subtrees generated from the same productions as %s", b, a)
+}
+
 type Grammar struct {
 	Pos         lexer.Position
 	Productions []*Production `@@+`
+	// hash is the SHA-256 of the grammar as it was parsed, as generating
+	// sorts the alternatives of its productions.
+	hash string
 }
 
 func (g *Grammar) String() string {
@@ -303,60 +834,523 @@ func (g *Grammar) String() string {
 	return b.String()
 }
 
-type generatorStateOptions struct {
-	Seed               uint64 `json:"seed"`
-	MaxDepth           int    `json:"max_depth"`
-	MaxGenerationTries int    `json:"max_generation_tries"`
+func alternateChildren(a Alternate) []Alternate {
+	switch a := a.(type) {
+	case Triplet:
+		if a.Four != nil {
+			return []Alternate{a.One, a.Two, a.Three, a.Four}
+		}
+		return []Alternate{a.One, a.Two, a.Three}
+	case Outputs:
+		children := make([]Alternate, len(a.Outputs))
+		for i, o := range a.Outputs {
+			children[i] = o.Alternate
+		}
+		return children
+	case Func:
+		return []Alternate{a.Left, a.Right}
+	case IfThenElse:
+		return []Alternate{a.If, a.Then, a.Else}
+	case Let:
+		return []Alternate{a.Value, a.Body}
+	case Element:
+		return []Alternate{a.Value}
+	case Swizzle:
+		return []Alternate{a.Value}
+	case Warp:
+		return []Alternate{a.Value, a.DX, a.DY}
+	case Cellular:
+		return []Alternate{a.A, a.B}
+	case Rule:
+		return a.Args
+	case Call:
+		return a.Args
+	}
+	return nil
+}
+
+// walkAlternate calls f with the alternate and each of its descendants, along
+// with the names bound by lets, and the given parameters, at each of them.
+func walkAlternate(a Alternate, bound []string, f func(a Alternate, bound []string) error) error {
+	if err := f(a, bound); err != nil {
+		return err
+	}
+	if l, ok := a.(Let); ok {
+		if err := walkAlternate(l.Value, bound, f); err != nil {
+			return err
+		}
+		return walkAlternate(l.Body, append(slices.Clip(bound), l.Name), f)
+	}
+	for _, c := range alternateChildren(a) {
+		if err := walkAlternate(c, bound, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// referencedRules returns the names of the rules referenced by an alternate in
+// the order that they are first referenced. Names bound by a let are not
+// references within its body and nor are the given parameters.
+func referencedRules(a Alternate, params []string) []string {
+	var names []string
+	_ = walkAlternate(a, params, func(a Alternate, bound []string) error {
+		if r, ok := a.(Rule); ok && !slices.Contains(bound, r.Name) && !slices.Contains(names, r.Name) {
+			names = append(names, r.Name)
+		}
+		return nil
+	})
+	return names
+}
+
+// checkReferences checks that the first production has no parameters and that
+// every reference to a production passes an argument for each of its
+// parameters.
+func (g *Grammar) checkReferences() error {
+	if first := g.Productions[0]; len(first.Params) > 0 {
+		return fmt.Errorf("the first production %s (at %s) cannot have parameters", first.Name, first.Pos)
+	}
+	params := make(map[string][]string)
+	for _, p := range g.Productions {
+		for i, name := range p.Params {
+			if slices.Contains(p.Params[:i], name) {
+				return fmt.Errorf("parameter %s of production %s (at %s) has been defined multiple times", name, p.Name, p.Pos)
+			}
+		}
+		params[p.Name] = p.Params
+	}
+	for _, p := range g.Productions {
+		for _, a := range p.Alternatives {
+			err := walkAlternate(a.Alternate, p.Params, func(a Alternate, bound []string) error {
+				r, ok := a.(Rule)
+				if !ok {
+					return nil
+				}
+				if slices.Contains(bound, r.Name) {
+					if len(r.Args) > 0 {
+						return fmt.Errorf("%s referenced at %s is not a production so cannot be passed arguments", r.Name, r.Pos)
+					}
+				} else if ps, ok := params[r.Name]; ok && len(r.Args) != len(ps) {
+					return fmt.Errorf("%s referenced at %s with %d arguments, expected %d", r.Name, r.Pos, len(r.Args), len(ps))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RuleReference is a reference from one production to another. Weight is the
+// combined weight of the alternatives of From that reference To.
+type RuleReference struct {
+	From   string
+	To     string
+	Weight float64
+}
+
+// References returns the references between the productions of the grammar,
+// including references to productions that don't exist.
+func (g *Grammar) References() []RuleReference {
+	var refs []RuleReference
+	for _, p := range g.Productions {
+		start := len(refs)
+		for _, a := range p.Alternatives {
+			for _, name := range referencedRules(a.Alternate, p.Params) {
+				i := slices.IndexFunc(refs[start:], func(r RuleReference) bool { return r.To == name })
+				if i < 0 {
+					refs = append(refs, RuleReference{From: p.Name, To: name})
+					i = len(refs) - 1 - start
+				}
+				refs[start+i].Weight += a.Probability
+			}
+		}
+	}
+	return refs
+}
+
+// Unproductive returns the productions that can never finish generating, as
+// every one of their alternatives references a production that doesn't exist
+// or is itself unproductive.
+func (g *Grammar) Unproductive() []string {
+	productive := make(map[string]bool)
+	for changed := true; changed; {
+		changed = false
+		for _, p := range g.Productions {
+			if productive[p.Name] {
+				continue
+			}
+			for _, a := range p.Alternatives {
+				if !slices.ContainsFunc(referencedRules(a.Alternate, p.Params), func(name string) bool { return !productive[name] }) {
+					productive[p.Name], changed = true, true
+					break
+				}
+			}
+		}
+	}
+
+	var unproductive []string
+	for _, p := range g.Productions {
+		if !productive[p.Name] {
+			unproductive = append(unproductive, p.Name)
+		}
+	}
+	return unproductive
+}
+
+type GeneratorOptions struct {
+	Seed               uint64  `json:"seed"`
+	MaxDepth           int     `json:"max_depth"`
+	MaxGenerationTries int     `json:"max_generation_tries"`
+	MinEntropy         float64 `json:"min_entropy,omitempty"`
+	MinDepth           int     `json:"min_depth,omitempty"`
+	MaxNodes           int     `json:"max_nodes,omitempty"`
+	ProductionStreams  bool    `json:"production_streams,omitempty"`
+	// Stream is the second half of the seed of the random number generator,
+	// if it is 0 then Seed+1 is used.
+	Stream uint64 `json:"stream,omitempty"`
+	// ChannelRules are the productions that the red, green and blue channels
+	// are generated from separately, instead of generating a triple from the
+	// first production.
+	ChannelRules []string `json:"channel_rules,omitempty"`
+	// RequireComponents are the components, including those added with
+	// RegisterComponent, that every generated expression must use.
+	RequireComponents []string `json:"require_components,omitempty"`
+	// RuleSeeds pin productions to their own streams of random numbers
+	// seeded from these rather than Seed, so that they generate the same
+	// whatever Seed is. Productions that they generate without their own
+	// stream are pinned with them.
+	RuleSeeds map[string]uint64 `json:"rule_seeds,omitempty"`
+	// Accept is called with each generated expression that meets the other
+	// options, which is rejected if it returns false. It isn't encoded, but
+	// the seed of the accepted expression is so it can still be reproduced.
+	Accept func(root Node) bool `json:"-"`
+	// Tracer starts a span around generation and each try to generate an
+	// expression, or nothing if it is nil. It isn't encoded.
+	Tracer trace.Tracer `json:"-"`
+	// Version, RNG and GrammarSHA256 record what generated the expression,
+	// see CheckCompatible. They are set when generating.
+	Version       int    `json:"version,omitempty"`
+	RNG           string `json:"rng,omitempty"`
+	GrammarSHA256 string `json:"grammar_sha256,omitempty"`
+	// Schema is the OptionsSchema that the options were encoded with, which
+	// is set when encoding them.
+	Schema int `json:"schema,omitempty"`
+}
+
+type generatorOptionsJSON GeneratorOptions
+
+func (o GeneratorOptions) MarshalJSON() ([]byte, error) {
+	o.Schema = OptionsSchema
+	return json.Marshal(generatorOptionsJSON(o))
+}
+
+func (o *GeneratorOptions) UnmarshalJSON(data []byte) error {
+	data, err := migrateOptions(data)
+	if err != nil {
+		return err
+	}
+	opts := generatorOptionsJSON(*o)
+	if err := json.Unmarshal(data, &opts); err != nil {
+		return err
+	}
+	if err := GeneratorOptions(opts).validate(); err != nil {
+		return err
+	}
+	*o = GeneratorOptions(opts)
+	return nil
+}
+
+// OptionsSchema is the version of the JSON that generator options are encoded
+// as. It is incremented whenever a field is renamed or changes meaning, with a
+// migration from the previous schema added to optionsMigrations, so that the
+// options saved before keep decoding the same. Fields that are only added
+// don't need a new schema, as those missing from older options are left as
+// they were.
+const OptionsSchema = 1
+
+// optionsMigrations migrate the fields of options encoded with each schema to
+// the next, the first from options saved before the schema was recorded.
+var optionsMigrations = []func(fields map[string]json.RawMessage) error{
+	// Options were only ever added to before the schema was recorded, so
+	// they decode as they are.
+	func(map[string]json.RawMessage) error { return nil },
 }
 
-func defaultGeneratorStateOptions() *generatorStateOptions {
-	return &generatorStateOptions{
+// migrateOptions migrates the JSON of options encoded with an older schema to
+// the OptionsSchema. Options from a newer schema can't be migrated.
+func migrateOptions(data []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil || fields == nil {
+		// The error is returned when decoding the options themselves.
+		return data, nil
+	}
+	var schema int
+	if raw, ok := fields["schema"]; ok {
+		if err := json.Unmarshal(raw, &schema); err != nil {
+			return nil, fmt.Errorf("schema must be a number: %w", err)
+		}
+	}
+	switch {
+	case schema == OptionsSchema:
+		return data, nil
+	case schema > OptionsSchema:
+		return nil, fmt.Errorf("options were encoded with schema %d by a newer version of randomart, which only understands up to %d", schema, OptionsSchema)
+	case schema < 0:
+		return nil, fmt.Errorf("schema %d is not valid", schema)
+	}
+	for ; schema < OptionsSchema; schema++ {
+		if err := optionsMigrations[schema](fields); err != nil {
+			return nil, fmt.Errorf("could not migrate options from schema %d: %w", schema, err)
+		}
+	}
+	fields["schema"] = json.RawMessage(strconv.Itoa(OptionsSchema))
+	return json.Marshal(fields)
+}
+
+func (o GeneratorOptions) validate() error {
+	if o.MaxDepth <= 0 {
+		return fmt.Errorf("max depth must be positive")
+	}
+	if o.MaxGenerationTries <= 0 {
+		return fmt.Errorf("max generation tries must be positive")
+	}
+	if o.MinEntropy < 0 {
+		return fmt.Errorf("min entropy cannot be negative")
+	}
+	if o.MinDepth < 0 {
+		return fmt.Errorf("min depth cannot be negative")
+	}
+	if o.MaxNodes < 0 {
+		return fmt.Errorf("max nodes cannot be negative")
+	}
+	if len(o.ChannelRules) != 0 && len(o.ChannelRules) != 3 {
+		return fmt.Errorf("there must be a channel rule for each of red, green and blue, not %d", len(o.ChannelRules))
+	}
+	for _, c := range o.RequireComponents {
+		if _, ok := lookupComponent(c); !ok && !componentType(c).Valid() {
+			return fmt.Errorf("required component %q is not a component", c)
+		}
+	}
+	return nil
+}
+
+// accepts returns whether a generated root is at least the min depth, has no
+// more than the max nodes, has at least the min entropy and is accepted by the
+// accept function.
+func (o GeneratorOptions) accepts(root Node) bool {
+	if o.MinDepth > 0 && depth(root) < o.MinDepth {
+		return false
+	}
+	if o.MaxNodes > 0 && size(root) > o.MaxNodes {
+		return false
+	}
+	if len(o.RequireComponents) > 0 {
+		used := usedComponents(root)
+		for _, c := range o.RequireComponents {
+			if !slices.Contains(used, c) {
+				return false
+			}
+		}
+	}
+	if o.MinEntropy > 0 {
+		if entropy, err := Entropy(root); err != nil || entropy < o.MinEntropy {
+			return false
+		}
+	}
+	return o.Accept == nil || o.Accept(root)
+}
+
+func defaultGeneratorOptions() *GeneratorOptions {
+	return &GeneratorOptions{
 		Seed:               uint64(time.Now().Unix()),
 		MaxDepth:           10,
 		MaxGenerationTries: 100,
+		Tracer:             noop.NewTracerProvider().Tracer(""),
+	}
+}
+
+// WithTracer traces generation with the tracer, see GeneratorOptions.Tracer.
+func WithTracer(tracer trace.Tracer) GeneratorOption {
+	return func(o *GeneratorOptions) error {
+		if tracer == nil {
+			return fmt.Errorf("tracer cannot be nil")
+		}
+		o.Tracer = tracer
+		return nil
 	}
 }
 
-type GeneratorOption func(o *generatorStateOptions) error
+type GeneratorOption func(o *GeneratorOptions) error
 
 func WithSeeds(seed uint64) GeneratorOption {
-	return func(o *generatorStateOptions) error {
-		o.Seed = seed
+	return func(o *GeneratorOptions) error {
+		o.Seed, o.Stream = seed, 0
+		return nil
+	}
+}
+
+// SeedFromString returns the seed and stream that WithSeedString uses for s,
+// which are the first and second 8 bytes of its SHA-256 hash read as big
+// endian. This will not change between versions so that the same string
+// always generates the same expression from the same grammar.
+func SeedFromString(s string) (seed, stream uint64) {
+	sum := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:16])
+}
+
+// WithSeedString seeds the generator with the hash of a string, so that names,
+// email addresses and the like can be used as seeds.
+func WithSeedString(s string) GeneratorOption {
+	return func(o *GeneratorOptions) error {
+		o.Seed, o.Stream = SeedFromString(s)
 		return nil
 	}
 }
 
 func WithMaxDepth(depth int) GeneratorOption {
-	return func(o *generatorStateOptions) error {
+	return func(o *GeneratorOptions) error {
 		o.MaxDepth = depth
 		return nil
 	}
 }
 
 func WithMaxGenerationTries(tries int) GeneratorOption {
-	return func(o *generatorStateOptions) error {
+	return func(o *GeneratorOptions) error {
 		o.MaxGenerationTries = tries
 		return nil
 	}
 }
 
+// WithQualityFilter rejects generated expressions whose Entropy is lower than
+// minEntropy, such as those that are a single flat colour, and regenerates them
+// from the next seed, up to the max generation tries. The seed of the accepted
+// expression is kept in the options.
+func WithQualityFilter(minEntropy float64) GeneratorOption {
+	return func(o *GeneratorOptions) error {
+		o.MinEntropy = minEntropy
+		return nil
+	}
+}
+
+// WithProductionStreams gives each production its own stream of random
+// numbers, derived from the seed and the production's name, so that editing
+// one production changes fewer of the choices made by the others. The same
+// seed generates a different expression with production streams than without.
+func WithProductionStreams() GeneratorOption {
+	return func(o *GeneratorOptions) error {
+		o.ProductionStreams = true
+		return nil
+	}
+}
+
+// WithRuleSeed pins the production to its own stream of random numbers
+// seeded from seed, see GeneratorOptions.RuleSeeds.
+func WithRuleSeed(rule string, seed uint64) GeneratorOption {
+	return func(o *GeneratorOptions) error {
+		o.RuleSeeds = maps.Clone(o.RuleSeeds)
+		if o.RuleSeeds == nil {
+			o.RuleSeeds = make(map[string]uint64)
+		}
+		o.RuleSeeds[rule] = seed
+		return nil
+	}
+}
+
+// WithChannelRules generates the red, green and blue channels separately from
+// the given productions, which don't need to generate triples, instead of
+// from the first production.
+func WithChannelRules(r, g, b string) GeneratorOption {
+	return func(o *GeneratorOptions) error {
+		o.ChannelRules = []string{r, g, b}
+		return nil
+	}
+}
+
+// WithMinDepth rejects generated expressions that are less than depth nodes
+// deep, counting the root, and regenerates them the same way as
+// WithQualityFilter.
+func WithMinDepth(depth int) GeneratorOption {
+	return func(o *GeneratorOptions) error {
+		o.MinDepth = depth
+		return nil
+	}
+}
+
+// WithMaxNodes rejects generated expressions with more than n nodes, which
+// bounds how long they take to render, and regenerates them the same way as
+// WithQualityFilter.
+func WithMaxNodes(n int) GeneratorOption {
+	return func(o *GeneratorOptions) error {
+		o.MaxNodes = n
+		return nil
+	}
+}
+
+// WithRequireComponents rejects generated expressions that don't use all of
+// the given components, such as x and y as expressions without them are a
+// single colour at every position, and regenerates them the same way as
+// WithQualityFilter.
+func WithRequireComponents(components ...string) GeneratorOption {
+	return func(o *GeneratorOptions) error {
+		o.RequireComponents = components
+		return nil
+	}
+}
+
+// WithAcceptFunc rejects generated expressions for which accept returns false,
+// such as those that don't use both x and y, and regenerates them the same way
+// as WithQualityFilter.
+func WithAcceptFunc(accept func(root Node) bool) GeneratorOption {
+	return func(o *GeneratorOptions) error {
+		o.Accept = accept
+		return nil
+	}
+}
+
+func FromOptions(opts GeneratorOptions) GeneratorOption {
+	return func(o *GeneratorOptions) error {
+		*o = opts
+		return nil
+	}
+}
+
 func FromJSON(r io.Reader) GeneratorOption {
-	return func(o *generatorStateOptions) error {
+	return func(o *GeneratorOptions) error {
 		return errors.Wrap(json.NewDecoder(r).Decode(o), "cannot decode generator options from JSON")
 	}
 }
 
 func (g *Grammar) Gen(opts ...GeneratorOption) (Node, *GeneratorState, error) {
-	options := defaultGeneratorStateOptions()
+	return g.GenContext(context.Background(), opts...)
+}
+
+// GenContext is Gen but gives up between tries once the context is done. The
+// spans of the tracer given with WithTracer are children of the context's.
+func (g *Grammar) GenContext(ctx context.Context, opts ...GeneratorOption) (_ Node, _ *GeneratorState, err error) {
+	options := defaultGeneratorOptions()
 	for _, opt := range opts {
 		if err := opt(options); err != nil {
 			return nil, nil, err
 		}
 	}
+	if err := options.validate(); err != nil {
+		return nil, nil, err
+	}
+	if options.Tracer == nil {
+		options.Tracer = noop.NewTracerProvider().Tracer("")
+	}
+	options.Version, options.RNG, options.GrammarSHA256 = GeneratorVersion, RNGScheme, g.SHA256()
+	ctx, span := options.Tracer.Start(ctx, "randomart.generate")
+	defer func() { endSpan(span, err) }()
+
 	s := &GeneratorState{
-		generatorStateOptions: options,
-		seed:                  rand.New(rand.NewPCG(options.Seed, options.Seed+1)),
-		rules:                 make(map[string]*production),
+		GeneratorOptions: options,
+		entry:            g.Productions[0].Name,
+		rules:            make(map[string]*production),
+		origins:          make(map[Node]origin),
 	}
 	for _, p := range g.Productions {
 		if firstProduction, ok := s.rules[p.Name]; ok {
@@ -381,48 +1375,177 @@ func (g *Grammar) Gen(opts ...GeneratorOption) (Node, *GeneratorState, error) {
 		}
 		s.rules[p.Name] = &prod
 	}
-	node, err := g.Productions[0].Gen(s, options.MaxDepth)
-	return node, s, err
-}
-
-var def = lexer.MustSimple([]lexer.SimpleRule{
-	{"Component", componentTypePattern()},
-	{"True", `true`},
-	{"False", `false`},
-	{"LParen", `\(`},
-	{"RParen", `\)`},
-	{"LCurly", `\{`},
-	{"RCurly", `\}`},
-	{"Comma", `,`},
-	{"Random", `\?`},
-	{"Percent", `%`},
-	{"Pipe", `\|`},
-	{"ProductionEquals", `\s::=\s`},
-	{"Dot", `\.`},
-	{"If", `if\s`},
-	{"Then", `\sthen\s`},
-	{"Else", `\selse\s`},
-	{"Number", `[-+]?(\d*\.)?\d+`},
-	{"Operator", opTypePattern()},
-	{"Ident", `[A-Z]`},
-	{"Whitespace", `\s+`},
-})
-
-var parser = participle.MustBuild[Grammar](
-	participle.Lexer(def),
-	participle.Elide("Whitespace"),
-	participle.Union[Alternate](
-		Triplet{},
-		IfThenElse{},
-		Number{},
-		Bool{},
-		Component{},
-		Rule{},
-		Random{},
-		Func{},
-	),
-)
+	for name := range options.RuleSeeds {
+		if _, ok := s.rules[name]; !ok {
+			return nil, nil, errors.Wrapf(ErrRuleDoesNotExist, "%s given a rule seed", name)
+		}
+	}
+	for _, name := range options.ChannelRules {
+		if p, ok := s.rules[name]; !ok {
+			return nil, nil, errors.Wrapf(ErrRuleDoesNotExist, "%s used as a channel rule", name)
+		} else if len(p.Params) > 0 {
+			return nil, nil, fmt.Errorf("%s has parameters so cannot be used as a channel rule", name)
+		}
+	}
+	s.reseed()
+	seed := options.Seed
+	for try := 1; ; try++ {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		_, attempt := options.Tracer.Start(ctx, "randomart.generate.attempt", trace.WithAttributes(
+			attribute.Int("try", try),
+			attribute.String("seed", strconv.FormatUint(options.Seed, 10)),
+		))
+		node, err := s.Gen()
+		accepted := err == nil && options.accepts(node)
+		attempt.SetAttributes(attribute.Bool("accepted", accepted))
+		endSpan(attempt, err)
+		if err != nil || accepted {
+			return node, s, err
+		}
+		if try == options.MaxGenerationTries {
+			return nil, nil, &GenError{
+				Rule: s.entry,
+				Pos:  s.rules[s.entry].Pos,
+				Seed: seed,
+				Err: errors.Wrapf(
+					ErrReachedMaxGenerationTries, "%d tries to generate an expression that is accepted",
+					options.MaxGenerationTries,
+				),
+			}
+		}
+		options.Seed++
+		s.reseed()
+		clear(s.origins)
+	}
+}
+
+// endSpan ends the span, recording the error if there is one.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// reseed restarts the state's streams of random numbers from its seed.
+func (s *GeneratorState) reseed() {
+	stream := s.Stream
+	if stream == 0 {
+		stream = s.Seed + 1
+	}
+	s.seed = rand.New(rand.NewPCG(s.Seed, stream))
+	for name, p := range s.rules {
+		p.seed = nil
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(name))
+		if seed, ok := s.RuleSeeds[name]; ok {
+			p.seed = rand.New(rand.NewPCG(seed, h.Sum64()))
+		} else if s.ProductionStreams {
+			p.seed = rand.New(rand.NewPCG(s.Seed, h.Sum64()))
+		}
+	}
+}
+
+var parser *participle.Parser[Grammar]
 
-func Parse(r io.Reader, filename string) (*Grammar, error) {
-	return parser.Parse(filename, r)
+// grammarParser returns the parser for grammars, building it if it doesn't
+// exist as the operators registered with RegisterOp are part of the lexer.
+func grammarParser() *participle.Parser[Grammar] {
+	registryMu.RLock()
+	p := parser
+	registryMu.RUnlock()
+	if p != nil {
+		return p
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if parser != nil {
+		return parser
+	}
+	def := lexer.MustSimple([]lexer.SimpleRule{
+		{"Label", `[a-z_][a-z0-9_]*:`},
+		{"Let", `let\s`},
+		{"Element", `(first|second|third|fourth)\b`},
+		{"Swizzle", `swizzle\b`},
+		{"Warp", `warp\b`},
+		{"Cellular", `(voronoi|cell)\b`},
+		{"String", `"[^"]*"`},
+		{"Custom", customPattern(customOps)},
+		{"CustomComponent", customPattern(customComponents)},
+		{"Component", componentTypePattern() + `\b`},
+		{"True", `true`},
+		{"False", `false`},
+		{"LParen", `\(`},
+		{"RParen", `\)`},
+		{"LCurly", `\{`},
+		{"RCurly", `\}`},
+		{"Comma", `,`},
+		{"Random", `\?`},
+		{"Percent", `%`},
+		{"Pipe", `\|`},
+		{"ProductionEquals", `\s::=\s`},
+		{"Dot", `\.`},
+		{"If", `if\s`},
+		{"Then", `\sthen\s`},
+		{"Else", `\selse\s`},
+		{"In", `\sin\s`},
+		{"Equals", `=`},
+		{"Number", `[-+]?(\d*\.)?\d+`},
+		{"Param", `\$[a-z_][a-z0-9_]*`},
+		{"Operator", opTypePattern()},
+		{"Ident", `[A-Z][A-Za-z0-9_]*`},
+		{"Whitespace", `\s+`},
+	})
+	parser = participle.MustBuild[Grammar](
+		participle.Lexer(def),
+		participle.Elide("Whitespace"),
+		participle.Union[Alternate](
+			Outputs{},
+			Triplet{},
+			IfThenElse{},
+			Let{},
+			Element{},
+			Swizzle{},
+			Warp{},
+			Cellular{},
+			Number{},
+			Bool{},
+			Component{},
+			Rule{},
+			Random{},
+			Func{},
+			Call{},
+			CustomComponent{},
+			Param{},
+		),
+	)
+	return parser
+}
+
+// Parse parses and checks a grammar. The errors of every production that
+// begins a line are returned, joined, rather than only the first. Panics of
+// the parser on malformed input are returned as errors.
+func Parse(r io.Reader, filename string) (g *Grammar, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			g, err = nil, fmt.Errorf("%s: could not parse grammar: %v", filename, p)
+		}
+	}()
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	g, err = parseProductions(string(src), filename)
+	if err != nil {
+		return nil, err
+	}
+	if err = g.checkReferences(); err != nil {
+		return nil, err
+	}
+	g.hash = g.SHA256()
+	return g, nil
 }
@@ -0,0 +1,58 @@
+package nodes
+
+// hoist returns n with f substituted and every subtree that doesn't depend on
+// the position or source replaced by its value, and whether the result is
+// constant. If f is nil it is left as a component. Subtrees that fail to
+// evaluate are left as they are so that the error is reported when they are
+// evaluated for a pixel.
+func hoist(n Node, f *float64) (Node, bool) {
+	switch n := n.(type) {
+	case *value[float64], *value[bool]:
+		return n, true
+	case *component:
+		if n.ct != fComponent || f == nil {
+			return n, false
+		}
+		return &value[float64]{pos: n.pos, v: *f}, true
+	case *ifThenElse:
+		cond, constant := hoist(n.cond, f)
+		if c, ok := cond.(*value[bool]); ok && constant {
+			if c.v {
+				return hoist(n.then, f)
+			}
+			return hoist(n.otherwise, f)
+		}
+	}
+
+	cs := children(n)
+	if cs == nil {
+		return n, false
+	}
+	hoisted := make([]Node, len(cs))
+	constant, changed := true, false
+	for i, c := range cs {
+		var cc bool
+		hoisted[i], cc = hoist(c, f)
+		constant = constant && cc
+		changed = changed || hoisted[i] != c
+	}
+	if changed {
+		n = withChildren(n, hoisted)
+	}
+	if !constant {
+		return n, false
+	}
+	v, err := n.Eval(State{})
+	if err != nil {
+		return n, false
+	}
+	return v, true
+}
+
+// Hoist returns a copy of the root for a single frame, with the f component
+// replaced by the given value and subtrees that only depend on f evaluated
+// once up front rather than for every pixel.
+func Hoist(root Node, f float64) Node {
+	n, _ := hoist(root, &f)
+	return n
+}
@@ -0,0 +1,180 @@
+package nodes
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+type nodeJSON struct {
+	Type      string     `json:"type"`
+	File      string     `json:"file,omitempty"`
+	Line      int        `json:"line,omitempty"`
+	Number    float64    `json:"number,omitempty"`
+	Bool      bool       `json:"bool,omitempty"`
+	Component string     `json:"component,omitempty"`
+	Names     []string   `json:"names,omitempty"`
+	Op        string     `json:"op,omitempty"`
+	Elements  string     `json:"elements,omitempty"`
+	Seed      uint64     `json:"seed,omitempty"`
+	Children  []nodeJSON `json:"children,omitempty"`
+}
+
+// Kind returns the type of a node as MarshalNode writes it, such as add, if or
+// triple, or "" if it is implemented outside this package.
+func Kind(n Node) string {
+	switch n := n.(type) {
+	case *value[float64]:
+		return "number"
+	case *value[bool]:
+		return "bool"
+	case *component:
+		return "component"
+	case *custom:
+		return "custom"
+	case *param:
+		return "param"
+	case *op:
+		return string(n.t)
+	case *triple:
+		return "triple"
+	case *quad:
+		return "quad"
+	case *named:
+		return "named"
+	case *ifThenElse:
+		return "if"
+	case *call:
+		return "call"
+	case *swizzle:
+		return "swizzle"
+	case *warp:
+		return "warp"
+	case *cellular:
+		return string(n.t)
+	}
+	return ""
+}
+
+func toJSON(n Node) (nodeJSON, error) {
+	j := nodeJSON{Type: Kind(n), File: n.File(), Line: n.Line()}
+	if j.Type == "" {
+		return j, fmt.Errorf("cannot marshal %T node %s", n, n)
+	}
+	switch n := n.(type) {
+	case *value[float64]:
+		j.Number = n.v
+	case *value[bool]:
+		j.Bool = n.v
+	case *component:
+		j.Component = string(n.ct)
+	case *custom:
+		j.Component = n.c.name
+	case *param:
+		j.Component = n.name
+	case *named:
+		j.Names = n.names
+	case *call:
+		j.Op = n.op.name
+	case *swizzle:
+		j.Elements = n.elements
+	case *cellular:
+		j.Seed = n.seed
+	}
+	for _, c := range children(n) {
+		cj, err := toJSON(c)
+		if err != nil {
+			return j, err
+		}
+		j.Children = append(j.Children, cj)
+	}
+	return j, nil
+}
+
+func fromJSON(j nodeJSON) (Node, error) {
+	cs := make([]Node, len(j.Children))
+	for i, cj := range j.Children {
+		var err error
+		if cs[i], err = fromJSON(cj); err != nil {
+			return nil, err
+		}
+	}
+
+	at := pos{file: j.File, line: j.Line}
+	var (
+		n        Node
+		children int
+	)
+	switch j.Type {
+	case "number":
+		n = &value[float64]{pos: at, v: j.Number}
+	case "bool":
+		n = &value[bool]{pos: at, v: j.Bool}
+	case "component":
+		if !componentType(j.Component).Valid() {
+			return nil, fmt.Errorf("%q is not a valid component", j.Component)
+		}
+		n = &component{pos: at, ct: componentType(j.Component)}
+	case "custom":
+		c, ok := lookupComponent(j.Component)
+		if !ok {
+			return nil, fmt.Errorf("component %s is not registered", j.Component)
+		}
+		n = &custom{pos: at, c: c}
+	case "param":
+		n = &param{pos: at, name: j.Component}
+	case "triple":
+		n, children = &triple{pos: at}, 3
+	case "quad":
+		n, children = &quad{pos: at}, 4
+	case "named":
+		n, children = &named{pos: at, names: j.Names}, len(j.Names)
+	case "if":
+		n, children = &ifThenElse{pos: at}, 3
+	case "call":
+		op, ok := lookupOp(j.Op)
+		if !ok {
+			return nil, fmt.Errorf("operator %s is not registered", j.Op)
+		}
+		n, children = &call{pos: at, op: op}, op.arity
+	case "swizzle":
+		if err := checkElements(j.Elements); err != nil {
+			return nil, err
+		}
+		n, children = &swizzle{pos: at, elements: j.Elements}, 1
+	case "warp":
+		n, children = &warp{pos: at}, 3
+	case string(voronoiCellular), string(cellCellular):
+		n, children = newCellular(at, cellularType(j.Type), j.Seed, nil, nil), 2
+	default:
+		if !slices.Contains(opTypes(), opType(j.Type)) {
+			return nil, fmt.Errorf("%q is not a valid node type", j.Type)
+		}
+		n, children = &op{pos: at, t: opType(j.Type)}, 2
+	}
+	if len(cs) != children {
+		return nil, fmt.Errorf("%s node has %d children, expected %d", j.Type, len(cs), children)
+	}
+	if children == 0 {
+		return n, nil
+	}
+	return withChildren(n, cs), nil
+}
+
+// MarshalNode serializes the given expression to JSON so that it can be sent
+// elsewhere to be rendered.
+func MarshalNode(n Node) ([]byte, error) {
+	j, err := toJSON(n)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(j)
+}
+
+func UnmarshalNode(data []byte) (Node, error) {
+	var j nodeJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, err
+	}
+	return fromJSON(j)
+}
@@ -6,6 +6,7 @@ import (
 	"math"
 	"regexp"
 	"runtime"
+	"slices"
 	"strings"
 )
 
@@ -51,6 +52,9 @@ func (ct componentType) Valid() bool {
 type State struct {
 	X, Y, F float64
 	R, G, B float64
+	// Data is anything else that components added with RegisterComponent
+	// need, it is nil unless set by whatever creates the state.
+	Data any
 }
 
 func (s *State) component(c componentType) float64 {
@@ -68,21 +72,38 @@ func (s *State) component(c componentType) float64 {
 	case bComponent:
 		return s.B
 	}
-	panic(fmt.Errorf("%s is not a valid component for %T", c, s))
+	panic(fmt.Errorf("%s is not a valid component for %T", c, (*State)(nil)))
 }
 
+// S returns the state of the pixel at x, y of an image of the given size in
+// the given frame, whose components go from -1 at the first pixel or frame to
+// 1 at the last. Images a pixel wide or high and single frames are at 0.
 func S(x, y, width, height, frame, frames int, src color.Color) State {
+	return SF(float64(x), float64(y), width, height, frame, frames, src)
+}
+
+// SF is S but for sub-pixel positions.
+func SF(x, y float64, width, height, frame, frames int, src color.Color) State {
 	r, g, b, _ := src.RGBA()
 	return State{
-		X: float64(x)/float64(width-1)*2 - 1,
-		Y: float64(y)/float64(height-1)*2 - 1,
-		F: float64(frame)/float64(frames-1)*2 - 1,
+		X: coordinate(x, width),
+		Y: coordinate(y, height),
+		F: coordinate(float64(frame), frames),
 		R: float64(r)/0xFFFF*2 - 1,
 		G: float64(g)/0xFFFF*2 - 1,
 		B: float64(b)/0xFFFF*2 - 1,
 	}
 }
 
+// coordinate maps v from between 0 and size-1 to between -1 and 1, or to 0 if
+// there is only one position rather than dividing by 0.
+func coordinate(v float64, size int) float64 {
+	if size <= 1 {
+		return 0
+	}
+	return v/float64(size-1)*2 - 1
+}
+
 type notA string
 
 const (
@@ -111,6 +132,19 @@ type Node interface {
 	Eval(state State) (Node, error)
 }
 
+// NumberNode is implemented by nodes that can evaluate to a number directly,
+// without allocating a Node for the result or any of their operands.
+type NumberNode interface {
+	Node
+	EvalNum(state State) (float64, error)
+}
+
+// BooleanNode is NumberNode for nodes that evaluate to booleans.
+type BooleanNode interface {
+	Node
+	EvalBool(state State) (bool, error)
+}
+
 type pos struct {
 	file string
 	line int
@@ -157,6 +191,28 @@ func isBoolean(n Node) (bool, error) {
 	}
 }
 
+func evalNumber(n Node, state State) (float64, error) {
+	if nn, ok := n.(NumberNode); ok {
+		return nn.EvalNum(state)
+	}
+	v, err := n.Eval(state)
+	if err != nil {
+		return 0, err
+	}
+	return isNumber(v)
+}
+
+func evalBoolean(n Node, state State) (bool, error) {
+	if bn, ok := n.(BooleanNode); ok {
+		return bn.EvalBool(state)
+	}
+	v, err := n.Eval(state)
+	if err != nil {
+		return false, err
+	}
+	return isBoolean(v)
+}
+
 type supportedValueTypes interface {
 	float64 | bool
 }
@@ -174,6 +230,14 @@ func (v *value[T]) Eval(state State) (Node, error) {
 	return v, nil
 }
 
+func (v *value[T]) EvalNum(state State) (float64, error) {
+	return isNumber(v)
+}
+
+func (v *value[T]) EvalBool(state State) (bool, error) {
+	return isBoolean(v)
+}
+
 func Val[T supportedValueTypes](v T) Node { return &value[T]{pos: p(), v: v} }
 
 type component struct {
@@ -189,6 +253,14 @@ func (c *component) Eval(state State) (Node, error) {
 	return &value[float64]{pos: c.pos, v: state.component(c.ct)}, nil
 }
 
+func (c *component) EvalNum(state State) (float64, error) {
+	return state.component(c.ct), nil
+}
+
+func (c *component) EvalBool(state State) (bool, error) {
+	return isBoolean(&value[float64]{pos: c.pos, v: state.component(c.ct)})
+}
+
 type opType string
 
 const (
@@ -240,51 +312,142 @@ func (o *op) String() string {
 	return fmt.Sprintf("%s(%s, %s)", o.t, o.left, o.right)
 }
 
-func (o *op) Eval(state State) (Node, error) {
-	left, err := o.left.Eval(state)
+func (o *op) comparison() bool {
+	switch o.t {
+	case gt, ge, lt, le:
+		return true
+	}
+	return false
+}
+
+func (o *op) operands(state State) (float64, float64, error) {
+	left, err := evalNumber(o.left, state)
 	if err != nil {
-		return nil, err
+		return 0, 0, err
 	}
-	right, err := o.right.Eval(state)
+	right, err := evalNumber(o.right, state)
 	if err != nil {
-		return nil, err
+		return 0, 0, err
+	}
+	return left, right, nil
+}
+
+func (o *op) Eval(state State) (Node, error) {
+	if o.comparison() {
+		v, err := o.EvalBool(state)
+		if err != nil {
+			return nil, err
+		}
+		return &value[bool]{pos: o.pos, v: v}, nil
+	}
+	v, err := o.EvalNum(state)
+	if _, ok := err.(*ValidationError); ok {
+		return o.elementwise(state, err)
 	}
-	leftN, err := isNumber(left)
 	if err != nil {
 		return nil, err
 	}
-	rightN, err := isNumber(right)
-	if err != nil {
+	return &value[float64]{pos: o.pos, v: v}, nil
+}
+
+// elementwise applies the operator to each element of operands that are
+// triples or quadruples, using operands that are numbers for every element.
+// If neither operand is a triple or quadruple err is returned.
+func (o *op) elementwise(state State, err error) (Node, error) {
+	left, lErr := o.left.Eval(state)
+	if lErr != nil {
+		return nil, lErr
+	}
+	right, rErr := o.right.Eval(state)
+	if rErr != nil {
+		return nil, rErr
+	}
+	ls, rs := vectorElements(left), vectorElements(right)
+	switch {
+	case ls == nil && rs == nil:
 		return nil, err
+	case ls == nil:
+		ls = slices.Repeat([]Node{left}, len(rs))
+	case rs == nil:
+		rs = slices.Repeat([]Node{right}, len(ls))
+	case len(ls) != len(rs):
+		return nil, fmt.Errorf("%s at %s:%d has a triple and a quadruple as operands", o, o.File(), o.Line())
+	}
+
+	values := make([]Node, len(ls))
+	for i := range values {
+		l, err := isNumber(ls[i])
+		if err != nil {
+			return nil, err
+		}
+		r, err := isNumber(rs[i])
+		if err != nil {
+			return nil, err
+		}
+		v, err := o.arithmetic(l, r)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = &value[float64]{pos: o.pos, v: v}
+	}
+	if len(values) == 3 {
+		return &triple{pos: o.pos, one: values[0], two: values[1], three: values[2]}, nil
+	}
+	return &quad{pos: o.pos, one: values[0], two: values[1], three: values[2], four: values[3]}, nil
+}
+
+func (o *op) EvalNum(state State) (float64, error) {
+	if o.comparison() {
+		v, err := o.EvalBool(state)
+		if err != nil {
+			return 0, err
+		}
+		return isNumber(&value[bool]{pos: o.pos, v: v})
+	}
+	left, right, err := o.operands(state)
+	if err != nil {
+		return 0, err
 	}
-	var result any
+	return o.arithmetic(left, right)
+}
+
+func (o *op) arithmetic(left, right float64) (float64, error) {
 	switch o.t {
 	case add:
-		result = leftN + rightN
+		return left + right, nil
 	case sub:
-		result = leftN - rightN
+		return left - right, nil
 	case mul:
-		result = leftN * rightN
+		return left * right, nil
 	case div:
-		result = leftN / rightN
+		return left / right, nil
 	case mod:
-		result = math.Mod(leftN, rightN)
+		return math.Mod(left, right), nil
+	}
+	return 0, fmt.Errorf("%q operator is not handled", o.t)
+}
+
+func (o *op) EvalBool(state State) (bool, error) {
+	if !o.comparison() {
+		v, err := o.EvalNum(state)
+		if err != nil {
+			return false, err
+		}
+		return isBoolean(&value[float64]{pos: o.pos, v: v})
+	}
+	left, right, err := o.operands(state)
+	if err != nil {
+		return false, err
+	}
+	switch o.t {
 	case gt:
-		result = leftN > rightN
+		return left > right, nil
 	case ge:
-		result = leftN >= rightN
+		return left >= right, nil
 	case lt:
-		result = leftN < rightN
-	case le:
-		result = leftN <= rightN
-	}
-	switch v := result.(type) {
-	case float64:
-		return &value[float64]{pos: o.pos, v: v}, nil
-	case bool:
-		return &value[bool]{pos: o.pos, v: v}, nil
+		return left < right, nil
 	}
-	return nil, fmt.Errorf("%q operator is not handled", o.t)
+	return left <= right, nil
 }
 
 func Add(left, right Node) Node { return &op{pos: p(), t: add, left: left, right: right} }
@@ -354,6 +517,152 @@ func IsRoot(n Node) (float64, float64, float64, error) {
 	return one, two, three, nil
 }
 
+type quad struct {
+	pos
+	one   Node
+	two   Node
+	three Node
+	four  Node
+}
+
+func (q *quad) String() string {
+	return fmt.Sprintf("(%s, %s, %s, %s)", q.one, q.two, q.three, q.four)
+}
+
+func (q *quad) Eval(state State) (Node, error) {
+	one, err := q.one.Eval(state)
+	if err != nil {
+		return nil, err
+	}
+	two, err := q.two.Eval(state)
+	if err != nil {
+		return nil, err
+	}
+	three, err := q.three.Eval(state)
+	if err != nil {
+		return nil, err
+	}
+	four, err := q.four.Eval(state)
+	if err != nil {
+		return nil, err
+	}
+	return &quad{
+		pos:   q.pos,
+		one:   one,
+		two:   two,
+		three: three,
+		four:  four,
+	}, nil
+}
+
+func Quad(one, two, three, four Node) Node {
+	return &quad{pos: p(), one: one, two: two, three: three, four: four}
+}
+
+// Color returns an evaluated quadruple at the given position. It is cheaper
+// than Quad for Nodes implemented outside this package that are evaluated per
+// pixel, as the caller's position doesn't need to be recovered.
+func Color(r, g, b, a float64, at Pos) Node {
+	p := pos{file: at.File(), line: at.Line()}
+	return &quad{
+		pos:   p,
+		one:   &value[float64]{pos: p, v: r},
+		two:   &value[float64]{pos: p, v: g},
+		three: &value[float64]{pos: p, v: b},
+		four:  &value[float64]{pos: p, v: a},
+	}
+}
+
+// IsRGBA is IsRoot but also accepts quadruples, whose fourth value is alpha.
+// Triples are fully opaque.
+func IsRGBA(n Node) (float64, float64, float64, float64, error) {
+	q, ok := n.(*quad)
+	if !ok {
+		r, g, b, err := IsRoot(n)
+		return r, g, b, 1, err
+	}
+	one, err := isNumber(q.one)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	two, err := isNumber(q.two)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	three, err := isNumber(q.three)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	four, err := isNumber(q.four)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	return one, two, three, four, nil
+}
+
+type named struct {
+	pos
+	names  []string
+	values []Node
+}
+
+func (n *named) String() string {
+	var b strings.Builder
+	b.WriteRune('{')
+	for i, name := range n.names {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(name)
+		b.WriteString(": ")
+		b.WriteString(n.values[i].String())
+	}
+	b.WriteRune('}')
+	return b.String()
+}
+
+func (n *named) Eval(state State) (Node, error) {
+	values := make([]Node, len(n.values))
+	for i, v := range n.values {
+		var err error
+		if values[i], err = v.Eval(state); err != nil {
+			return nil, err
+		}
+	}
+	return &named{pos: n.pos, names: n.names, values: values}, nil
+}
+
+func Named(names []string, values []Node) Node {
+	if len(names) != len(values) {
+		panic(fmt.Errorf("%d names given for %d named outputs", len(names), len(values)))
+	}
+	return &named{pos: p(), names: names, values: values}
+}
+
+// OutputNames returns the names of the outputs declared by the given root, or
+// nil if the root is a plain triple.
+func OutputNames(n Node) []string {
+	if n, ok := n.(*named); ok {
+		return n.names
+	}
+	return nil
+}
+
+// IsOutput returns the colour of the i-th output of an evaluated root. Roots
+// and named outputs can either be triples, quadruples or numbers, which are
+// treated as greyscale.
+func IsOutput(n Node, i int) (float64, float64, float64, float64, error) {
+	if nn, ok := n.(*named); ok {
+		n = nn.values[i]
+	} else if i != 0 {
+		return 0, 0, 0, 0, fmt.Errorf("%s does not have named outputs", n)
+	}
+	if v, err := isNumber(n); err == nil {
+		return v, v, v, 1, nil
+	}
+	return IsRGBA(n)
+}
+
 type ifThenElse struct {
 	pos
 	cond      Node
@@ -365,19 +674,39 @@ func (i *ifThenElse) String() string {
 	return fmt.Sprintf("if %s then %s else %s", i.cond, i.then, i.otherwise)
 }
 
-func (i *ifThenElse) Eval(state State) (Node, error) {
-	cond, err := i.cond.Eval(state)
+func (i *ifThenElse) branch(state State) (Node, error) {
+	c, err := evalBoolean(i.cond, state)
 	if err != nil {
 		return nil, err
 	}
-	c, err := isBoolean(cond)
+	if c {
+		return i.then, nil
+	}
+	return i.otherwise, nil
+}
+
+func (i *ifThenElse) Eval(state State) (Node, error) {
+	branch, err := i.branch(state)
 	if err != nil {
 		return nil, err
 	}
-	if c {
-		return i.then.Eval(state)
+	return branch.Eval(state)
+}
+
+func (i *ifThenElse) EvalNum(state State) (float64, error) {
+	branch, err := i.branch(state)
+	if err != nil {
+		return 0, err
+	}
+	return evalNumber(branch, state)
+}
+
+func (i *ifThenElse) EvalBool(state State) (bool, error) {
+	branch, err := i.branch(state)
+	if err != nil {
+		return false, err
 	}
-	return i.otherwise.Eval(state)
+	return evalBoolean(branch, state)
 }
 
 func If(cond, then, otherwise Node) Node {
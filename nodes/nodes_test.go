@@ -0,0 +1,224 @@
+package nodes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestS(t *testing.T) {
+	for _, test := range []struct {
+		name                string
+		x, y, width, height int
+		frame, frames       int
+		wantX, wantY, wantF float64
+	}{
+		{"first pixel", 0, 0, 4, 4, 0, 4, -1, -1, -1},
+		{"last pixel", 3, 3, 4, 4, 3, 4, 1, 1, 1},
+		{"middle pixel", 2, 1, 5, 3, 1, 3, 0, 0, 0},
+		{"single pixel", 0, 0, 1, 1, 0, 1, 0, 0, 0},
+		{"single column", 0, 2, 1, 3, 0, 2, 0, 1, -1},
+		{"single row", 2, 0, 3, 1, 1, 2, 1, 0, 1},
+		{"single frame", 0, 1, 2, 2, 0, 1, -1, 1, 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s := S(test.x, test.y, test.width, test.height, test.frame, test.frames, color.White)
+			for _, c := range []struct {
+				component string
+				got, want float64
+			}{
+				{"x", s.X, test.wantX},
+				{"y", s.Y, test.wantY},
+				{"f", s.F, test.wantF},
+			} {
+				if math.IsNaN(c.got) || math.IsInf(c.got, 0) || c.got != c.want {
+					t.Errorf("%s = %v, want %v", c.component, c.got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSFSinglePixelSubPixel(t *testing.T) {
+	s := SF(0.25, -0.25, 1, 1, 0, 1, color.White)
+	if s.X != 0 || s.Y != 0 || s.F != 0 {
+		t.Errorf("got %v, %v, %v, want the centre", s.X, s.Y, s.F)
+	}
+}
+
+func TestParseCached(t *testing.T) {
+	const src = "E ::= {C, C, C} %1 .\nC ::= x %0.3 | add(C, C) %0.3 | if gt(x, y) then C else ? %0.2 | let V = C in mul(V, V) %0.2 .\n"
+	dir := t.TempDir()
+	parsed, err := ParseCached(strings.NewReader(src), "test.bnf", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.gob")); len(files) != 1 {
+		t.Fatalf("got %d cached grammars, want 1", len(files))
+	}
+	cached, err := ParseCached(strings.NewReader(src), "test.bnf", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached.String() != parsed.String() || cached.SHA256() != parsed.SHA256() {
+		t.Errorf("got %s from the cache, want %s", cached, parsed)
+	}
+	a, _, err := parsed.Gen(WithSeeds(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _, err := cached.Gen(WithSeeds(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.String() != b.String() {
+		t.Errorf("generated %s from the cached grammar, want %s", b, a)
+	}
+}
+
+func TestGenWithoutTracer(t *testing.T) {
+	g, err := Parse(strings.NewReader("E ::= {C, C, C} %1 .\nC ::= x %0.5 | add(C, C) %0.5 .\n"), "test.bnf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = g.Gen(FromOptions(GeneratorOptions{Seed: 1, MaxDepth: 10, MaxGenerationTries: 10})); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGenBestCancelled(t *testing.T) {
+	g, err := Parse(strings.NewReader("E ::= {C, C, C} %1 .\nC ::= x %0.5 | add(C, C) %0.5 .\n"), "test.bnf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	score := func(Node, image.Image) float64 { return 0 }
+	if _, _, err = g.GenBest(ctx, 3, score, WithSeeds(1)); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want the context's error", err)
+	}
+	if _, _, err = g.GenBest(context.Background(), 3, score, WithSeeds(1)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFromJSONSchema(t *testing.T) {
+	// Options saved before the schema was recorded.
+	var o GeneratorOptions
+	if err := FromJSON(strings.NewReader(`{"seed": 7, "max_depth": 4, "max_generation_tries": 2}`))(&o); err != nil {
+		t.Fatal(err)
+	}
+	if o.Seed != 7 || o.MaxDepth != 4 || o.MaxGenerationTries != 2 || o.Schema != OptionsSchema {
+		t.Errorf("got %+v from unversioned options", o)
+	}
+	data, err := json.Marshal(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), fmt.Sprintf(`"schema":%d`, OptionsSchema)) {
+		t.Errorf("got %s, want the schema to be encoded", data)
+	}
+	newer := fmt.Sprintf(`{"seed": 7, "max_depth": 4, "max_generation_tries": 2, "schema": %d}`, OptionsSchema+1)
+	if err = FromJSON(strings.NewReader(newer))(&o); err == nil {
+		t.Error("decoded options from a newer schema")
+	}
+}
+
+func TestToGo(t *testing.T) {
+	for _, test := range []struct {
+		expr, want string
+	}{
+		{"(div(0, 0), div(1, 0), div(-1, 0))", "return math.NaN(), math.Inf(1), math.Inf(-1)"},
+		{"(x, y, f, -0.5)", "(float64, float64, float64, float64) {"},
+		{"if lt(x, 0) then (x, y, f, 1) else (y, x, f, 0)", "return y, x, f, 0"},
+	} {
+		root, err := ParseExpression(strings.NewReader(test.expr), "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ToGo(root)
+		if err != nil {
+			t.Fatalf("%s: %v", test.expr, err)
+		}
+		if !strings.Contains(got, test.want) {
+			t.Errorf("got %s for %s, want %s in it", got, test.expr, test.want)
+		}
+	}
+	root, err := ParseExpression(strings.NewReader("if lt(x, 0) then (x, y, f) else (y, x, f, 0)"), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ToGo(root); err == nil {
+		t.Errorf("got %s for a root with a triple and a quadruple", got)
+	}
+}
+
+func TestParseExpressionRoundTrip(t *testing.T) {
+	const src = `E ::= {colour: T, mask: C} %0.5 | T %0.5 .
+T ::= {C, C, C} %0.5 | swizzle({C, C, C, C}, "zyx") %0.25 | warp(T, C, C) %0.25 .
+C ::= A %0.3 | add(C, C) %0.15 | mul(C, C) %0.1 | if gt(C, C) then C else C %0.15 | let V = C in mul(V, V) %0.1 | voronoi(C, C) %0.05 | first(T) %0.1 | $speed %0.05 .
+A ::= ? %0.25 | x %0.25 | y %0.25 | f %0.25 .
+`
+	g, err := Parse(strings.NewReader(src), "test.bnf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for seed := range uint64(300) {
+		root, _, err := g.Gen(WithSeeds(seed), WithMaxDepth(6))
+		if err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+		printed := root.String()
+		parsed, err := ParseExpression(strings.NewReader(printed), "printed")
+		if err != nil {
+			t.Fatalf("seed %d: could not parse %s: %v", seed, printed, err)
+		}
+		if parsed.String() != printed {
+			t.Fatalf("seed %d: %s printed as %s once parsed", seed, printed, parsed)
+		}
+		params := map[string]float64{"speed": 0.5}
+		bound, parsedBound := Bind(root, params), Bind(parsed, params)
+		for _, xy := range [][2]int{{0, 0}, {1, 2}, {3, 3}} {
+			s := S(xy[0], xy[1], 4, 4, 0, 1, color.White)
+			want, wantErr := bound.Eval(s)
+			got, gotErr := parsedBound.Eval(s)
+			if (gotErr != nil) != (wantErr != nil) || gotErr == nil && got.String() != want.String() {
+				t.Fatalf("seed %d: %s evaluated to %v, %v at %v once parsed, want %v, %v", seed, printed, got, gotErr, xy, want, wantErr)
+			}
+		}
+	}
+}
+
+func TestBranchTracer(t *testing.T) {
+	const expr = "(if lt(x, 0) then x else y, if lt(y, 0) then y else x, f)"
+	branches := func() []Branch {
+		root, err := ParseExpression(strings.NewReader(expr), "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := NewBranchTracer(root).Branches(S(0, 7, 8, 8, 0, 1, color.White))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	a, b := branches(), branches()
+	if len(a) != 2 || len(b) != 2 {
+		t.Fatalf("got %d and %d branches, want 2", len(a), len(b))
+	}
+	for i := range a {
+		if a[i].Index != b[i].Index || a[i].Then != b[i].Then {
+			t.Errorf("branch %d is %d %t and %d %t when parsed again", i, a[i].Index, a[i].Then, b[i].Index, b[i].Then)
+		}
+	}
+	if !a[0].Then || a[1].Then || a[0].Index == a[1].Index {
+		t.Errorf("got branches %+v, want the first then and the second else at different indexes", a)
+	}
+}
@@ -0,0 +1,69 @@
+package nodes
+
+import "slices"
+
+// param is a named parameter whose value is given at render time with Bind.
+// Parameters that aren't bound are 0.
+type param struct {
+	pos
+	name string
+}
+
+func (p *param) String() string {
+	return "$" + p.name
+}
+
+func (p *param) Eval(state State) (Node, error) {
+	return &value[float64]{pos: p.pos, v: 0}, nil
+}
+
+func (p *param) EvalNum(state State) (float64, error) {
+	return 0, nil
+}
+
+func (p *param) evalRow(a *Arena, states []State) (*row, error) {
+	r := a.newRow(numberRow, len(states))
+	clear(r.nums[0])
+	return r, nil
+}
+
+// Bind returns a copy of the root with each parameter that has a value in
+// params replaced by that value. Parameters without a value are left as they
+// are and evaluate to 0. Binding before Hoist lets parameters be folded.
+func Bind(root Node, params map[string]float64) Node {
+	if len(params) == 0 {
+		return root
+	}
+	if p, ok := root.(*param); ok {
+		if v, ok := params[p.name]; ok {
+			return &value[float64]{pos: p.pos, v: v}
+		}
+		return p
+	}
+	cs := children(root)
+	if cs == nil {
+		return root
+	}
+	bound := make([]Node, len(cs))
+	changed := false
+	for i, c := range cs {
+		bound[i] = Bind(c, params)
+		changed = changed || bound[i] != c
+	}
+	if !changed {
+		return root
+	}
+	return withChildren(root, bound)
+}
+
+// Params returns the names of the parameters used by the root in the order
+// that they are first used.
+func Params(root Node) []string {
+	var names []string
+	walk(root, func(n Node) {
+		if p, ok := n.(*param); ok && !slices.Contains(names, p.name) {
+			names = append(names, p.name)
+		}
+	})
+	return names
+}
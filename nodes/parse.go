@@ -0,0 +1,270 @@
+package nodes
+
+import (
+	"errors"
+	"fmt"
+	"github.com/alecthomas/participle/v2"
+	"github.com/alecthomas/participle/v2/lexer"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// productionStart matches the productions that begin lines, which is where
+// parsing resumes after a syntax error.
+var productionStart = regexp.MustCompile(`(?m)^[ \t]*[A-Z][A-Za-z0-9_]*[ \t]*(\([^)\n]*\))?\s::=\s`)
+
+// parseProductions parses the productions that begin each line of the source
+// separately, so that the errors of every production are returned, joined,
+// rather than only the first. Each is parsed after as many blank lines as
+// precede it, so that positions are those in the source.
+func parseProductions(src, filename string) (*Grammar, error) {
+	starts := []int{0}
+	for _, loc := range productionStart.FindAllStringIndex(src, -1) {
+		if loc[0] > 0 {
+			starts = append(starts, loc[0])
+		}
+	}
+	starts = append(starts, len(src))
+
+	var (
+		g     = &Grammar{}
+		errs  []error
+		lines int
+	)
+	for i, start := range starts[:len(starts)-1] {
+		chunk := src[start:starts[i+1]]
+		padding := strings.Repeat("\n", lines)
+		lines += strings.Count(chunk, "\n")
+		if strings.TrimSpace(chunk) == "" {
+			continue
+		}
+		parsed, err := grammarParser().ParseString(filename, padding+chunk)
+		if err != nil {
+			errs = append(errs, syntaxError(err, src))
+			continue
+		}
+		if len(g.Productions) == 0 {
+			g.Pos = parsed.Pos
+		}
+		for _, p := range parsed.Productions {
+			for _, a := range p.Alternatives {
+				if err = checkAlternate(a.Alternate); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+		g.Productions = append(g.Productions, parsed.Productions...)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if len(g.Productions) == 0 {
+		return nil, fmt.Errorf("%s: the grammar has no productions", filename)
+	}
+	return g, nil
+}
+
+// SyntaxError is an error in the syntax of a grammar, described without the
+// parser's names for tokens, along with the line it is in and a hint at how to
+// fix it if there is one.
+type SyntaxError struct {
+	Pos     lexer.Position
+	Message string
+	// Line is the line of the grammar at Pos.
+	Line string
+	Hint string
+	err  error
+}
+
+func (e *SyntaxError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s", e.Pos, e.Message)
+	if e.Line != "" {
+		// Tabs are kept so that the caret lines up with the column.
+		caret := []rune(e.Line)[:min(max(e.Pos.Column-1, 0), len([]rune(e.Line)))]
+		for i, r := range caret {
+			if r != '\t' {
+				caret[i] = ' '
+			}
+		}
+		fmt.Fprintf(&b, "\n    %s\n    %s^", e.Line, string(caret))
+	}
+	if e.Hint != "" {
+		fmt.Fprintf(&b, "\n    hint: %s", e.Hint)
+	}
+	return b.String()
+}
+
+// Unwrap returns the error of the parser.
+func (e *SyntaxError) Unwrap() error {
+	return e.err
+}
+
+// tokenNames are how the parser's token names are described.
+var tokenNames = map[string]string{
+	"<comma>":            `","`,
+	"<dot>":              `"."`,
+	"<pipe>":             `"|"`,
+	"<percent>":          `"%"`,
+	"<lparen>":           `"("`,
+	"<rparen>":           `")"`,
+	"<lcurly>":           `"{"`,
+	"<rcurly>":           `"}"`,
+	"<equals>":           `"="`,
+	"<productionequals>": `"::="`,
+	"<then>":             `"then"`,
+	"<else>":             `"else"`,
+	"<in>":               `"in"`,
+	"<number>":           "a number",
+	"<string>":           "a string",
+	"<ident>":            "a production name",
+	"Alternate":          "an alternate",
+	"AlternateWithProb":  "an alternative",
+	"Production":         "a production",
+}
+
+// syntaxError returns the error of the parser as a SyntaxError, with hints
+// for common mistakes, if it has a position.
+func syntaxError(err error, src string) error {
+	var perr participle.Error
+	if !errors.As(err, &perr) {
+		return err
+	}
+	e := &SyntaxError{Pos: perr.Position(), Message: perr.Message(), err: err}
+	lines := strings.Split(src, "\n")
+
+	var (
+		unexpected *participle.UnexpectedTokenError
+		lexErr     *lexer.Error
+	)
+	switch {
+	case errors.As(err, &unexpected):
+		// The parser only gives what it expected in the message.
+		_, expected, _ := strings.Cut(unexpected.Message(), " (expected ")
+		expected = firstExpected(strings.TrimSuffix(expected, ")"))
+		if unexpected.Unexpected.EOF() {
+			e.Message = "unexpected end of production"
+			// Point after the end of the last line of the production with
+			// anything on it, as the end is at the start of the next.
+			line := min(e.Pos.Line, len(lines))
+			if e.Pos.Column == 1 {
+				line--
+			}
+			line = max(line, 1)
+			for line > 1 && strings.TrimSpace(lines[line-1]) == "" {
+				line--
+			}
+			e.Pos.Line, e.Pos.Column = line, len([]rune(strings.TrimRight(lines[line-1], " \t\r")))+1
+		} else {
+			e.Message = fmt.Sprintf("unexpected %q", unexpected.Unexpected.Value)
+		}
+		if expected != "" {
+			e.Message += ", expected " + expected
+		}
+		e.Hint = unexpectedHint(unexpected.Unexpected, expected)
+	case errors.As(err, &lexErr) && e.Pos.Line >= 1 && e.Pos.Line <= len(lines):
+		line := []rune(lines[e.Pos.Line-1])
+		col := min(max(e.Pos.Column-1, 0), len(line))
+		text := string(line[col:])
+		invalid := identifier.FindString(text)
+		if invalid == "" && text != "" {
+			invalid = string(line[col])
+		}
+		e.Message = fmt.Sprintf("unexpected %q", invalid)
+		e.Hint = invalidTextHint(string(line[:col]), text, invalid)
+	}
+	if line := e.Pos.Line; line >= 1 && line <= len(lines) {
+		e.Line = strings.TrimRight(lines[line-1], "\r")
+	}
+	return e
+}
+
+// firstExpected returns a description of the first token of what the parser
+// expected, such as "a number" for "<number> <dot>".
+func firstExpected(expect string) string {
+	first, _, _ := strings.Cut(strings.TrimLeft(expect, "("), " ")
+	first = strings.TrimRight(first, ")?*+")
+	if name, ok := tokenNames[first]; ok {
+		return name
+	}
+	return first
+}
+
+func unexpectedHint(t lexer.Token, expected string) string {
+	switch {
+	case expected == `"."` && t.EOF():
+		return `did you forget the terminating "." of the production?`
+	case expected == `"%"`:
+		return "every alternative needs a weight after it, such as x %0.5"
+	case expected == `","` && t.Value == ")":
+		return "too few arguments were given, operators such as add take two"
+	case expected == `","` && t.Value == "}":
+		return "triples have three elements and quadruples four, such as {x, y, f}"
+	case expected == `")"` && t.Value == ",":
+		return "too many arguments were given"
+	case expected == `")"`:
+		return `did you forget a closing ")"?`
+	case expected == `"else"`:
+		return "if needs both a then and an else, such as if lt(x, y) then x else y"
+	case expected == `"."` && t.Value == "|":
+		return `every "|" needs an alternative after it`
+	case t.Value == "|":
+		return `a production ends at its ".", so no alternatives can follow it`
+	case t.Value == ".":
+		return `a production ends at its first "."`
+	}
+	return ""
+}
+
+// identifier matches the identifier that invalid text starts with.
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*`)
+
+// invalidTextHint returns a hint for the text of a line that couldn't be
+// lexed, given what precedes it and the name that it starts with if any.
+func invalidTextHint(before, text, name string) string {
+	after := strings.TrimSpace(text[len(name):])
+	switch {
+	case strings.HasSuffix(strings.TrimSpace(before), "%"):
+		return "weights must be numbers, such as %0.5"
+	case name == "" || !identifier.MatchString(name):
+		return ""
+	case strings.HasPrefix(after, "::="):
+		return "production names must start with an uppercase letter"
+	case strings.HasSuffix(strings.TrimSpace(before), "let"):
+		return "names given by let must start with an uppercase letter"
+	case strings.HasPrefix(after, "("):
+		return "operators are " + strings.Join(operatorNames(), ", ")
+	}
+	return "components are " + strings.Join(componentNames(), ", ") + ", and production names start with an uppercase letter"
+}
+
+// operatorNames returns the names of the built in and registered operators.
+func operatorNames() []string {
+	names := []string{"first", "second", "third", "fourth", "swizzle", "warp", "voronoi", "cell"}
+	for _, op := range opTypes() {
+		names = append(names, string(op))
+	}
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	for name := range customOps {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// componentNames returns the names of the built in and registered components.
+func componentNames() []string {
+	var names []string
+	for _, c := range componentTypes() {
+		names = append(names, string(c))
+	}
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	for name := range customComponents {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
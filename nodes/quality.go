@@ -0,0 +1,158 @@
+package nodes
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"image"
+	"image/color"
+	"math"
+	"runtime"
+	"sync"
+)
+
+// entropySize is the width and height of the thumbnails that Entropy measures.
+const entropySize = 32
+
+// thumbnailSize is the width and height of the thumbnails that GenBest scores.
+const thumbnailSize = 64
+
+// thumbnails renders the first frame of each output of the root at size by
+// size pixels, quantising colours the same way as the renderer.
+func thumbnails(root Node, size int) ([]*image.NRGBA, error) {
+	outputs := max(len(OutputNames(root)), 1)
+	states := make([]State, size*size)
+	for y := range size {
+		for x := range size {
+			// The first frame of an animation, where f is -1, rather than
+			// a single frame, where it is 0.
+			states[y*size+x] = S(x, y, size, size, 0, 2, color.White)
+		}
+	}
+	out := make([][4]float64, len(states)*outputs)
+	if err := EvalRow(root, states, out); err != nil {
+		return nil, err
+	}
+
+	imgs := make([]*image.NRGBA, outputs)
+	for o := range imgs {
+		imgs[o] = image.NewNRGBA(image.Rect(0, 0, size, size))
+		for i := range states {
+			c := out[i*outputs+o]
+			imgs[o].SetNRGBA(i%size, i/size, color.NRGBA{
+				R: uint8((c[0] + 1) / 2 * 255),
+				G: uint8((c[1] + 1) / 2 * 255),
+				B: uint8((c[2] + 1) / 2 * 255),
+				A: uint8((c[3] + 1) / 2 * 255),
+			})
+		}
+	}
+	return imgs, nil
+}
+
+// Entropy returns the Shannon entropy, in bits, of the colours of the root at
+// a 32x32 grid of states covering the first frame. Each channel is quantised
+// to 16 levels first, so an image of a single colour has an entropy of 0 and
+// one where every pixel has a different colour has an entropy of 10. Roots
+// with named outputs have the lowest entropy of any of their outputs.
+func Entropy(root Node) (float64, error) {
+	imgs, err := thumbnails(root, entropySize)
+	if err != nil {
+		return 0, err
+	}
+
+	entropy := math.Inf(1)
+	for _, img := range imgs {
+		histogram := make(map[[3]uint8]int)
+		for i := 0; i < len(img.Pix); i += 4 {
+			histogram[[3]uint8{img.Pix[i] >> 4, img.Pix[i+1] >> 4, img.Pix[i+2] >> 4}]++
+		}
+		var e float64
+		for _, n := range histogram {
+			p := float64(n) / float64(entropySize*entropySize)
+			e -= p * math.Log2(p)
+		}
+		entropy = min(entropy, e)
+	}
+	return entropy, nil
+}
+
+// GenBest generates n expressions, starting at the seed in the options, and
+// returns the one given the highest score. Each expression starts at the seed
+// after the last that was tried for the one before, so none are generated from
+// the same seed. Each expression is scored alongside a 64x64 thumbnail of its
+// first frame, or of its first output for roots with named outputs. Scoring
+// happens concurrently, so score must be safe to call from multiple
+// goroutines. Expressions that fail to generate or evaluate are skipped. It
+// gives up once the context is done.
+func (g *Grammar) GenBest(ctx context.Context, n int, score func(root Node, thumbnail image.Image) float64, opts ...GeneratorOption) (Node, *GeneratorState, error) {
+	if n <= 0 {
+		return nil, nil, fmt.Errorf("number of candidates must be positive")
+	}
+	options := defaultGeneratorOptions()
+	for _, opt := range opts {
+		if err := opt(options); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	type candidate struct {
+		root  Node
+		state *GeneratorState
+		score float64
+		err   error
+	}
+	var (
+		candidates = make([]candidate, n)
+		wg         sync.WaitGroup
+		sem        = make(chan struct{}, runtime.NumCPU())
+	)
+	seed := options.Seed
+	for i := range candidates {
+		if ctx.Err() != nil {
+			break
+		}
+		c := &candidates[i]
+		// Generation sorts the grammar's alternatives so can't be done
+		// concurrently.
+		o := *options
+		o.Seed = seed
+		if c.root, c.state, c.err = g.GenContext(ctx, FromOptions(o)); c.err != nil {
+			seed += uint64(o.MaxGenerationTries)
+			continue
+		}
+		// Rejected tries advance the seed, so the next candidate starts after
+		// the one that was accepted.
+		seed = c.state.Seed + 1
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			imgs, err := thumbnails(c.root, thumbnailSize)
+			if err != nil {
+				c.err = err
+				return
+			}
+			c.score = score(c.root, imgs[0])
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	best := -1
+	for i, c := range candidates {
+		if c.err == nil && (best < 0 || c.score > candidates[best].score) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil, nil, errors.Wrapf(candidates[n-1].err, "none of the %d candidates could be generated", n)
+	}
+	return candidates[best].root, candidates[best].state, nil
+}
@@ -0,0 +1,495 @@
+package nodes
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ErrDeadlineExceeded is returned by EvalRow when evaluating the row takes
+// past the arena's Deadline.
+var ErrDeadlineExceeded = errors.New("evaluating the row took too long")
+
+type rowKind int
+
+const (
+	numberRow rowKind = iota
+	booleanRow
+	tripleRow
+	quadRow
+	namedRow
+)
+
+// row is the value of a node at each state of a row.
+type row struct {
+	kind  rowKind
+	nums  [4][]float64
+	bools []bool
+	named []*row
+}
+
+// slab hands out slices from large chunks which are reused once reset.
+type slab[T any] struct {
+	chunks [][]T
+	chunk  int
+	used   int
+}
+
+func (s *slab[T]) alloc(n int) []T {
+	for ; s.chunk < len(s.chunks); s.chunk, s.used = s.chunk+1, 0 {
+		if c := s.chunks[s.chunk]; len(c)-s.used >= n {
+			s.used += n
+			return c[s.used-n : s.used : s.used]
+		}
+	}
+	c := make([]T, max(n, 256))
+	s.chunks = append(s.chunks, c)
+	s.used = n
+	return c[:n:n]
+}
+
+func (s *slab[T]) reset() {
+	s.chunk, s.used = 0, 0
+}
+
+// Arena holds the temporaries created while evaluating rows so that they can
+// be reused by the next row rather than garbage collected. An Arena must not be
+// used concurrently.
+type Arena struct {
+	// FastMath swaps exact but slow functions, such as mod, for cheaper
+	// approximations.
+	FastMath bool
+	// Deadline is when evaluating a row gives up with ErrDeadlineExceeded,
+	// unless it is zero. It is checked before evaluating each node, so a
+	// single node that takes long isn't stopped.
+	Deadline time.Time
+
+	rows   slab[row]
+	named  slab[*row]
+	floats slab[float64]
+	bools  slab[bool]
+	states slab[State]
+	memo   map[memoKey]*row
+}
+
+func (a *Arena) pastDeadline() bool {
+	return !a.Deadline.IsZero() && time.Now().After(a.Deadline)
+}
+
+func (a *Arena) reset() {
+	a.rows.reset()
+	a.named.reset()
+	a.floats.reset()
+	a.bools.reset()
+	a.states.reset()
+	if a.memo == nil {
+		a.memo = make(map[memoKey]*row)
+	}
+	clear(a.memo)
+}
+
+func (a *Arena) row(kind rowKind) *row {
+	r := &a.rows.alloc(1)[0]
+	*r = row{kind: kind}
+	return r
+}
+
+func (a *Arena) newRow(kind rowKind, n int) *row {
+	r := a.row(kind)
+	switch kind {
+	case numberRow:
+		r.nums[0] = a.floats.alloc(n)
+	case booleanRow:
+		r.bools = a.bools.alloc(n)
+	case tripleRow, quadRow:
+		for i := range r.width() {
+			r.nums[i] = a.floats.alloc(n)
+		}
+	}
+	return r
+}
+
+func (r *row) width() int {
+	switch r.kind {
+	case tripleRow:
+		return 3
+	case quadRow:
+		return 4
+	}
+	return 1
+}
+
+// errRowUnsupported is returned when a node cannot be evaluated a row at a
+// time, either because it doesn't support it or because doing so would change
+// the result. Evaluation then falls back to Eval for each state.
+var errRowUnsupported = errors.New("node cannot be evaluated a row at a time")
+
+type rowNode interface {
+	evalRow(a *Arena, states []State) (*row, error)
+}
+
+type memoKey struct {
+	n      Node
+	states *State
+	len    int
+}
+
+// evalRow evaluates the node at the given states, reusing the row of any node
+// already evaluated at the same states. This is what makes evaluating the
+// subtrees shared by Dedupe cheap.
+func evalRow(a *Arena, n Node, states []State) (*row, error) {
+	rn, ok := n.(rowNode)
+	if !ok {
+		return nil, errRowUnsupported
+	}
+	switch n.(type) {
+	case *value[float64], *value[bool], *component:
+		return rn.evalRow(a, states)
+	}
+	if len(states) == 0 {
+		return rn.evalRow(a, states)
+	}
+
+	key := memoKey{n: n, states: &states[0], len: len(states)}
+	if r, ok := a.memo[key]; ok {
+		return r, nil
+	}
+	if a.pastDeadline() {
+		return nil, ErrDeadlineExceeded
+	}
+	r, err := rn.evalRow(a, states)
+	if err != nil {
+		return nil, err
+	}
+	a.memo[key] = r
+	return r, nil
+}
+
+func evalNumberRow(a *Arena, n Node, states []State) ([]float64, error) {
+	r, err := evalRow(a, n, states)
+	if err != nil {
+		return nil, err
+	}
+	if r.kind != numberRow {
+		return nil, errRowUnsupported
+	}
+	return r.nums[0], nil
+}
+
+func (v *value[T]) evalRow(a *Arena, states []State) (*row, error) {
+	switch v := any(v.v).(type) {
+	case float64:
+		r := a.newRow(numberRow, len(states))
+		for i := range r.nums[0] {
+			r.nums[0][i] = v
+		}
+		return r, nil
+	case bool:
+		r := a.newRow(booleanRow, len(states))
+		for i := range r.bools {
+			r.bools[i] = v
+		}
+		return r, nil
+	}
+	return nil, errRowUnsupported
+}
+
+func (c *component) evalRow(a *Arena, states []State) (*row, error) {
+	r := a.newRow(numberRow, len(states))
+	for i := range states {
+		r.nums[0][i] = states[i].component(c.ct)
+	}
+	return r, nil
+}
+
+func (o *op) evalRow(a *Arena, states []State) (*row, error) {
+	left, err := evalRow(a, o.left, states)
+	if err != nil {
+		return nil, err
+	}
+	right, err := evalRow(a, o.right, states)
+	if err != nil {
+		return nil, err
+	}
+	if left.kind == numberRow && right.kind == numberRow {
+		return o.numberRow(a, left.nums[0], right.nums[0])
+	}
+	if o.comparison() || left.kind == booleanRow || right.kind == booleanRow ||
+		left.kind == namedRow || right.kind == namedRow ||
+		left.kind != numberRow && right.kind != numberRow && left.kind != right.kind {
+		return nil, errRowUnsupported
+	}
+
+	// Triples and quadruples are operated on an element at a time, using
+	// numbers for every element.
+	kind := left.kind
+	if kind == numberRow {
+		kind = right.kind
+	}
+	r := a.row(kind)
+	for i := range r.width() {
+		l, rr := left.nums[0], right.nums[0]
+		if left.kind != numberRow {
+			l = left.nums[i]
+		}
+		if right.kind != numberRow {
+			rr = right.nums[i]
+		}
+		element, err := o.numberRow(a, l, rr)
+		if err != nil {
+			return nil, err
+		}
+		r.nums[i] = element.nums[0]
+	}
+	return r, nil
+}
+
+// numberRow applies the operator to rows of numbers.
+func (o *op) numberRow(a *Arena, left, right []float64) (*row, error) {
+	var r *row
+	switch o.t {
+	case add, sub, mul, div, mod:
+		r = a.newRow(numberRow, len(left))
+	default:
+		r = a.newRow(booleanRow, len(left))
+	}
+	nums, bools := r.nums[0], r.bools
+	switch o.t {
+	case add:
+		for i := range nums {
+			nums[i] = left[i] + right[i]
+		}
+	case sub:
+		for i := range nums {
+			nums[i] = left[i] - right[i]
+		}
+	case mul:
+		for i := range nums {
+			nums[i] = left[i] * right[i]
+		}
+	case div:
+		for i := range nums {
+			nums[i] = left[i] / right[i]
+		}
+	case mod:
+		if a.FastMath {
+			for i := range nums {
+				nums[i] = fastMod(left[i], right[i])
+			}
+			break
+		}
+		for i := range nums {
+			nums[i] = math.Mod(left[i], right[i])
+		}
+	case gt:
+		for i := range bools {
+			bools[i] = left[i] > right[i]
+		}
+	case ge:
+		for i := range bools {
+			bools[i] = left[i] >= right[i]
+		}
+	case lt:
+		for i := range bools {
+			bools[i] = left[i] < right[i]
+		}
+	case le:
+		for i := range bools {
+			bools[i] = left[i] <= right[i]
+		}
+	default:
+		return nil, fmt.Errorf("%q operator is not handled", o.t)
+	}
+	return r, nil
+}
+
+// fastMod is math.Mod without the care taken to stay exact when x is much
+// larger than y.
+func fastMod(x, y float64) float64 {
+	return x - y*math.Trunc(x/y)
+}
+
+func evalNumbersRow(a *Arena, kind rowKind, values []Node, states []State) (*row, error) {
+	r := a.row(kind)
+	for i, v := range values {
+		var err error
+		if r.nums[i], err = evalNumberRow(a, v, states); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (t *triple) evalRow(a *Arena, states []State) (*row, error) {
+	return evalNumbersRow(a, tripleRow, []Node{t.one, t.two, t.three}, states)
+}
+
+func (q *quad) evalRow(a *Arena, states []State) (*row, error) {
+	return evalNumbersRow(a, quadRow, []Node{q.one, q.two, q.three, q.four}, states)
+}
+
+func (n *named) evalRow(a *Arena, states []State) (*row, error) {
+	r := a.row(namedRow)
+	r.named = a.named.alloc(len(n.values))
+	for i, v := range n.values {
+		var err error
+		if r.named[i], err = evalRow(a, v, states); err != nil {
+			return nil, err
+		}
+		switch r.named[i].kind {
+		case numberRow, tripleRow, quadRow:
+		default:
+			return nil, errRowUnsupported
+		}
+	}
+	return r, nil
+}
+
+// evalRow evaluates each branch only at the states where it is taken, so that
+// errors in a branch that is never taken are not reported.
+func (i *ifThenElse) evalRow(a *Arena, states []State) (*row, error) {
+	cond, err := evalRow(a, i.cond, states)
+	if err != nil {
+		return nil, err
+	}
+	if cond.kind != booleanRow {
+		return nil, errRowUnsupported
+	}
+
+	thenStates, otherwiseStates := a.states.alloc(len(states))[:0], a.states.alloc(len(states))[:0]
+	for j, c := range cond.bools {
+		if c {
+			thenStates = append(thenStates, states[j])
+		} else {
+			otherwiseStates = append(otherwiseStates, states[j])
+		}
+	}
+	if len(otherwiseStates) == 0 {
+		return evalRow(a, i.then, states)
+	}
+	if len(thenStates) == 0 {
+		return evalRow(a, i.otherwise, states)
+	}
+
+	then, err := evalRow(a, i.then, thenStates)
+	if err != nil {
+		return nil, err
+	}
+	otherwise, err := evalRow(a, i.otherwise, otherwiseStates)
+	if err != nil {
+		return nil, err
+	}
+	if then.kind != otherwise.kind || then.kind == namedRow {
+		return nil, errRowUnsupported
+	}
+
+	r := a.newRow(then.kind, len(states))
+	var t, o int
+	for j, c := range cond.bools {
+		from, k := otherwise, o
+		if c {
+			from, k = then, t
+			t++
+		} else {
+			o++
+		}
+		if r.kind == booleanRow {
+			r.bools[j] = from.bools[k]
+			continue
+		}
+		for w := range r.width() {
+			r.nums[w][j] = from.nums[w][k]
+		}
+	}
+	return r, nil
+}
+
+// rgba writes the colour of the row at each state to out.
+func (r *row) rgba(out [][4]float64, stride, offset int) error {
+	switch r.kind {
+	case numberRow, tripleRow, quadRow:
+	default:
+		return errRowUnsupported
+	}
+	for i := range len(r.nums[0]) {
+		c := &out[i*stride+offset]
+		switch r.kind {
+		case numberRow:
+			v := r.nums[0][i]
+			*c = [4]float64{v, v, v, 1}
+		case tripleRow:
+			*c = [4]float64{r.nums[0][i], r.nums[1][i], r.nums[2][i], 1}
+		case quadRow:
+			*c = [4]float64{r.nums[0][i], r.nums[1][i], r.nums[2][i], r.nums[3][i]}
+		}
+	}
+	return nil
+}
+
+func evalOutputsRow(a *Arena, root Node, states []State, out [][4]float64, outputs int) error {
+	r, err := evalRow(a, root, states)
+	if err != nil {
+		return err
+	}
+	switch r.kind {
+	case numberRow, tripleRow, quadRow:
+		if outputs != 1 {
+			return errRowUnsupported
+		}
+		return r.rgba(out, 1, 0)
+	case namedRow:
+		if len(r.named) != outputs {
+			return errRowUnsupported
+		}
+		for o, nr := range r.named {
+			if err = nr.rgba(out, outputs, o); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return errRowUnsupported
+}
+
+// EvalRow evaluates the root at each of the given states at once, which is
+// much cheaper than calling Eval for each of them. The colour of output o at
+// the i-th state is written to out[i*outputs+o], where outputs is the number
+// of names returned by OutputNames or 1 for roots without named outputs.
+func EvalRow(root Node, states []State, out [][4]float64) error {
+	return new(Arena).EvalRow(root, states, out)
+}
+
+// EvalRow is EvalRow but reuses the temporaries of the previous row evaluated
+// in the arena.
+func (a *Arena) EvalRow(root Node, states []State, out [][4]float64) error {
+	a.reset()
+	outputs := max(len(OutputNames(root)), 1)
+	if len(out) != len(states)*outputs {
+		return fmt.Errorf("%d colours cannot hold %d outputs for %d states", len(out), outputs, len(states))
+	}
+	if len(states) == 0 {
+		return nil
+	}
+
+	err := evalOutputsRow(a, root, states, out, outputs)
+	if !errors.Is(err, errRowUnsupported) {
+		return err
+	}
+	for i, state := range states {
+		if a.pastDeadline() {
+			return ErrDeadlineExceeded
+		}
+		n, err := root.Eval(state)
+		if err != nil {
+			return err
+		}
+		for o := range outputs {
+			c := &out[i*outputs+o]
+			if c[0], c[1], c[2], c[3], err = IsOutput(n, o); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
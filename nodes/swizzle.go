@@ -0,0 +1,122 @@
+package nodes
+
+import (
+	"fmt"
+	"strings"
+)
+
+// elementNames are what the elements of triples and quadruples are called by
+// swizzles, in order.
+const elementNames = "xyzw"
+
+// elementFuncs are the names of the functions that pick a single element.
+var elementFuncs = []string{"first", "second", "third", "fourth"}
+
+// swizzle picks elements of a triple or quadruple by name, in any order. One
+// element is a number, three a triple and four a quadruple.
+type swizzle struct {
+	pos
+	t        Node
+	elements string
+}
+
+func (s *swizzle) String() string {
+	if len(s.elements) == 1 {
+		return fmt.Sprintf("%s(%s)", elementFuncs[strings.IndexByte(elementNames, s.elements[0])], s.t)
+	}
+	return fmt.Sprintf("swizzle(%s, %q)", s.t, s.elements)
+}
+
+// vectorElements returns the elements of a triple or quadruple, or nil if the
+// node is neither.
+func vectorElements(n Node) []Node {
+	switch n := n.(type) {
+	case *triple:
+		return []Node{n.one, n.two, n.three}
+	case *quad:
+		return []Node{n.one, n.two, n.three, n.four}
+	}
+	return nil
+}
+
+// pick returns the elements of the evaluated value that are swizzled.
+func (s *swizzle) pick(v Node) ([]Node, error) {
+	elements := vectorElements(v)
+	if elements == nil {
+		return nil, &ValidationError{Node: v, is: root}
+	}
+	picked := make([]Node, len(s.elements))
+	for i := range s.elements {
+		e := strings.IndexByte(elementNames, s.elements[i])
+		if e >= len(elements) {
+			return nil, fmt.Errorf("%s at %s:%d has no %s element", v, s.File(), s.Line(), elementFuncs[e])
+		}
+		picked[i] = elements[e]
+	}
+	return picked, nil
+}
+
+func (s *swizzle) Eval(state State) (Node, error) {
+	v, err := s.t.Eval(state)
+	if err != nil {
+		return nil, err
+	}
+	picked, err := s.pick(v)
+	if err != nil {
+		return nil, err
+	}
+	switch len(picked) {
+	case 1:
+		return picked[0], nil
+	case 3:
+		return &triple{pos: s.pos, one: picked[0], two: picked[1], three: picked[2]}, nil
+	}
+	return &quad{pos: s.pos, one: picked[0], two: picked[1], three: picked[2], four: picked[3]}, nil
+}
+
+func (s *swizzle) EvalNum(state State) (float64, error) {
+	v, err := s.Eval(state)
+	if err != nil {
+		return 0, err
+	}
+	return isNumber(v)
+}
+
+func (s *swizzle) evalRow(a *Arena, states []State) (*row, error) {
+	v, err := evalRow(a, s.t, states)
+	if err != nil {
+		return nil, err
+	}
+	if v.kind != tripleRow && v.kind != quadRow {
+		return nil, errRowUnsupported
+	}
+	r := a.row(numberRow)
+	switch len(s.elements) {
+	case 3:
+		r.kind = tripleRow
+	case 4:
+		r.kind = quadRow
+	}
+	for i := range s.elements {
+		e := strings.IndexByte(elementNames, s.elements[i])
+		if e >= v.width() {
+			// Eval reports the error.
+			return nil, errRowUnsupported
+		}
+		r.nums[i] = v.nums[e]
+	}
+	return r, nil
+}
+
+// checkElements returns an error if the elements can't be swizzled.
+func checkElements(elements string) error {
+	switch len(elements) {
+	case 1, 3, 4:
+	default:
+		return fmt.Errorf("%q must pick 1, 3 or 4 elements", elements)
+	}
+	if i := strings.IndexFunc(elements, func(r rune) bool { return !strings.ContainsRune(elementNames, r) }); i >= 0 {
+		return fmt.Errorf("%q has an element that isn't one of %s", elements, elementNames)
+	}
+	return nil
+}
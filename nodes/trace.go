@@ -0,0 +1,146 @@
+package nodes
+
+// TraceFunc is called by a traced root with every node that was evaluated, the
+// state it was evaluated at and what it evaluated to.
+type TraceFunc func(n Node, state State, result Node)
+
+// traced evaluates a copy of a node whose children are also traced and reports
+// the result as the original node's.
+type traced struct {
+	Node
+	from Node
+	fn   TraceFunc
+}
+
+func (t *traced) Eval(state State) (Node, error) {
+	result, err := t.Node.Eval(state)
+	if err != nil {
+		return nil, err
+	}
+	t.fn(t.from, state, result)
+	return result, nil
+}
+
+// Trace returns a copy of root that calls fn after each of its nodes is
+// evaluated, children before their parents. Only the branch of an if/then/else
+// that is taken is evaluated, so nodes that are never reached are never
+// traced. Traced roots can't be evaluated a row at a time, so are much slower
+// than the original.
+func Trace(root Node, fn TraceFunc) Node {
+	n := root
+	if cs := children(root); cs != nil {
+		tcs := make([]Node, len(cs))
+		for i, c := range cs {
+			tcs[i] = Trace(c, fn)
+		}
+		n = withChildren(root, tcs)
+	}
+	return &traced{Node: n, from: root, fn: fn}
+}
+
+// Branch is an if/then/else that was evaluated and whether its condition held.
+type Branch struct {
+	If Node
+	// Index is the position of If in a walk of the root, parents before their
+	// children, which is the same every time the root is parsed or generated.
+	Index int
+	Then  bool
+}
+
+// BranchTracer evaluates a root at states, returning the if/then/else that
+// were evaluated on the way. The traced copy of the root is built once, so it
+// suits evaluating every pixel of a frame, but a BranchTracer must not be used
+// concurrently.
+type BranchTracer struct {
+	traced   Node
+	index    map[Node]int
+	branches []Branch
+}
+
+func NewBranchTracer(root Node) *BranchTracer {
+	t := &BranchTracer{index: make(map[Node]int)}
+	i := 0
+	walk(root, func(n Node) {
+		if _, ok := t.index[n]; !ok {
+			t.index[n] = i
+		}
+		i++
+	})
+	t.traced = Trace(root, func(n Node, state State, _ Node) {
+		ite, ok := n.(*ifThenElse)
+		if !ok {
+			return
+		}
+		// The condition has already evaluated without error to get here.
+		c, _ := evalBoolean(ite.cond, state)
+		t.branches = append(t.branches, Branch{If: n, Index: t.index[n], Then: c})
+	})
+	return t
+}
+
+// Branches evaluates the root at the state and returns every if/then/else
+// that was evaluated on the way, in the order they finished evaluating. The
+// branches are only valid until Branches is next called.
+func (t *BranchTracer) Branches(state State) ([]Branch, error) {
+	t.branches = t.branches[:0]
+	_, err := t.traced.Eval(state)
+	return t.branches, err
+}
+
+// Branches evaluates root at the state and returns every if/then/else that was
+// evaluated on the way, in the order they finished evaluating.
+func Branches(root Node, state State) ([]Branch, error) {
+	return NewBranchTracer(root).Branches(state)
+}
+
+// Cost returns the number of nodes evaluated to evaluate root at the state,
+// which is every node but those in the branches of if/then/else not taken.
+func Cost(root Node, state State) (int, error) {
+	switch n := root.(type) {
+	case *op:
+		return costOf(state, n.left, n.right)
+	case *triple:
+		return costOf(state, n.one, n.two, n.three)
+	case *quad:
+		return costOf(state, n.one, n.two, n.three, n.four)
+	case *named:
+		return costOf(state, n.values...)
+	case *call:
+		return costOf(state, n.args...)
+	case *swizzle:
+		return costOf(state, n.t)
+	case *cellular:
+		return costOf(state, n.a, n.b)
+	case *warp:
+		warped, err := n.at(state)
+		if err != nil {
+			return 0, err
+		}
+		cost, err := costOf(state, n.dx, n.dy)
+		if err != nil {
+			return 0, err
+		}
+		t, err := Cost(n.t, warped)
+		return cost + t, err
+	case *ifThenElse:
+		branch, err := n.branch(state)
+		if err != nil {
+			return 0, err
+		}
+		return costOf(state, n.cond, branch)
+	}
+	return 1, nil
+}
+
+// costOf returns the cost of a node with the given children.
+func costOf(state State, children ...Node) (int, error) {
+	cost := 1
+	for _, c := range children {
+		cc, err := Cost(c, state)
+		if err != nil {
+			return 0, err
+		}
+		cost += cc
+	}
+	return cost, nil
+}
@@ -0,0 +1,60 @@
+package nodes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+const (
+	// GeneratorVersion is incremented whenever the same seed and grammar
+	// could generate a different expression than before, such as when the
+	// random numbers are drawn in a different order.
+	GeneratorVersion = 1
+	// RNGScheme names how seeds are turned into random numbers: PCG seeded
+	// with the seed and stream, with production streams seeded with the
+	// FNV-1a hash of the production's name.
+	RNGScheme = "pcg-fnv1a"
+)
+
+// ErrIncompatibleOptions is wrapped by the errors that CheckCompatible
+// returns.
+var ErrIncompatibleOptions = fmt.Errorf("options may not generate the same expression")
+
+// SHA256 returns the hex encoded SHA-256 of the grammar as it was parsed.
+// Grammars that only differ in formatting have the same hash.
+func (g *Grammar) SHA256() string {
+	if g.hash != "" {
+		return g.hash
+	}
+	sum := sha256.Sum256([]byte(g.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckCompatible returns an error wrapping ErrIncompatibleOptions if the
+// generator options encoded in data were written by another version of the
+// generator, another RNGScheme or from a grammar other than g, in which case
+// their seed may generate a different expression than it did. What isn't
+// recorded in the options, such as by those written before it was, can't be
+// checked.
+func CheckCompatible(data []byte, g *Grammar) error {
+	var written struct {
+		Version       int    `json:"version"`
+		RNG           string `json:"rng"`
+		GrammarSHA256 string `json:"grammar_sha256"`
+	}
+	if err := json.Unmarshal(data, &written); err != nil {
+		return errors.Wrap(err, "cannot decode generator options from JSON")
+	}
+	switch {
+	case written.Version != 0 && written.Version != GeneratorVersion:
+		return fmt.Errorf("%w as they were written by version %d of the generator, not %d", ErrIncompatibleOptions, written.Version, GeneratorVersion)
+	case written.RNG != "" && written.RNG != RNGScheme:
+		return fmt.Errorf("%w as they were written with the %s random number generator, not %s", ErrIncompatibleOptions, written.RNG, RNGScheme)
+	case g != nil && written.GrammarSHA256 != "" && written.GrammarSHA256 != g.SHA256():
+		return fmt.Errorf("%w as they were written from a different grammar", ErrIncompatibleOptions)
+	}
+	return nil
+}
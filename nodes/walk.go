@@ -0,0 +1,190 @@
+package nodes
+
+import (
+	"fmt"
+	"slices"
+)
+
+func children(n Node) []Node {
+	switch n := n.(type) {
+	case *op:
+		return []Node{n.left, n.right}
+	case *triple:
+		return []Node{n.one, n.two, n.three}
+	case *quad:
+		return []Node{n.one, n.two, n.three, n.four}
+	case *named:
+		return n.values
+	case *ifThenElse:
+		return []Node{n.cond, n.then, n.otherwise}
+	case *call:
+		return n.args
+	case *swizzle:
+		return []Node{n.t}
+	case *warp:
+		return []Node{n.t, n.dx, n.dy}
+	case *cellular:
+		return []Node{n.a, n.b}
+	}
+	return nil
+}
+
+// withChildren returns a shallow copy of the given node with its children
+// replaced. The number of children must match what children returns.
+func withChildren(n Node, c []Node) Node {
+	switch n := n.(type) {
+	case *op:
+		return &op{pos: n.pos, t: n.t, left: c[0], right: c[1]}
+	case *triple:
+		return &triple{pos: n.pos, one: c[0], two: c[1], three: c[2]}
+	case *quad:
+		return &quad{pos: n.pos, one: c[0], two: c[1], three: c[2], four: c[3]}
+	case *named:
+		return &named{pos: n.pos, names: n.names, values: c}
+	case *ifThenElse:
+		return &ifThenElse{pos: n.pos, cond: c[0], then: c[1], otherwise: c[2]}
+	case *call:
+		return &call{pos: n.pos, op: n.op, args: c}
+	case *swizzle:
+		return &swizzle{pos: n.pos, t: c[0], elements: n.elements}
+	case *warp:
+		return &warp{pos: n.pos, t: c[0], dx: c[1], dy: c[2]}
+	case *cellular:
+		w := *n
+		w.a, w.b = c[0], c[1]
+		return &w
+	}
+	return n
+}
+
+// Children returns the children of a node in the order that they appear in its
+// string, or nil if it has none. Nodes implemented outside this package have
+// no children.
+func Children(n Node) []Node {
+	return slices.Clone(children(n))
+}
+
+// WithChildren returns a copy of a node with its children replaced, leaving the
+// original untouched. There must be as many children as Children returns.
+func WithChildren(n Node, c []Node) (Node, error) {
+	if len(c) != len(children(n)) {
+		return nil, fmt.Errorf("%s has %d children, not %d", n, len(children(n)), len(c))
+	}
+	if len(c) == 0 {
+		return n, nil
+	}
+	return withChildren(n, slices.Clone(c)), nil
+}
+
+// Walk calls fn with each node of the tree rooted at n, parents before their
+// children, skipping the children of nodes for which fn returns false.
+// Subtrees shared by Dedupe or let are visited each time they are used.
+func Walk(n Node, fn func(n Node) bool) {
+	if !fn(n) {
+		return
+	}
+	for _, c := range children(n) {
+		Walk(c, fn)
+	}
+}
+
+// Rewrite returns a copy of the tree rooted at n in which each node has been
+// replaced by what fn returns for it, which can be the node itself. Children
+// are rewritten before their parents, which fn is called with after their
+// children have been replaced. fn is called once for each distinct node, so
+// shared subtrees stay shared, and the original tree is left untouched.
+func Rewrite(n Node, fn func(n Node) Node) Node {
+	return rewrite(n, fn, make(map[Node]Node))
+}
+
+func rewrite(n Node, fn func(n Node) Node, rewritten map[Node]Node) Node {
+	if r, ok := rewritten[n]; ok {
+		return r
+	}
+	original := n
+	if cs := children(n); cs != nil {
+		rcs := make([]Node, len(cs))
+		changed := false
+		for i, c := range cs {
+			rcs[i] = rewrite(c, fn, rewritten)
+			changed = changed || rcs[i] != c
+		}
+		if changed {
+			n = withChildren(n, rcs)
+		}
+	}
+	r := fn(n)
+	rewritten[original] = r
+	return r
+}
+
+// depth returns the number of nodes on the longest path from n to a leaf.
+func depth(n Node) int {
+	d := 0
+	for _, c := range children(n) {
+		d = max(d, depth(c))
+	}
+	return d + 1
+}
+
+// size returns the number of nodes in the tree rooted at n, counting subtrees
+// that are shared as many times as they are used.
+func size(n Node) int {
+	s := 1
+	for _, c := range children(n) {
+		s += size(c)
+	}
+	return s
+}
+
+// usedComponents returns the names of the components used by n.
+func usedComponents(n Node) []string {
+	var used []string
+	walk(n, func(n Node) {
+		var name string
+		switch n := n.(type) {
+		case *component:
+			name = string(n.ct)
+		case *custom:
+			name = n.c.name
+		default:
+			return
+		}
+		if !slices.Contains(used, name) {
+			used = append(used, name)
+		}
+	})
+	return used
+}
+
+func walk(n Node, f func(n Node)) {
+	f(n)
+	for _, c := range children(n) {
+		walk(c, f)
+	}
+}
+
+// replace returns a copy of root with target replaced by replacement. Only the
+// nodes on the path to target are copied, each of which is passed to copied
+// alongside the node it was copied from.
+func replace(root, target, replacement Node, copied func(from, to Node)) Node {
+	if root == target {
+		return replacement
+	}
+	cs := children(root)
+	if len(cs) == 0 {
+		return root
+	}
+	replaced := make([]Node, len(cs))
+	changed := false
+	for i, c := range cs {
+		replaced[i] = replace(c, target, replacement, copied)
+		changed = changed || replaced[i] != c
+	}
+	if !changed {
+		return root
+	}
+	n := withChildren(root, replaced)
+	copied(root, n)
+	return n
+}
@@ -0,0 +1,73 @@
+package nodes
+
+import "fmt"
+
+// warp evaluates a node with x and y offset by the values of dx and dy, which
+// are evaluated at the original state. Components of the source image are
+// still those at the original position.
+type warp struct {
+	pos
+	t  Node
+	dx Node
+	dy Node
+}
+
+func (w *warp) String() string {
+	return fmt.Sprintf("warp(%s, %s, %s)", w.t, w.dx, w.dy)
+}
+
+func (w *warp) at(state State) (State, error) {
+	dx, err := evalNumber(w.dx, state)
+	if err != nil {
+		return state, err
+	}
+	dy, err := evalNumber(w.dy, state)
+	if err != nil {
+		return state, err
+	}
+	state.X += dx
+	state.Y += dy
+	return state, nil
+}
+
+func (w *warp) Eval(state State) (Node, error) {
+	warped, err := w.at(state)
+	if err != nil {
+		return nil, err
+	}
+	return w.t.Eval(warped)
+}
+
+func (w *warp) EvalNum(state State) (float64, error) {
+	warped, err := w.at(state)
+	if err != nil {
+		return 0, err
+	}
+	return evalNumber(w.t, warped)
+}
+
+func (w *warp) EvalBool(state State) (bool, error) {
+	warped, err := w.at(state)
+	if err != nil {
+		return false, err
+	}
+	return evalBoolean(w.t, warped)
+}
+
+func (w *warp) evalRow(a *Arena, states []State) (*row, error) {
+	dx, err := evalNumberRow(a, w.dx, states)
+	if err != nil {
+		return nil, err
+	}
+	dy, err := evalNumberRow(a, w.dy, states)
+	if err != nil {
+		return nil, err
+	}
+	warped := a.states.alloc(len(states))
+	for i := range warped {
+		warped[i] = states[i]
+		warped[i].X += dx[i]
+		warped[i].Y += dy[i]
+	}
+	return evalRow(a, w.t, warped)
+}
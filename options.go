@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"randomart/render"
+)
+
+type runOptions struct {
+	Width         int                `json:"width"`
+	Height        int                `json:"height"`
+	Frames        int                `json:"frames"`
+	Samples       int                `json:"samples"`
+	Jitter        float64            `json:"jitter"`
+	FastMath      bool               `json:"fast_math,omitempty"`
+	Params        map[string]float64 `json:"params,omitempty"`
+	Src           string             `json:"src,omitempty"`
+	SrcSHA256     string             `json:"src_sha256,omitempty"`
+	SrcVideo      string             `json:"src_video,omitempty"`
+	Tileable      bool               `json:"tileable,omitempty"`
+	Dithering     string             `json:"dithering,omitempty"`
+	Mode          string             `json:"mode,omitempty"`
+	Heightmap     bool               `json:"heightmap,omitempty"`
+	Mask          string             `json:"mask,omitempty"`
+	LUT           string             `json:"lut,omitempty"`
+	Palette       string             `json:"palette,omitempty"`
+	PaletteDither bool               `json:"palette_dither,omitempty"`
+	Format        string             `json:"format"`
+	Quality       int                `json:"quality"`
+	FPS           int                `json:"fps"`
+	Grid          int                `json:"grid"`
+	// Version is the version of randomart that wrote the options.
+	Version string `json:"randomart_version,omitempty"`
+}
+
+func restoreFlag[T any](name string, dst *T, v T) bool {
+	if flagSet(name) {
+		return false
+	}
+	*dst = v
+	return true
+}
+
+// readRunOptions reads the render section of an options file written with
+// -ooptions and restores every flag that was not explicitly given on the
+// command line. Options files written before the render section existed are
+// left alone.
+func readRunOptions(data []byte) (*runOptions, error) {
+	var file struct {
+		Render *runOptions `json:"render"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("cannot decode render options from JSON: %w", err)
+	}
+	if file.Render == nil {
+		return nil, nil
+	}
+
+	r := file.Render
+	restoreFlag("width", width, r.Width)
+	restoreFlag("height", height, r.Height)
+	restoreFlag("frames", frames, r.Frames)
+	restoreFlag("samples", samples, r.Samples)
+	restoreFlag("jitter", jitter, r.Jitter)
+	restoreFlag("fast-math", fastMath, r.FastMath)
+	if !flagSet("param") && r.Params != nil {
+		params = r.Params
+	}
+	restoreFlag("src", srcFilename, r.Src)
+	restoreFlag("src-video", srcVideoFilename, r.SrcVideo)
+	if r.Dithering != "" {
+		restoreFlag("dithering", dithering, r.Dithering)
+	}
+	if r.Mode != "" {
+		restoreFlag("mode", mode, r.Mode)
+	}
+	restoreFlag("tileable", tileable, r.Tileable)
+	restoreFlag("heightmap", heightmap, r.Heightmap)
+	restoreFlag("mask", maskFilename, r.Mask)
+	restoreFlag("lut", lutFilename, r.LUT)
+	restoreFlag("palette", paletteFilename, r.Palette)
+	restoreFlag("palette-dither", paletteDither, r.PaletteDither)
+	restoreFlag("format", outputFormat, r.Format)
+	restoreFlag("quality", quality, r.Quality)
+	restoreFlag("fps", fps, r.FPS)
+	restoreFlag("grid", grid, r.Grid)
+	return r, nil
+}
+
+func effectiveRunOptions(w, h int, srcHash []byte, format render.Format) *runOptions {
+	r := &runOptions{
+		Width:         w,
+		Height:        h,
+		Frames:        *frames,
+		Samples:       *samples,
+		Jitter:        *jitter,
+		FastMath:      *fastMath,
+		Params:        params,
+		Src:           *srcFilename,
+		SrcVideo:      *srcVideoFilename,
+		Tileable:      *tileable,
+		Dithering:     *dithering,
+		Mode:          *mode,
+		Heightmap:     *heightmap,
+		Mask:          *maskFilename,
+		LUT:           *lutFilename,
+		Palette:       *paletteFilename,
+		PaletteDither: *paletteDither,
+		Format:        string(format),
+		Quality:       *quality,
+		FPS:           *fps,
+		Grid:          *grid,
+		Version:       version(),
+	}
+	if srcHash != nil {
+		r.SrcSHA256 = hex.EncodeToString(srcHash)
+	}
+	return r
+}
+
+func hashSource(data []byte) []byte {
+	h := sha256.Sum256(data)
+	return h[:]
+}
+
+// marshalOptions adds the render section to the given generator options so
+// that a single file captures the entire run.
+func marshalOptions(generatorOptions string, r *runOptions) (string, error) {
+	var file map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(generatorOptions), &file); err != nil {
+		return "", err
+	}
+	var err error
+	if file["render"], err = json.Marshal(r); err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(file)
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
@@ -0,0 +1,221 @@
+//go:build preview
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"image"
+	"math/rand/v2"
+	"path"
+	"randomart/nodes"
+	"randomart/render"
+	"strings"
+	"sync"
+)
+
+type previewWindow struct {
+	ctx     context.Context
+	grammar *nodes.Grammar
+	state   *nodes.GeneratorState
+	node    nodes.Node
+	zoom    float64
+	cx, cy  float64
+	saves   int
+	cancel  context.CancelFunc
+	live    *render.LiveParams
+	// liveChanged is closed when the live parameters change after the
+	// render started.
+	liveChanged <-chan struct{}
+
+	mu      sync.Mutex
+	latest  image.Image
+	full    image.Image
+	err     error
+	changed bool
+	frame   *ebiten.Image
+}
+
+func (p *previewWindow) gen() error {
+	node, state, err := p.grammar.Gen(nodes.WithSeeds(rand.Uint64()))
+	if err != nil {
+		return fmt.Errorf("could not generate random AST: %w", err)
+	}
+	p.node, p.state = node, state
+	fmt.Println(node)
+	fmt.Print(state.Options())
+	return nil
+}
+
+func (p *previewWindow) mutate() error {
+	node, err := p.state.Mutate(p.node)
+	if err != nil {
+		return fmt.Errorf("could not mutate expression: %w", err)
+	}
+	p.node = node
+	fmt.Println(node)
+	return nil
+}
+
+func (p *previewWindow) rerender() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	ctx, cancel := context.WithCancel(p.ctx)
+	p.cancel = cancel
+
+	p.mu.Lock()
+	p.full = nil
+	p.mu.Unlock()
+
+	node := p.node
+	half := 1 / p.zoom
+	opts := []render.RenderOption{
+		render.WithViewport(p.cx-half, p.cy-half, p.cx+half, p.cy+half),
+		render.WithSamples(*samples),
+		render.WithJitter(*jitter),
+	}
+	opts = append(opts, paramOptions()...)
+	if p.live != nil {
+		p.liveChanged = p.live.Changed()
+		opts = append(opts, render.WithLiveParams(p.live))
+	}
+	go func() {
+		err := render.RenderCallback(ctx, node, func(no int, img image.Image) error {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.latest, p.err, p.changed = img, nil, true
+			if _, ok := img.(*render.Partial); !ok {
+				p.full = img
+			}
+			return nil
+		}, append(opts, render.WithResolution(*width, *height), render.WithProgressive(), render.WithRetainFrames())...)
+		if err != nil && ctx.Err() == nil {
+			p.mu.Lock()
+			p.err, p.changed = err, true
+			p.mu.Unlock()
+		}
+	}()
+}
+
+func (p *previewWindow) save() {
+	p.mu.Lock()
+	img := p.full
+	p.mu.Unlock()
+	if img == nil {
+		fmt.Println("wait for the render to finish before saving")
+		return
+	}
+
+	ext := path.Ext(*outputFilename)
+	filename := fmt.Sprintf("%s-%03d%s", strings.TrimSuffix(*outputFilename, ext), p.saves, ext)
+	format, err := render.FormatFromFilename(filename)
+	if err == nil {
+		err = writeImage(filename, img, format, render.WithQuality(*quality))
+	}
+	if err != nil {
+		fmt.Printf("could not save image: %s\n", err)
+		return
+	}
+	p.saves++
+	fmt.Printf("saved to %s\n", filename)
+}
+
+func (p *previewWindow) Update() error {
+	if p.ctx.Err() != nil || inpututil.IsKeyJustPressed(ebiten.KeyEscape) || inpututil.IsKeyJustPressed(ebiten.KeyQ) {
+		return ebiten.Termination
+	}
+
+	changed := true
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyR):
+		if err := p.gen(); err != nil {
+			return err
+		}
+		p.zoom, p.cx, p.cy = 1, 0, 0
+	case inpututil.IsKeyJustPressed(ebiten.KeyM):
+		if err := p.mutate(); err != nil {
+			fmt.Println(err)
+		}
+	case inpututil.IsKeyJustPressed(ebiten.KeyEqual), inpututil.IsKeyJustPressed(ebiten.KeyKPAdd):
+		p.zoom *= 2
+	case inpututil.IsKeyJustPressed(ebiten.KeyMinus), inpututil.IsKeyJustPressed(ebiten.KeyKPSubtract):
+		p.zoom /= 2
+	case inpututil.IsKeyJustPressed(ebiten.KeyLeft):
+		p.cx -= 0.5 / p.zoom
+	case inpututil.IsKeyJustPressed(ebiten.KeyRight):
+		p.cx += 0.5 / p.zoom
+	case inpututil.IsKeyJustPressed(ebiten.KeyUp):
+		p.cy -= 0.5 / p.zoom
+	case inpututil.IsKeyJustPressed(ebiten.KeyDown):
+		p.cy += 0.5 / p.zoom
+	case inpututil.IsKeyJustPressed(ebiten.Key0):
+		p.zoom, p.cx, p.cy = 1, 0, 0
+	case inpututil.IsKeyJustPressed(ebiten.KeyS):
+		p.save()
+		changed = false
+	default:
+		changed = false
+	}
+	select {
+	case <-p.liveChanged:
+		changed = true
+	default:
+	}
+	if changed {
+		p.rerender()
+	}
+	return nil
+}
+
+func (p *previewWindow) Draw(screen *ebiten.Image) {
+	p.mu.Lock()
+	if p.changed {
+		if p.err != nil {
+			fmt.Printf("could not render image: %s\n", p.err)
+		} else {
+			p.frame = ebiten.NewImageFromImage(p.latest)
+		}
+		p.changed = false
+	}
+	p.mu.Unlock()
+
+	if p.frame == nil {
+		return
+	}
+	sw, sh := screen.Bounds().Dx(), screen.Bounds().Dy()
+	fw, fh := p.frame.Bounds().Dx(), p.frame.Bounds().Dy()
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(float64(sw)/float64(fw), float64(sh)/float64(fh))
+	screen.DrawImage(p.frame, op)
+}
+
+func (p *previewWindow) Layout(outsideWidth, outsideHeight int) (int, int) {
+	return *width, *height
+}
+
+func runPreview(ctx context.Context) error {
+	grammar, err := loadGrammar(*grammarFilename)
+	if err != nil {
+		return err
+	}
+	fmt.Println(grammar.String())
+	fmt.Println("Keys: r reseed, m mutate, +/- zoom, arrows pan, 0 reset view, s save, q quit")
+
+	p := &previewWindow{ctx: ctx, grammar: grammar, zoom: 1}
+	if p.live, err = startLiveParams(ctx); err != nil {
+		return err
+	}
+	if err = p.gen(); err != nil {
+		return err
+	}
+	p.rerender()
+	defer p.cancel()
+
+	ebiten.SetWindowSize(*width, *height)
+	ebiten.SetWindowTitle("randomart")
+	ebiten.SetWindowResizingMode(ebiten.WindowResizingModeEnabled)
+	return ebiten.RunGame(p)
+}
@@ -0,0 +1,12 @@
+//go:build !preview
+
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+func runPreview(ctx context.Context) error {
+	return fmt.Errorf("randomart was built without the preview window, rebuild it with -tags preview")
+}
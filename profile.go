@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	rpprof "runtime/pprof"
+	"runtime/trace"
+)
+
+// startProfiling starts the CPU profile and execution trace given with
+// -cpuprofile and -trace. The function it returns stops them and writes the
+// heap profile given with -memprofile.
+func startProfiling() (func() error, error) {
+	var stops []func() error
+	stop := func() error {
+		var errs []error
+		for _, stop := range stops {
+			errs = append(errs, stop())
+		}
+		return errors.Join(errs...)
+	}
+	if *cpuProfile != "" {
+		f, err := os.Create(*cpuProfile)
+		if err != nil {
+			return nil, fmt.Errorf("could not create CPU profile %q: %w", *cpuProfile, err)
+		}
+		if err = rpprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("could not start CPU profile: %w", err)
+		}
+		stops = append(stops, func() error {
+			rpprof.StopCPUProfile()
+			return f.Close()
+		})
+	}
+	if *traceFilename != "" {
+		f, err := os.Create(*traceFilename)
+		if err != nil {
+			stop()
+			return nil, fmt.Errorf("could not create trace %q: %w", *traceFilename, err)
+		}
+		if err = trace.Start(f); err != nil {
+			f.Close()
+			stop()
+			return nil, fmt.Errorf("could not start trace: %w", err)
+		}
+		stops = append(stops, func() error {
+			trace.Stop()
+			return f.Close()
+		})
+	}
+	if *memProfile != "" {
+		stops = append(stops, writeHeapProfile)
+	}
+	return stop, nil
+}
+
+func writeHeapProfile() error {
+	f, err := os.Create(*memProfile)
+	if err != nil {
+		return fmt.Errorf("could not create heap profile %q: %w", *memProfile, err)
+	}
+	// Collect garbage so that the profile is of what is still in use.
+	runtime.GC()
+	if err = rpprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write heap profile: %w", err)
+	}
+	return f.Close()
+}
+
+// servePprof serves the profiles of net/http/pprof on the address until the
+// function it returns is called.
+func servePprof(addr string) func() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("could not serve pprof on %q: %s\n", addr, err)
+		}
+	}()
+	fmt.Printf("Serving pprof on %s\n", addr)
+	return func() {
+		server.Close()
+	}
+}
@@ -0,0 +1,100 @@
+// Package randomart generates an expression from a grammar and renders it in
+// one call, for uses that don't need the options of the nodes and render
+// packages that it wraps.
+//
+//	img, err := randomart.New(grammar).WithSeedString("alice").Render(ctx, 256, 256)
+package randomart
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"randomart/nodes"
+	"randomart/render"
+	"slices"
+)
+
+// Art is a grammar along with the options to generate and render from it. Its
+// methods return a copy with the option added, so an Art can be shared and
+// used to render with different options.
+type Art struct {
+	grammar *nodes.Grammar
+	// err is the error of parsing the grammar, returned once rendering.
+	err     error
+	genOpts []nodes.GeneratorOption
+	renOpts []render.RenderOption
+}
+
+// New parses the grammar read from r. Errors parsing it are returned by Render
+// and Expression. Art is generated from a seed taken from the time unless
+// WithSeed or WithSeedString is used.
+func New(r io.Reader) *Art {
+	g, err := nodes.Parse(r, "grammar")
+	if err != nil {
+		err = fmt.Errorf("could not parse grammar: %w", err)
+	}
+	return &Art{grammar: g, err: err}
+}
+
+// FromGrammar uses a grammar that has already been parsed.
+func FromGrammar(g *nodes.Grammar) *Art {
+	return &Art{grammar: g}
+}
+
+// WithSeed generates from the seed, so that the same seed and grammar always
+// render the same art.
+func (a *Art) WithSeed(seed uint64) *Art {
+	return a.WithGeneratorOptions(nodes.WithSeeds(seed))
+}
+
+// WithSeedString generates from a seed hashed from s, such as a name or an
+// email address.
+func (a *Art) WithSeedString(s string) *Art {
+	return a.WithGeneratorOptions(nodes.WithSeedString(s))
+}
+
+// WithGeneratorOptions generates with the options, after those already given.
+func (a *Art) WithGeneratorOptions(opts ...nodes.GeneratorOption) *Art {
+	c := *a
+	c.genOpts = append(slices.Clip(a.genOpts), opts...)
+	return &c
+}
+
+// WithRenderOptions renders with the options, after those already given.
+// WithResolution is given by Render.
+func (a *Art) WithRenderOptions(opts ...render.RenderOption) *Art {
+	c := *a
+	c.renOpts = append(slices.Clip(a.renOpts), opts...)
+	return &c
+}
+
+// Expression generates the expression that Render renders.
+func (a *Art) Expression(ctx context.Context) (nodes.Node, error) {
+	if a.err != nil {
+		return nil, a.err
+	}
+	if a.grammar == nil {
+		return nil, fmt.Errorf("no grammar was given")
+	}
+	root, _, err := a.grammar.GenContext(ctx, a.genOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate expression: %w", err)
+	}
+	return root, nil
+}
+
+// Render generates an expression and renders its first frame at the
+// resolution.
+func (a *Art) Render(ctx context.Context, width, height int) (image.Image, error) {
+	root, err := a.Expression(ctx)
+	if err != nil {
+		return nil, err
+	}
+	opts := append(slices.Clip(a.renOpts), render.WithResolution(width, height))
+	img, err := render.Render(ctx, root, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("could not render: %w", err)
+	}
+	return img, nil
+}
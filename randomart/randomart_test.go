@@ -0,0 +1,38 @@
+package randomart
+
+import (
+	"context"
+	"image"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	f, err := os.Open("../grammar.bnf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	art := New(f).WithSeedString("randomart")
+	renders := make([]image.Image, 2)
+	for i := range renders {
+		if renders[i], err = art.Render(context.Background(), 16, 8); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if b := renders[0].Bounds(); b.Dx() != 16 || b.Dy() != 8 {
+		t.Errorf("rendered %dx%d, want 16x8", b.Dx(), b.Dy())
+	}
+	if !reflect.DeepEqual(renders[0], renders[1]) {
+		t.Error("the same seed rendered different images")
+	}
+}
+
+func TestRenderInvalidGrammar(t *testing.T) {
+	_, err := New(strings.NewReader("E ::= x")).Render(context.Background(), 8, 8)
+	if err == nil || !strings.Contains(err.Error(), "could not parse grammar") {
+		t.Errorf("got %v, want an error parsing the grammar", err)
+	}
+}
@@ -0,0 +1,221 @@
+package render
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"io"
+)
+
+const (
+	pngHeader    = "\x89PNG\r\n\x1a\n"
+	pngColorRGB  = 2
+	pngColorRGBA = 6
+)
+
+func writeChunk(w io.Writer, name string, data []byte) error {
+	header := make([]byte, 0, 8)
+	header = binary.BigEndian.AppendUint32(header, uint32(len(data)))
+	header = append(header, name...)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	_, err := w.Write(binary.BigEndian.AppendUint32(nil, crc.Sum32()))
+	return err
+}
+
+func paeth(a, b, c uint8) uint8 {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := p-int(a), p-int(b), p-int(c)
+	if pa < 0 {
+		pa = -pa
+	}
+	if pb < 0 {
+		pb = -pb
+	}
+	if pc < 0 {
+		pc = -pc
+	}
+	if pa <= pb && pa <= pc {
+		return a
+	} else if pb <= pc {
+		return b
+	}
+	return c
+}
+
+// filterRow picks the PNG filter that minimises the sum of absolute
+// differences for the row, writing the filter type and filtered row to dst.
+func filterRow(dst, cur, prev []byte, bpp int) {
+	bestSum := -1
+	filtered := make([]byte, len(cur))
+	for ft := 0; ft < 5; ft++ {
+		sum := 0
+		for i := range cur {
+			var a, b, c uint8
+			if i >= bpp {
+				a = cur[i-bpp]
+				c = prev[i-bpp]
+			}
+			b = prev[i]
+			var f uint8
+			switch ft {
+			case 0:
+				f = cur[i]
+			case 1:
+				f = cur[i] - a
+			case 2:
+				f = cur[i] - b
+			case 3:
+				f = cur[i] - uint8((int(a)+int(b))/2)
+			case 4:
+				f = cur[i] - paeth(a, b, c)
+			}
+			filtered[i] = f
+			if d := int(int8(f)); d < 0 {
+				sum -= d
+			} else {
+				sum += d
+			}
+		}
+		if bestSum < 0 || sum < bestSum {
+			bestSum = sum
+			dst[0] = byte(ft)
+			copy(dst[1:], filtered)
+		}
+	}
+}
+
+func compressFrame(img image.Image, alpha bool) ([]byte, error) {
+	b := img.Bounds()
+	bpp := 3
+	if alpha {
+		bpp = 4
+	}
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	cur := make([]byte, b.Dx()*bpp)
+	prev := make([]byte, b.Dx()*bpp)
+	row := make([]byte, 1+b.Dx()*bpp)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			i := (x - b.Min.X) * bpp
+			cur[i], cur[i+1], cur[i+2] = c.R, c.G, c.B
+			if alpha {
+				cur[i+3] = c.A
+			}
+		}
+		filterRow(row, cur, prev, bpp)
+		if _, err := zw.Write(row); err != nil {
+			return nil, err
+		}
+		cur, prev = prev, cur
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xFFFF {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func EncodeAPNG(w io.Writer, frames []image.Image, opts ...EncodeOption) error {
+	options := defaultEncodeOptions()
+	for _, opt := range opts {
+		if err := opt(options); err != nil {
+			return err
+		}
+	}
+	if len(frames) == 0 {
+		return fmt.Errorf("cannot encode an APNG with no frames")
+	}
+
+	size := frames[0].Bounds().Size()
+	alpha := false
+	for no, frame := range frames {
+		if frame.Bounds().Size() != size {
+			return fmt.Errorf("frame %d is %s but frame 0 is %s", no, frame.Bounds().Size(), size)
+		}
+		alpha = alpha || !isOpaque(frame)
+	}
+
+	if _, err := io.WriteString(w, pngHeader); err != nil {
+		return err
+	}
+
+	ihdr := make([]byte, 0, 13)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, uint32(size.X))
+	ihdr = binary.BigEndian.AppendUint32(ihdr, uint32(size.Y))
+	colorType := byte(pngColorRGB)
+	if alpha {
+		colorType = pngColorRGBA
+	}
+	ihdr = append(ihdr, 8, colorType, 0, 0, 0)
+	if err := writeChunk(w, "IHDR", ihdr); err != nil {
+		return err
+	}
+
+	actl := make([]byte, 0, 8)
+	actl = binary.BigEndian.AppendUint32(actl, uint32(len(frames)))
+	actl = binary.BigEndian.AppendUint32(actl, 0)
+	if err := writeChunk(w, "acTL", actl); err != nil {
+		return err
+	}
+
+	var seq uint32
+	for no, frame := range frames {
+		fctl := make([]byte, 0, 26)
+		fctl = binary.BigEndian.AppendUint32(fctl, seq)
+		fctl = binary.BigEndian.AppendUint32(fctl, uint32(size.X))
+		fctl = binary.BigEndian.AppendUint32(fctl, uint32(size.Y))
+		fctl = binary.BigEndian.AppendUint32(fctl, 0)
+		fctl = binary.BigEndian.AppendUint32(fctl, 0)
+		fctl = binary.BigEndian.AppendUint16(fctl, 1)
+		fctl = binary.BigEndian.AppendUint16(fctl, uint16(options.frameRate))
+		// Dispose of nothing and overwrite the whole canvas with each frame.
+		fctl = append(fctl, 0, 0)
+		if err := writeChunk(w, "fcTL", fctl); err != nil {
+			return err
+		}
+		seq++
+
+		data, err := compressFrame(frame, alpha)
+		if err != nil {
+			return fmt.Errorf("could not compress frame %d: %w", no, err)
+		}
+		if no == 0 {
+			err = writeChunk(w, "IDAT", data)
+		} else {
+			err = writeChunk(w, "fdAT", append(binary.BigEndian.AppendUint32(nil, seq), data...))
+			seq++
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return writeChunk(w, "IEND", nil)
+}
@@ -0,0 +1,31 @@
+package render
+
+import (
+	"image"
+	"sync"
+)
+
+// bufferPool reuses the images of frames once they have been passed to the
+// callbacks of a render, so that long animations don't allocate new images
+// for every frame.
+type bufferPool struct {
+	pool sync.Pool
+}
+
+// get returns a cleared image with the given bounds.
+func (p *bufferPool) get(bounds image.Rectangle) *image.NRGBA {
+	if img, ok := p.pool.Get().(*image.NRGBA); ok && img.Rect == bounds {
+		clear(img.Pix)
+		return img
+	}
+	return image.NewNRGBA(bounds)
+}
+
+// put returns the images of a frame to the pool.
+func (p *bufferPool) put(imgs []image.Image) {
+	for _, img := range imgs {
+		if img, ok := img.(*image.NRGBA); ok {
+			p.pool.Put(img)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package render
+
+import (
+	"context"
+	"image"
+	"randomart/nodes"
+	"sync"
+)
+
+// Controller pauses, resumes and cancels a render started with Start, or
+// individual frames of it, such as from the controls of a preview window.
+type Controller struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+
+	mu sync.Mutex
+	// resumed is closed when a paused render is resumed, and is nil unless
+	// the render is paused.
+	resumed   chan struct{}
+	frames    map[int]context.CancelFunc
+	cancelled map[int]bool
+}
+
+// Start renders like RenderOutputsCallback in the background, returning a
+// Controller of the render. Frames that are cancelled with CancelFrame are
+// skipped rather than passed to the callback, and the render carries on with
+// the others.
+func Start(ctx context.Context, root nodes.Node, callback func(no int, outputs map[string]image.Image) error, opts ...RenderOption) *Controller {
+	ctx, cancel := context.WithCancel(ctx)
+	c := newController(cancel)
+	go func() {
+		defer close(c.done)
+		defer cancel()
+		c.err = RenderOutputsCallback(ctx, root, callback, append(opts, withController(c))...)
+	}()
+	return c
+}
+
+func newController(cancel context.CancelFunc) *Controller {
+	return &Controller{
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		frames:    make(map[int]context.CancelFunc),
+		cancelled: make(map[int]bool),
+	}
+}
+
+func withController(c *Controller) RenderOption {
+	return func(options *renderOptions) error {
+		options.controller = c
+		return nil
+	}
+}
+
+// Pause stops rendering new rows until Resume is called. Rows that are being
+// rendered are finished, and frames rendered by remote workers aren't paused.
+func (c *Controller) Pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resumed == nil {
+		c.resumed = make(chan struct{})
+	}
+}
+
+// Resume carries on with a paused render.
+func (c *Controller) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resumed != nil {
+		close(c.resumed)
+		c.resumed = nil
+	}
+}
+
+// Paused returns whether the render is paused.
+func (c *Controller) Paused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resumed != nil
+}
+
+// CancelFrame stops rendering the frame, or skips it if it hasn't started,
+// unless it has already been rendered.
+func (c *Controller) CancelFrame(frame int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cancelled[frame] = true
+	if cancel, ok := c.frames[frame]; ok {
+		cancel()
+	}
+}
+
+// Cancel stops the render, which Wait then returns the error of.
+func (c *Controller) Cancel() {
+	c.cancel()
+}
+
+// Done is closed once the render has finished.
+func (c *Controller) Done() <-chan struct{} {
+	return c.done
+}
+
+// Wait waits for the render to finish and returns its error.
+func (c *Controller) Wait() error {
+	<-c.done
+	return c.err
+}
+
+// wait blocks while the render is paused, returning the context's error if
+// it is done.
+func (c *Controller) wait(ctx context.Context) error {
+	if c == nil {
+		return ctx.Err()
+	}
+	c.mu.Lock()
+	resumed := c.resumed
+	c.mu.Unlock()
+	if resumed != nil {
+		select {
+		case <-resumed:
+		case <-ctx.Done():
+		}
+	}
+	return ctx.Err()
+}
+
+// frameContext returns the context that the frame is rendered with, which is
+// done once the frame is cancelled, and a function to call once it has been
+// rendered.
+func (c *Controller) frameContext(ctx context.Context, frame int) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	if c == nil {
+		return ctx, cancel
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancelled[frame] {
+		cancel()
+	}
+	c.frames[frame] = cancel
+	return ctx, func() {
+		c.mu.Lock()
+		delete(c.frames, frame)
+		c.mu.Unlock()
+		cancel()
+	}
+}
+
+// frameCancelled returns whether the frame was cancelled with CancelFrame.
+func (c *Controller) frameCancelled(frame int) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cancelled[frame]
+}
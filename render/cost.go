@@ -0,0 +1,106 @@
+package render
+
+import (
+	"math"
+	"randomart/nodes"
+	"runtime"
+	"time"
+)
+
+// pixelCost is roughly how many nanoseconds rendering a pixel takes besides
+// evaluating the expression, such as building its state and writing its colour.
+const pixelCost = 50
+
+// nodeCosts are roughly how many nanoseconds evaluating each kind of node takes
+// for a pixel on a single core, when evaluated a row at a time.
+var nodeCosts = map[string]float64{
+	"number":    0.5,
+	"bool":      0.5,
+	"component": 0.5,
+	"param":     0.5,
+	"custom":    5,
+	"add":       2,
+	"sub":       2,
+	"mul":       2,
+	"div":       2,
+	"mod":       10,
+	"gt":        2,
+	"ge":        2,
+	"lt":        2,
+	"le":        2,
+	"triple":    1,
+	"quad":      1,
+	"named":     1,
+	"swizzle":   1,
+	"if":        10,
+	"warp":      10,
+	"voronoi":   250,
+	"cell":      250,
+	"call":      20,
+}
+
+// unknownNodeCost is the cost of nodes implemented outside the nodes package.
+const unknownNodeCost = 20
+
+// EstimateCost estimates how long rendering the root at the resolution for the
+// number of frames takes with a sample a pixel, from how long each kind of
+// node usually takes to evaluate. Both branches of if/then/else are counted and
+// pixels are assumed to be rendered on every core, so it is only a rough guide
+// to how large an expression can be rendered in a given time.
+func EstimateCost(root nodes.Node, width, height, frames int) time.Duration {
+	perPixel := float64(pixelCost)
+	nodes.Walk(root, func(n nodes.Node) bool {
+		cost, ok := nodeCosts[nodes.Kind(n)]
+		if !ok {
+			cost = unknownNodeCost
+		}
+		perPixel += cost
+		return true
+	})
+	pixels := float64(width) * float64(height) * float64(frames)
+	return time.Duration(perPixel * pixels / float64(runtime.GOMAXPROCS(0)))
+}
+
+// probeSize is the width and height of the grid of pixels that
+// WithTargetDuration times evaluating.
+const probeSize = 32
+
+// fitResolution lowers the resolution to the largest that is estimated to
+// render within the target duration, from how long evaluating the root at a
+// grid of pixels of the first frame takes. The resolution is left as it is if
+// the root can't be evaluated, so that the render returns the error.
+func fitResolution(root nodes.Node, options *renderOptions) {
+	var (
+		frame   = options.startFrame
+		hoisted = hoist(root, options, frame)
+		outputs = max(len(nodes.OutputNames(root)), 1)
+		states  = make([]nodes.State, probeSize)
+		out     = make([][4]float64, probeSize*outputs)
+		arena   = nodes.Arena{FastMath: options.fastMath}
+		data    any
+	)
+	if options.stateData != nil {
+		data = options.stateData(frame)
+	}
+	start := time.Now()
+	for y := range probeSize {
+		for x := range probeSize {
+			src := options.sampler.At(x*options.width/probeSize, y*options.height/probeSize)
+			states[x] = nodes.S(x, y, probeSize, probeSize, frame, options.frames, src)
+			states[x].Data = data
+		}
+		if err := arena.EvalRow(hoisted, states, out); err != nil {
+			return
+		}
+	}
+	perSample := float64(time.Since(start))/(probeSize*probeSize) + pixelCost
+	cost := perSample * float64(options.samplesPerPixel()*options.renderedFrames()*options.width*options.height) / float64(runtime.GOMAXPROCS(0))
+	scale := math.Sqrt(float64(options.targetDuration) / cost)
+	if scale >= 1 {
+		return
+	}
+	width := max(int(float64(options.width)*scale), 1)
+	height := max(int(float64(options.height)*scale), 1)
+	options.logf("Rendering at %dx%d rather than %dx%d to render within %s\n", width, height, options.width, options.height, options.targetDuration)
+	options.resize(width, height)
+}
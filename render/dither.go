@@ -0,0 +1,98 @@
+package render
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Dithering is how the colours of the root are rounded to 8 bits.
+type Dithering string
+
+const (
+	// NoDithering rounds each colour down, which bands smooth gradients.
+	NoDithering Dithering = "none"
+	// FloydSteinberg spreads the error of rounding each pixel onto the pixels
+	// to its right and below it.
+	FloydSteinberg Dithering = "floyd-steinberg"
+	// Ordered rounds each pixel up or down by a threshold that changes in a
+	// fixed pattern.
+	Ordered Dithering = "ordered"
+)
+
+func Ditherings() []Dithering {
+	return []Dithering{
+		NoDithering,
+		FloydSteinberg,
+		Ordered,
+	}
+}
+
+func ParseDithering(dithering string) (Dithering, error) {
+	dithering = strings.ToLower(dithering)
+	for _, d := range Ditherings() {
+		if string(d) == dithering {
+			return d, nil
+		}
+	}
+	return "", fmt.Errorf("%q is not a supported dithering", dithering)
+}
+
+// bayer is the threshold map for ordered dithering.
+var bayer = [4][4]float64{
+	{0, 8, 2, 10},
+	{12, 4, 14, 6},
+	{3, 11, 1, 9},
+	{15, 7, 13, 5},
+}
+
+// applyDithering rounds the colours of the frame, kept by renderRow, to the
+// pixels of its images with the dithering.
+func applyDithering(options *renderOptions, fs *frameState) {
+	w, h := options.width, options.height
+	for o, img := range fs.imgs {
+		colours := fs.colours[o]
+		// errs are the errors spread onto the pixels of this row and the next
+		// by Floyd-Steinberg dithering, with a pixel of padding on each side.
+		var errs [2][][4]float64
+		if options.dithering == FloydSteinberg {
+			errs = [2][][4]float64{make([][4]float64, w+2), make([][4]float64, w+2)}
+		}
+		for y := range h {
+			for x := range w {
+				if options.masked(x, y) {
+					continue
+				}
+				c := colours[y*w+x]
+				pix := img.Pix[img.PixOffset(x, y):]
+				for ch := range c {
+					v := (c[ch] + 1) / 2 * 255
+					if math.IsNaN(v) {
+						v = 0
+					}
+					var q float64
+					switch options.dithering {
+					case Ordered:
+						q = math.Floor(v + (bayer[y%4][x%4]+0.5)/16)
+					case FloydSteinberg:
+						v += errs[0][x+1][ch]
+						q = math.Round(v)
+					}
+					q = min(max(q, 0), 255)
+					pix[ch] = uint8(q)
+					if options.dithering == FloydSteinberg {
+						e := v - q
+						errs[0][x+2][ch] += e * 7 / 16
+						errs[1][x][ch] += e * 3 / 16
+						errs[1][x+1][ch] += e * 5 / 16
+						errs[1][x+2][ch] += e * 1 / 16
+					}
+				}
+			}
+			if options.dithering == FloydSteinberg {
+				errs[0], errs[1] = errs[1], errs[0]
+				clear(errs[1])
+			}
+		}
+	}
+}
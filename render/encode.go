@@ -0,0 +1,125 @@
+package render
+
+import (
+	"fmt"
+	"golang.org/x/image/bmp"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path"
+	"strings"
+)
+
+type Format string
+
+const (
+	PNG  Format = "png"
+	JPEG Format = "jpeg"
+	WebP Format = "webp"
+	BMP  Format = "bmp"
+	APNG Format = "apng"
+)
+
+func Formats() []Format {
+	return []Format{
+		PNG,
+		JPEG,
+		WebP,
+		BMP,
+		APNG,
+	}
+}
+
+func ParseFormat(format string) (Format, error) {
+	format = strings.ToLower(format)
+	if format == "jpg" {
+		return JPEG, nil
+	}
+	for _, f := range Formats() {
+		if string(f) == format {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("%q is not a supported format", format)
+}
+
+func FormatFromFilename(filename string) (Format, error) {
+	ext := strings.TrimPrefix(path.Ext(filename), ".")
+	if ext == "" {
+		return PNG, nil
+	}
+	format, err := ParseFormat(ext)
+	if err != nil {
+		return "", fmt.Errorf("cannot infer output format from extension %q", ext)
+	}
+	return format, nil
+}
+
+type encodeOptions struct {
+	quality      int
+	frameRate    int
+	previewWidth int
+}
+
+func defaultEncodeOptions() *encodeOptions {
+	return &encodeOptions{
+		quality:   jpeg.DefaultQuality,
+		frameRate: 24,
+	}
+}
+
+type EncodeOption func(options *encodeOptions) error
+
+func WithQuality(quality int) EncodeOption {
+	return func(options *encodeOptions) error {
+		if quality < 1 || quality > 100 {
+			return fmt.Errorf("quality must be between 1 and 100")
+		}
+		options.quality = quality
+		return nil
+	}
+}
+
+func WithFrameRate(fps int) EncodeOption {
+	return func(options *encodeOptions) error {
+		if fps <= 0 || fps > 0xFFFF {
+			return fmt.Errorf("frame rate must be between 1 and %d", 0xFFFF)
+		}
+		options.frameRate = fps
+		return nil
+	}
+}
+
+func WithPreviewWidth(width int) EncodeOption {
+	return func(options *encodeOptions) error {
+		if width <= 0 {
+			return fmt.Errorf("preview width must be positive")
+		}
+		options.previewWidth = width
+		return nil
+	}
+}
+
+func Encode(w io.Writer, img image.Image, format Format, opts ...EncodeOption) error {
+	options := defaultEncodeOptions()
+	for _, opt := range opts {
+		if err := opt(options); err != nil {
+			return err
+		}
+	}
+
+	switch format {
+	case PNG:
+		return png.Encode(w, img)
+	case JPEG:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: options.quality})
+	case WebP:
+		return encodeWebP(w, img)
+	case BMP:
+		return bmp.Encode(w, img)
+	case APNG:
+		return EncodeAPNG(w, []image.Image{img}, opts...)
+	}
+	return fmt.Errorf("%q format is not handled", format)
+}
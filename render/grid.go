@@ -0,0 +1,28 @@
+package render
+
+import (
+	"image"
+	"image/draw"
+)
+
+// Grid tiles the given frames left-to-right, top-to-bottom into an image with
+// the given number of columns. Each cell is the size of the largest frame.
+func Grid(frames []image.Image, cols int) image.Image {
+	cols = max(min(cols, len(frames)), 1)
+	rows := (len(frames) + cols - 1) / cols
+
+	var cell image.Point
+	for _, frame := range frames {
+		size := frame.Bounds().Size()
+		cell.X = max(cell.X, size.X)
+		cell.Y = max(cell.Y, size.Y)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, cell.X*cols, cell.Y*rows))
+	for i, frame := range frames {
+		at := image.Pt(i%cols*cell.X, i/cols*cell.Y)
+		b := frame.Bounds()
+		draw.Draw(dst, image.Rectangle{Min: at, Max: at.Add(b.Size())}, frame, b.Min, draw.Src)
+	}
+	return dst
+}
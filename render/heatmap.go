@@ -0,0 +1,69 @@
+package render
+
+import (
+	"image"
+	"image/png"
+	"io"
+	"randomart/nodes"
+	"slices"
+	"sync"
+)
+
+// costHeatmap sums the number of nodes evaluated for each pixel over every
+// frame of a render.
+type costHeatmap struct {
+	w      io.Writer
+	mu     sync.Mutex
+	counts []uint64
+}
+
+// add counts the nodes evaluated for each pixel of the frame. The root should
+// be hoisted for the frame so that the counts reflect what is evaluated for
+// every pixel rather than once per frame.
+func (h *costHeatmap) add(root nodes.Node, options *renderOptions, fs *frameState) error {
+	var (
+		counts = make([]uint64, options.width*options.height)
+		roots  = layerRoots(root)
+	)
+	for y := range options.height {
+		for x := range options.width {
+			s := pixelState(x, y, options, fs)
+			for _, r := range roots {
+				cost, err := nodes.Cost(r, s)
+				if err != nil {
+					return err
+				}
+				counts[y*options.width+x] += uint64(cost)
+			}
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.counts == nil {
+		h.counts = counts
+		return nil
+	}
+	for i, c := range counts {
+		h.counts[i] += c
+	}
+	return nil
+}
+
+// write encodes the heatmap as a greyscale PNG where the most expensive pixels
+// are white and the cheapest are black. It is black if no frame was rendered,
+// such as when every frame was cancelled.
+func (h *costHeatmap) write(options *renderOptions) error {
+	img := image.NewGray(image.Rect(0, 0, options.width, options.height))
+	if len(h.counts) == 0 {
+		return png.Encode(h.w, img)
+	}
+	least, most := slices.Min(h.counts), slices.Max(h.counts)
+	if most > least {
+		for i, c := range h.counts {
+			img.Pix[i] = uint8((c - least) * 255 / (most - least))
+		}
+	}
+	options.logf("Nodes evaluated for a pixel over every frame: %d to %d\n", least, most)
+	return png.Encode(h.w, img)
+}
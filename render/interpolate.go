@@ -0,0 +1,97 @@
+package render
+
+import (
+	"context"
+	"image"
+	"iter"
+	"randomart/nodes"
+)
+
+// interpolatedFrames renders the keyframes of WithInterpolatedFrames and
+// yields them along with the frames blended between each pair of them.
+func interpolatedFrames(ctx context.Context, root nodes.Node, options *renderOptions) iter.Seq2[frameResult, error] {
+	keyOptions := *options
+	keyOptions.interpolation = 0
+	keyOptions.unordered = false
+	// The keyframes are recycled here once the frames after them have been
+	// blended.
+	keyOptions.retainFrames = true
+	keyOptions.keyframes = nil
+	for frame := options.startFrame; frame < options.endFrame; frame += options.interpolation {
+		keyOptions.keyframes = append(keyOptions.keyframes, frame)
+	}
+	if last := options.endFrame - 1; keyOptions.keyframes[len(keyOptions.keyframes)-1] != last {
+		keyOptions.keyframes = append(keyOptions.keyframes, last)
+	}
+
+	return func(yield func(frameResult, error) bool) {
+		recycle := func(imgs []image.Image) {
+			if !options.retainFrames {
+				options.buffers.put(imgs)
+			}
+		}
+		var prev frameResult
+		defer func() { recycle(prev.imgs) }()
+		for result, err := range frames(ctx, root, &keyOptions) {
+			if err != nil {
+				yield(frameResult{}, err)
+				return
+			}
+			if _, ok := result.imgs[0].(*Partial); ok || result.err != nil {
+				continue
+			}
+			// Keyframes that were cancelled are blended like the frames
+			// between keyframes.
+			if prev.imgs != nil {
+				for frame := prev.frame + 1; frame < result.frame; frame++ {
+					t := float64(frame-prev.frame) / float64(result.frame-prev.frame)
+					blended := frameResult{frame: frame, imgs: make([]image.Image, len(result.imgs))}
+					for i := range blended.imgs {
+						blended.imgs[i] = blend(prev.imgs[i], result.imgs[i], t, options.buffers)
+					}
+					ok := yield(blended, nil)
+					recycle(blended.imgs)
+					if !ok {
+						return
+					}
+				}
+				recycle(prev.imgs)
+			}
+			prev = result
+			if !yield(result, nil) {
+				return
+			}
+		}
+	}
+}
+
+// blend returns the image t of the way from a to b.
+func blend(a, b image.Image, t float64, buffers *bufferPool) image.Image {
+	switch a := a.(type) {
+	case *image.NRGBA:
+		if b, ok := b.(*image.NRGBA); ok && a.Rect == b.Rect {
+			img := buffers.get(a.Rect)
+			for i := range img.Pix {
+				img.Pix[i] = uint8(float64(a.Pix[i]) + (float64(b.Pix[i])-float64(a.Pix[i]))*t + 0.5)
+			}
+			return img
+		}
+	case *image.Gray16:
+		if b, ok := b.(*image.Gray16); ok && a.Rect == b.Rect {
+			img := image.NewGray16(a.Rect)
+			for i := 0; i < len(img.Pix); i += 2 {
+				av := float64(uint16(a.Pix[i])<<8 | uint16(a.Pix[i+1]))
+				bv := float64(uint16(b.Pix[i])<<8 | uint16(b.Pix[i+1]))
+				v := uint16(av + (bv-av)*t + 0.5)
+				img.Pix[i], img.Pix[i+1] = uint8(v>>8), uint8(v)
+			}
+			return img
+		}
+	}
+	// The frames of a render are always one of the above, so anything else
+	// isn't blended.
+	if t < 0.5 {
+		return a
+	}
+	return b
+}
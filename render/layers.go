@@ -0,0 +1,114 @@
+package render
+
+import (
+	"fmt"
+	"randomart/nodes"
+	"strings"
+)
+
+type BlendMode string
+
+const (
+	Alpha    BlendMode = "alpha"
+	Multiply BlendMode = "multiply"
+	Screen   BlendMode = "screen"
+	Overlay  BlendMode = "overlay"
+)
+
+func BlendModes() []BlendMode {
+	return []BlendMode{
+		Alpha,
+		Multiply,
+		Screen,
+		Overlay,
+	}
+}
+
+// blend blends a channel of a layer (cs) onto a channel of the layers below
+// (cb). Both are in the range [0, 1].
+func (m BlendMode) blend(cb, cs float64) float64 {
+	switch m {
+	case Multiply:
+		return cb * cs
+	case Screen:
+		return cb + cs - cb*cs
+	case Overlay:
+		if cb <= 0.5 {
+			return 2 * cb * cs
+		}
+		return 1 - 2*(1-cb)*(1-cs)
+	}
+	return cs
+}
+
+type LayerSpec struct {
+	Root nodes.Node
+	Mode BlendMode
+}
+
+type layers struct {
+	specs []LayerSpec
+}
+
+// Layers returns a root that composites the given layers bottom to top. The
+// mode of the first layer is ignored as there is nothing beneath it. Layer
+// roots can either be triples or quadruples whose fourth value is alpha.
+func Layers(specs []LayerSpec) (nodes.Node, error) {
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("at least one layer is required")
+	}
+	for i, spec := range specs {
+		if spec.Root == nil {
+			return nil, fmt.Errorf("layer %d does not have a root", i)
+		}
+		switch spec.Mode {
+		case Alpha, Multiply, Screen, Overlay:
+		default:
+			return nil, fmt.Errorf("layer %d has an unknown blend mode %q", i, spec.Mode)
+		}
+	}
+	return &layers{specs: specs}, nil
+}
+
+func (l *layers) String() string {
+	ls := make([]string, len(l.specs))
+	for i, spec := range l.specs {
+		ls[i] = fmt.Sprintf("%s: %s", spec.Mode, spec.Root)
+	}
+	return fmt.Sprintf("layers(%s)", strings.Join(ls, ", "))
+}
+
+func (l *layers) File() string { return l.specs[0].Root.File() }
+
+func (l *layers) Line() int { return l.specs[0].Root.Line() }
+
+func (l *layers) Eval(state nodes.State) (nodes.Node, error) {
+	var c [3]float64
+	var a float64
+	for i, spec := range l.specs {
+		root, err := spec.Root.Eval(state)
+		if err != nil {
+			return nil, err
+		}
+		r, g, b, as, err := nodes.IsRGBA(root)
+		if err != nil {
+			return nil, err
+		}
+		cs := [3]float64{(r + 1) / 2, (g + 1) / 2, (b + 1) / 2}
+		as = (as + 1) / 2
+		if i == 0 {
+			c, a = cs, as
+			continue
+		}
+
+		ao := as + a*(1-as)
+		for ch := range c {
+			blended := (1-a)*cs[ch] + a*spec.Mode.blend(c[ch], cs[ch])
+			if ao > 0 {
+				c[ch] = (as*blended + a*c[ch]*(1-as)) / ao
+			}
+		}
+		a = ao
+	}
+	return nodes.Color(c[0]*2-1, c[1]*2-1, c[2]*2-1, a*2-1, l), nil
+}
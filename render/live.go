@@ -0,0 +1,58 @@
+package render
+
+import (
+	"maps"
+	"strings"
+	"sync"
+)
+
+// LiveParams are values of parameters that change while rendering, such as
+// from the controls of an OSC or MIDI controller. Renders given them with
+// WithLiveParams bind their values at the start of each frame, over those
+// given with WithParam.
+type LiveParams struct {
+	mu     sync.Mutex
+	values map[string]float64
+	// changed is closed when a value is next set.
+	changed chan struct{}
+}
+
+// NewLiveParams returns LiveParams without any values, so the parameters are
+// bound to those given with WithParam until they are set.
+func NewLiveParams() *LiveParams {
+	return &LiveParams{values: make(map[string]float64), changed: make(chan struct{})}
+}
+
+// Set sets the parameter with the given name, written $name in grammars, to
+// the value.
+func (p *LiveParams) Set(name string, value float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.values[strings.TrimPrefix(name, "$")] = value
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// Values returns a copy of the values of the parameters that have been set.
+func (p *LiveParams) Values() map[string]float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return maps.Clone(p.values)
+}
+
+// Changed returns a channel that is closed when a value is next set, for
+// rerendering still images.
+func (p *LiveParams) Changed() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.changed
+}
+
+// WithLiveParams binds the values of the live parameters at the start of each
+// frame, so that animations follow them as they change.
+func WithLiveParams(params *LiveParams) RenderOption {
+	return func(options *renderOptions) error {
+		options.liveParams = params
+		return nil
+	}
+}
@@ -0,0 +1,135 @@
+package render
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// lut is a 3D colour lookup table read from a .cube file.
+type lut struct {
+	size     int
+	min, max [3]float64
+	// table is indexed by red fastest, then green, then blue.
+	table [][3]float64
+}
+
+func readLUT(r io.Reader) (*lut, error) {
+	var (
+		l       = &lut{max: [3]float64{1, 1, 1}}
+		scanner = bufio.NewScanner(r)
+	)
+	floats := func(line int, fields []string) ([3]float64, error) {
+		var v [3]float64
+		if len(fields) != 3 {
+			return v, fmt.Errorf("line %d: expected 3 values, not %d", line, len(fields))
+		}
+		for i, f := range fields {
+			var err error
+			if v[i], err = strconv.ParseFloat(f, 64); err != nil {
+				return v, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		return v, nil
+	}
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		var err error
+		switch fields[0] {
+		case "TITLE", "LUT_1D_INPUT_RANGE", "LUT_3D_INPUT_RANGE":
+		case "LUT_1D_SIZE":
+			return nil, fmt.Errorf("line %d: only 3D LUTs are supported", line)
+		case "LUT_3D_SIZE":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("line %d: expected the size", line)
+			}
+			if l.size, err = strconv.Atoi(fields[1]); err != nil || l.size < 2 {
+				return nil, fmt.Errorf("line %d: %q is not a size of at least 2", line, fields[1])
+			}
+			l.table = make([][3]float64, 0, l.size*l.size*l.size)
+		case "DOMAIN_MIN":
+			l.min, err = floats(line, fields[1:])
+		case "DOMAIN_MAX":
+			l.max, err = floats(line, fields[1:])
+		default:
+			if l.size == 0 {
+				return nil, fmt.Errorf("line %d: LUT_3D_SIZE must be given before the table", line)
+			}
+			var v [3]float64
+			v, err = floats(line, fields)
+			l.table = append(l.table, v)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if l.size == 0 {
+		return nil, fmt.Errorf("LUT_3D_SIZE is missing")
+	}
+	if len(l.table) != l.size*l.size*l.size {
+		return nil, fmt.Errorf("expected %d entries for a LUT of size %d, not %d", l.size*l.size*l.size, l.size, len(l.table))
+	}
+	for i := range 3 {
+		if l.min[i] >= l.max[i] {
+			return nil, fmt.Errorf("domain cannot be empty")
+		}
+	}
+	return l, nil
+}
+
+// at returns the colour that c, with channels between 0 and 1, is graded to
+// by interpolating between the entries around it.
+func (l *lut) at(c [3]float64) [3]float64 {
+	var (
+		i [3]int
+		f [3]float64
+	)
+	for ch := range 3 {
+		v := (c[ch] - l.min[ch]) / (l.max[ch] - l.min[ch]) * float64(l.size-1)
+		v = min(max(v, 0), float64(l.size-1))
+		i[ch] = min(int(v), l.size-2)
+		f[ch] = v - float64(i[ch])
+	}
+	var out [3]float64
+	for corner := range 8 {
+		w, idx := 1.0, 0
+		for ch, stride := range [3]int{1, l.size, l.size * l.size} {
+			if corner>>ch&1 == 1 {
+				w *= f[ch]
+				idx += (i[ch] + 1) * stride
+			} else {
+				w *= 1 - f[ch]
+				idx += i[ch] * stride
+			}
+		}
+		for ch := range 3 {
+			out[ch] += w * l.table[idx][ch]
+		}
+	}
+	return out
+}
+
+// applyLUT grades every pixel of the frame with the LUT, keeping its alpha.
+func applyLUT(options *renderOptions, fs *frameState) {
+	for _, img := range fs.imgs {
+		b := img.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := img.NRGBAAt(x, y)
+				graded := options.lut.at([3]float64{float64(c.R) / 255, float64(c.G) / 255, float64(c.B) / 255})
+				c.R = uint8(min(max(graded[0], 0), 1)*255 + 0.5)
+				c.G = uint8(min(max(graded[1], 0), 1)*255 + 0.5)
+				c.B = uint8(min(max(graded[2], 0), 1)*255 + 0.5)
+				img.SetNRGBA(x, y, c)
+			}
+		}
+	}
+}
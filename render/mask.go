@@ -0,0 +1,45 @@
+package render
+
+import (
+	"image"
+	"image/color"
+)
+
+// masked returns whether the pixel is outside of the mask, so isn't rendered.
+func (r *renderOptions) masked(x, y int) bool {
+	if r.mask == nil {
+		return false
+	}
+	_, _, _, a := r.mask.At(x, y).RGBA()
+	return a != 0xffff
+}
+
+// hasSource returns whether a source image, rather than the default uniform
+// colour, was given.
+func (r *renderOptions) hasSource() bool {
+	_, uniform := r.src.(*image.Uniform)
+	return !uniform || r.sequence != nil
+}
+
+// applyMask sets the pixels of the frame that are outside of the mask to the
+// source, or leaves them transparent if there isn't one.
+func applyMask(options *renderOptions, fs *frameState) {
+	var (
+		src = options.hasSource()
+		b   = fs.imgs[0].Bounds()
+	)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if !options.masked(x, y) {
+				continue
+			}
+			var c color.NRGBA
+			if src {
+				c = color.NRGBAModel.Convert(fs.sampler.At(x, y)).(color.NRGBA)
+			}
+			for _, img := range fs.imgs {
+				img.SetNRGBA(x, y, c)
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package render
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the buckets of the
+// histogram of how long workers take to render bands.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// workerMetrics are the metrics of the bands rendered by Serve.
+var workerMetrics = struct {
+	connections *expvar.Int
+	requests    *expvar.Int
+	errors      *expvar.Int
+	inFlight    *expvar.Int
+
+	mu      sync.Mutex
+	buckets []uint64
+	sum     float64
+}{
+	connections: expvar.NewInt("randomart_worker_connections"),
+	requests:    expvar.NewInt("randomart_worker_requests_total"),
+	errors:      expvar.NewInt("randomart_worker_request_errors_total"),
+	inFlight:    expvar.NewInt("randomart_worker_requests_in_flight"),
+	buckets:     make([]uint64, len(latencyBuckets)+1),
+}
+
+// observeRequest records that a band was rendered in the given time.
+func observeRequest(d time.Duration, err error) {
+	workerMetrics.requests.Add(1)
+	if err != nil {
+		workerMetrics.errors.Add(1)
+	}
+	workerMetrics.mu.Lock()
+	defer workerMetrics.mu.Unlock()
+	i := 0
+	for i < len(latencyBuckets) && d.Seconds() > latencyBuckets[i] {
+		i++
+	}
+	workerMetrics.buckets[i]++
+	workerMetrics.sum += d.Seconds()
+}
+
+// MetricsHandler serves the metrics of the bands rendered by Serve, such as
+// how many have been rendered, how many failed, how many are being rendered
+// and how long they took, in the Prometheus text format. The counters are
+// also published with expvar.
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		metric := func(name, kind, help string, v int64) {
+			fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, kind, name, v)
+		}
+		metric("randomart_worker_connections", "gauge", "Connections from coordinators.", workerMetrics.connections.Value())
+		metric("randomart_worker_requests_total", "counter", "Bands rendered.", workerMetrics.requests.Value())
+		metric("randomart_worker_request_errors_total", "counter", "Bands that could not be rendered.", workerMetrics.errors.Value())
+		metric("randomart_worker_requests_in_flight", "gauge", "Bands being rendered.", workerMetrics.inFlight.Value())
+
+		workerMetrics.mu.Lock()
+		defer workerMetrics.mu.Unlock()
+		const name = "randomart_worker_request_duration_seconds"
+		fmt.Fprintf(w, "# HELP %s How long bands took to render.\n# TYPE %s histogram\n", name, name)
+		var count uint64
+		for i, le := range latencyBuckets {
+			count += workerMetrics.buckets[i]
+			fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", name, le, count)
+		}
+		count += workerMetrics.buckets[len(latencyBuckets)]
+		fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n%s_sum %g\n%s_count %d\n", name, count, name, workerMetrics.sum, name, count)
+	})
+}
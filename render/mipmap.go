@@ -0,0 +1,108 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+type mipmap struct {
+	levels []image.Image
+}
+
+func newMipmap(src image.Image) *mipmap {
+	m := &mipmap{levels: []image.Image{src}}
+	for {
+		prev := m.levels[len(m.levels)-1]
+		b := prev.Bounds()
+		if b.Dx() <= 1 && b.Dy() <= 1 {
+			break
+		}
+		m.levels = append(m.levels, halve(prev))
+	}
+	return m
+}
+
+// halve box-filters the given image down to half its size. Odd edges are
+// folded into the last row/column so that no source pixel is ignored.
+func halve(img image.Image) image.Image {
+	b := img.Bounds()
+	w, h := max(b.Dx()/2, 1), max(b.Dy()/2, 1)
+	dst := image.NewRGBA64(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := y*2, y*2+2
+		if y == h-1 {
+			y1 = b.Dy()
+		}
+		for x := 0; x < w; x++ {
+			x0, x1 := x*2, x*2+2
+			if x == w-1 {
+				x1 = b.Dx()
+			}
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(b.Min.X+sx, b.Min.Y+sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					bl += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(bl / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
+
+// level returns the pyramid level whose resolution is closest to, but not
+// smaller than, the given output resolution.
+func (m *mipmap) level(width, height int) image.Image {
+	b := m.levels[0].Bounds()
+	scale := max(float64(b.Dx())/float64(width), float64(b.Dy())/float64(height))
+	if scale < 2 {
+		return m.levels[0]
+	}
+	l := int(math.Floor(math.Log2(scale)))
+	return m.levels[min(l, len(m.levels)-1)]
+}
+
+type scaledSource struct {
+	src           image.Image
+	width, height int
+}
+
+func (s *scaledSource) ColorModel() color.Model { return s.src.ColorModel() }
+
+func (s *scaledSource) Bounds() image.Rectangle { return image.Rect(0, 0, s.width, s.height) }
+
+func (s *scaledSource) At(x, y int) color.Color {
+	b := s.src.Bounds()
+	sx := b.Min.X + min(int((float64(x)+0.5)*float64(b.Dx())/float64(s.width)), b.Dx()-1)
+	sy := b.Min.Y + min(int((float64(y)+0.5)*float64(b.Dy())/float64(s.height)), b.Dy()-1)
+	return s.src.At(sx, sy)
+}
+
+// newSampler returns an image of the given resolution that samples the given
+// source. Sources much larger than the output are sampled from an
+// area-averaged mip level rather than point-sampled to avoid aliasing.
+func newSampler(src image.Image, width, height int) image.Image {
+	if _, ok := src.(*image.Uniform); ok {
+		return src
+	}
+	b := src.Bounds()
+	if b.Dx() == width && b.Dy() == height && b.Min == (image.Point{}) {
+		return src
+	}
+	return &scaledSource{
+		src:    newMipmap(src).level(width, height),
+		width:  width,
+		height: height,
+	}
+}
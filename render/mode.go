@@ -0,0 +1,59 @@
+package render
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+)
+
+// Mode is how the colours of the root are written to the rendered images.
+type Mode string
+
+const (
+	// RGBA renders the colours of the root as they are.
+	RGBA Mode = "rgba"
+	// Grayscale renders the luminance of the colours of the root, so roots
+	// can be numbers rather than triples.
+	Grayscale Mode = "grayscale"
+	// Gray16 is Grayscale but renders 16-bit images, which have the precision
+	// needed for heightmaps.
+	Gray16 Mode = "gray16"
+	// NormalMap treats the luminance of the colours of the root as heights
+	// and renders their tangent-space normals.
+	NormalMap Mode = "normal"
+)
+
+func Modes() []Mode {
+	return []Mode{
+		RGBA,
+		Grayscale,
+		Gray16,
+		NormalMap,
+	}
+}
+
+func ParseMode(mode string) (Mode, error) {
+	mode = strings.ToLower(mode)
+	for _, m := range Modes() {
+		if string(m) == mode {
+			return m, nil
+		}
+	}
+	return "", fmt.Errorf("%q is not a supported mode", mode)
+}
+
+// gray returns whether the mode renders luminance.
+func (m Mode) gray() bool {
+	return m == Grayscale || m == Gray16 || m == NormalMap
+}
+
+// gray16 returns the 16-bit grey of a channel between -1 and 1.
+func gray16(v float64) color.Gray16 {
+	return color.Gray16{Y: uint16(min(max((v+1)/2, 0), 1) * 0xffff)}
+}
+
+// luminance returns the luminance of the colour with channels between -1
+// and 1, also between -1 and 1.
+func luminance(c [4]float64) float64 {
+	return 0.2126*c[0] + 0.7152*c[1] + 0.0722*c[2]
+}
@@ -0,0 +1,56 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// applyNormalMap replaces the pixels of the frame with the tangent-space
+// normals of the heights of its outputs, with green pointing up. The slopes
+// are measured in the units of x and y so that the normals don't depend on
+// the resolution.
+func applyNormalMap(options *renderOptions, fs *frameState) {
+	var (
+		w, h   = options.width, options.height
+		stepX  = (options.viewport.maxX - options.viewport.minX) / float64(w)
+		stepY  = (options.viewport.maxY - options.viewport.minY) / float64(h)
+		encode = func(v float64) uint8 { return uint8((v+1)/2*255 + 0.5) }
+	)
+	for o, heights := range fs.heights {
+		at := func(x, y int) float64 {
+			return heights[min(max(y, 0), h-1)*w+min(max(x, 0), w-1)]
+		}
+		for y := range h {
+			for x := range w {
+				dx := (at(x+1, y) - at(x-1, y)) / (float64(min(x+1, w-1)-max(x-1, 0)) * stepX)
+				dy := (at(x, y+1) - at(x, y-1)) / (float64(min(y+1, h-1)-max(y-1, 0)) * stepY)
+				if w == 1 {
+					dx = 0
+				}
+				if h == 1 {
+					dy = 0
+				}
+				// y grows downwards, so the slope upwards is -dy.
+				nx, ny, nz := -dx, dy, 1.0
+				l := math.Sqrt(nx*nx + ny*ny + nz*nz)
+				c := fs.imgs[o].NRGBAAt(x, y)
+				fs.imgs[o].SetNRGBA(x, y, color.NRGBA{R: encode(nx / l), G: encode(ny / l), B: encode(nz / l), A: c.A})
+			}
+		}
+	}
+}
+
+// heightmaps returns the heights of the outputs of the frame as 16-bit
+// greyscale images.
+func heightmaps(options *renderOptions, fs *frameState) []image.Image {
+	imgs := make([]image.Image, len(fs.heights))
+	for o, heights := range fs.heights {
+		img := image.NewGray16(image.Rect(0, 0, options.width, options.height))
+		for i, v := range heights {
+			img.SetGray16(i%options.width, i/options.width, gray16(v))
+		}
+		imgs[o] = img
+	}
+	return imgs
+}
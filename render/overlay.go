@@ -0,0 +1,72 @@
+package render
+
+import (
+	"image/color"
+	"randomart/nodes"
+)
+
+// layerRoots returns the roots of each layer of the root, or just the root if
+// it isn't layered, for debugging tools that need to look inside the layers.
+func layerRoots(root nodes.Node) []nodes.Node {
+	l, ok := root.(*layers)
+	if !ok {
+		return []nodes.Node{root}
+	}
+	roots := make([]nodes.Node, len(l.specs))
+	for i, spec := range l.specs {
+		roots[i] = spec.Root
+	}
+	return roots
+}
+
+// pixelState returns the state at the centre of the pixel at x and y.
+func pixelState(x, y int, options *renderOptions, fs *frameState) nodes.State {
+	s := nodes.S(x, y, options.width, options.height, fs.frame, options.frames, fs.sampler.At(x, y))
+	if options.tileable {
+		s.X, s.Y = options.tile(s.X, s.Y)
+	}
+	s.X, s.Y = options.viewport.transform(s.X, s.Y)
+	s.Data = fs.data
+	return s
+}
+
+// branchOverlay tints every pixel of the frame by the branches of the
+// if/then/else nodes taken to evaluate it, so that pixels that went the same
+// way through the root share a colour. The root must not be hoisted, as that
+// folds away the if/then/else nodes whose conditions only depend on f.
+func branchOverlay(root nodes.Node, options *renderOptions, fs *frameState) error {
+	var tracers []*nodes.BranchTracer
+	for _, r := range layerRoots(root) {
+		tracers = append(tracers, nodes.NewBranchTracer(r))
+	}
+	for y := range options.height {
+		for x := range options.width {
+			s := pixelState(x, y, options, fs)
+			var h uint64
+			for _, t := range tracers {
+				branches, err := t.Branches(s)
+				if err != nil {
+					return err
+				}
+				for _, b := range branches {
+					h = splitmix64(h ^ uint64(b.Index))
+					if b.Then {
+						h = splitmix64(h)
+					}
+				}
+			}
+
+			tint := color.NRGBA{R: uint8(h >> 16), G: uint8(h >> 8), B: uint8(h), A: 255}
+			for _, img := range fs.imgs {
+				c := img.NRGBAAt(x, y)
+				img.SetNRGBA(x, y, color.NRGBA{
+					R: uint8((uint16(c.R) + uint16(tint.R)) / 2),
+					G: uint8((uint16(c.G) + uint16(tint.G)) / 2),
+					B: uint8((uint16(c.B) + uint16(tint.B)) / 2),
+					A: 255,
+				})
+			}
+		}
+	}
+	return nil
+}
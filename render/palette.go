@@ -0,0 +1,75 @@
+package render
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"strings"
+)
+
+// ReadPalette reads a palette with a hex colour, such as ff8000 or #ff8000,
+// on each line as in the .hex files of palette sites such as lospec. Blank
+// lines and lines starting with ; are ignored.
+func ReadPalette(r io.Reader) ([]color.Color, error) {
+	var (
+		palette []color.Color
+		scanner = bufio.NewScanner(r)
+	)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimPrefix(strings.TrimSpace(scanner.Text()), "#")
+		if text == "" || strings.HasPrefix(text, ";") {
+			continue
+		}
+		b, err := hex.DecodeString(text)
+		if err != nil || len(b) != 3 {
+			return nil, fmt.Errorf("line %d: %q is not a hex colour", line, scanner.Text())
+		}
+		palette = append(palette, color.NRGBA{R: b[0], G: b[1], B: b[2], A: 255})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return palette, nil
+}
+
+// nearest returns the colour of the palette that is closest to r, g and b.
+func nearest(palette []color.NRGBA, r, g, b float64) color.NRGBA {
+	var (
+		closest  color.NRGBA
+		distance = math.Inf(1)
+	)
+	for _, p := range palette {
+		dr, dg, db := r-float64(p.R), g-float64(p.G), b-float64(p.B)
+		if d := dr*dr + dg*dg + db*db; d < distance {
+			closest, distance = p, d
+		}
+	}
+	return closest
+}
+
+// applyPalette replaces the colour of every pixel of the frame with the
+// nearest in the palette, keeping its alpha.
+func applyPalette(options *renderOptions, fs *frameState) {
+	// The spread of the dither is about the distance between the colours of
+	// the palette if they were evenly spaced.
+	spread := 255 / math.Cbrt(float64(len(options.palette)))
+	for _, img := range fs.imgs {
+		b := img.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := img.NRGBAAt(x, y)
+				r, g, b := float64(c.R), float64(c.G), float64(c.B)
+				if options.paletteDither {
+					d := ((bayer[y%4][x%4]+0.5)/16 - 0.5) * spread
+					r, g, b = r+d, g+d, b+d
+				}
+				p := nearest(options.palette, r, g, b)
+				p.A = c.A
+				img.SetNRGBA(x, y, p)
+			}
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package render
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"image"
+	"image/color"
+	"image/draw"
+	"log/slog"
+	"net"
+	"randomart/nodes"
+	"runtime"
+	"sync"
+	"time"
+)
+
+type remoteLayer struct {
+	Root []byte
+	Mode BlendMode
+}
+
+// remoteRequest asks a worker to render the rows in [MinY, MaxY) of a frame.
+// The source is either a uniform colour or the pixels of those rows.
+type remoteRequest struct {
+	Root     []byte
+	Layers   []remoteLayer
+	Width    int
+	Height   int
+	Frames   int
+	Samples  int
+	Jitter   float64
+	FastMath bool
+	Tileable bool
+	Mode     Mode
+	Viewport [4]float64
+	Frame    int
+	MinY     int
+	MaxY     int
+	Uniform  *color.NRGBA
+	Src      []byte
+	// PixelTimeout is that of WithPixelTimeout.
+	PixelTimeout time.Duration
+}
+
+// The largest frames that workers render bands of, matching the default limits
+// of the rpc package, so that peers can't make them allocate huge images.
+const (
+	maxRemoteWidth   = 4096
+	maxRemoteHeight  = 4096
+	maxRemoteFrames  = 600
+	maxRemoteSamples = 64
+)
+
+// remoteResponse contains the pixels of the requested rows for each output.
+type remoteResponse struct {
+	Pix [][]byte
+	Err string
+}
+
+func marshalRoot(root nodes.Node, req *remoteRequest) (err error) {
+	if l, ok := root.(*layers); ok {
+		req.Layers = make([]remoteLayer, len(l.specs))
+		for i, spec := range l.specs {
+			req.Layers[i].Mode = spec.Mode
+			if req.Layers[i].Root, err = nodes.MarshalNode(spec.Root); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	req.Root, err = nodes.MarshalNode(root)
+	return err
+}
+
+func unmarshalRoot(req *remoteRequest) (nodes.Node, error) {
+	if len(req.Layers) == 0 {
+		return nodes.UnmarshalNode(req.Root)
+	}
+	specs := make([]LayerSpec, len(req.Layers))
+	for i, layer := range req.Layers {
+		root, err := nodes.UnmarshalNode(layer.Root)
+		if err != nil {
+			return nil, err
+		}
+		specs[i] = LayerSpec{Root: root, Mode: layer.Mode}
+	}
+	return Layers(specs)
+}
+
+type remoteConn struct {
+	addr string
+	conn net.Conn
+	enc  *gob.Encoder
+	dec  *gob.Decoder
+}
+
+func (c *remoteConn) render(req *remoteRequest) (*remoteResponse, error) {
+	var resp remoteResponse
+	if err := c.enc.Encode(req); err != nil {
+		return nil, fmt.Errorf("could not send request to worker %s: %w", c.addr, err)
+	}
+	if err := c.dec.Decode(&resp); err != nil {
+		return nil, fmt.Errorf("could not receive response from worker %s: %w", c.addr, err)
+	}
+	if resp.Err != "" {
+		return nil, fmt.Errorf("worker %s: %s", c.addr, resp.Err)
+	}
+	return &resp, nil
+}
+
+// remoteWorkers farms out bands of frames to workers started with Serve. Each
+// worker has a single connection which is used by one band at a time.
+type remoteWorkers struct {
+	conns   chan *remoteConn
+	all     []*remoteConn
+	request remoteRequest
+	options *renderOptions
+	stop    func() bool
+}
+
+func dialRemoteWorkers(ctx context.Context, root nodes.Node, options *renderOptions) (*remoteWorkers, error) {
+	r := &remoteWorkers{
+		conns:   make(chan *remoteConn, len(options.remoteWorkers)),
+		options: options,
+		request: remoteRequest{
+			Width:        options.width,
+			Height:       options.height,
+			Frames:       options.frames,
+			Samples:      options.samples,
+			Jitter:       options.jitter,
+			FastMath:     options.fastMath,
+			Tileable:     options.tileable,
+			Mode:         options.mode,
+			Viewport:     [4]float64{options.viewport.minX, options.viewport.minY, options.viewport.maxX, options.viewport.maxY},
+			PixelTimeout: options.pixelTimeout,
+		},
+	}
+	if err := marshalRoot(root, &r.request); err != nil {
+		return nil, fmt.Errorf("could not serialize root for remote workers: %w", err)
+	}
+
+	var dialer net.Dialer
+	for _, addr := range options.remoteWorkers {
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			r.close()
+			return nil, fmt.Errorf("could not connect to worker %s: %w", addr, err)
+		}
+		c := &remoteConn{addr: addr, conn: conn, enc: gob.NewEncoder(conn), dec: gob.NewDecoder(conn)}
+		r.all = append(r.all, c)
+		r.conns <- c
+	}
+	// Closing the connections unblocks any bands waiting on a worker.
+	r.stop = context.AfterFunc(ctx, r.closeConns)
+	return r, nil
+}
+
+func (r *remoteWorkers) closeConns() {
+	for _, c := range r.all {
+		_ = c.conn.Close()
+	}
+}
+
+func (r *remoteWorkers) close() {
+	if r.stop != nil {
+		r.stop()
+	}
+	r.closeConns()
+}
+
+// remoteBandsPerWorker is how many bands each frame is split into for every
+// worker, so that workers that finish their bands early take on more of the
+// frame rather than waiting for those given expensive bands.
+const remoteBandsPerWorker = 4
+
+// renderFrame splits the frame into bands and renders them on whichever
+// workers are free.
+func (r *remoteWorkers) renderFrame(ctx context.Context, fs *frameState) error {
+	var (
+		wg      sync.WaitGroup
+		errOnce sync.Once
+		err     error
+		bands   = min(len(r.all)*remoteBandsPerWorker, r.request.Height)
+		rows    = (r.request.Height + bands - 1) / bands
+	)
+	for minY := 0; minY < r.request.Height; minY += rows {
+		req := r.request
+		req.Frame, req.MinY, req.MaxY = fs.frame, minY, min(minY+rows, r.request.Height)
+		bounds := image.Rect(0, req.MinY, req.Width, req.MaxY)
+		if u, ok := fs.sampler.(*image.Uniform); ok {
+			c := color.NRGBAModel.Convert(u.C).(color.NRGBA)
+			req.Uniform = &c
+		} else {
+			src := image.NewNRGBA(bounds)
+			draw.Draw(src, bounds, fs.sampler, bounds.Min, draw.Src)
+			req.Src = src.Pix
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, span := r.options.tracer.Start(ctx, "randomart.band", trace.WithAttributes(
+				attribute.Int("frame", req.Frame),
+				attribute.Int("min_y", req.MinY),
+				attribute.Int("max_y", req.MaxY),
+			))
+			bandErr := func() error {
+				var c *remoteConn
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case c = <-r.conns:
+				}
+				defer func() { r.conns <- c }()
+				span.SetAttributes(attribute.String("worker", c.addr))
+
+				start := time.Now()
+				resp, err := c.render(&req)
+				if err != nil {
+					return err
+				}
+				r.options.event(ctx, slog.LevelDebug, "band finished",
+					"frame", req.Frame, "min_y", req.MinY, "max_y", req.MaxY,
+					"worker", c.addr, "duration", time.Since(start),
+				)
+				if len(resp.Pix) != len(fs.imgs) {
+					return fmt.Errorf("worker %s returned %d outputs, expected %d", c.addr, len(resp.Pix), len(fs.imgs))
+				}
+				for i, img := range fs.imgs {
+					band := img.Pix[img.PixOffset(bounds.Min.X, bounds.Min.Y):img.PixOffset(bounds.Min.X, bounds.Max.Y)]
+					if len(resp.Pix[i]) != len(band) {
+						return fmt.Errorf("worker %s returned %d bytes for output %d, expected %d", c.addr, len(resp.Pix[i]), i, len(band))
+					}
+					copy(band, resp.Pix[i])
+				}
+				return nil
+			}()
+			endSpan(span, bandErr)
+			if bandErr != nil {
+				errOnce.Do(func() { err = bandErr })
+			}
+		}()
+	}
+	wg.Wait()
+	return err
+}
+
+func serveRequest(req *remoteRequest) ([][]byte, error) {
+	root, err := unmarshalRoot(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not deserialize root: %w", err)
+	}
+
+	options := defaultRenderOptions()
+	options.width, options.height = req.Width, req.Height
+	options.frames, options.samples, options.jitter = req.Frames, req.Samples, req.Jitter
+	options.viewport = viewport{minX: req.Viewport[0], minY: req.Viewport[1], maxX: req.Viewport[2], maxY: req.Viewport[3]}
+	options.tileable = req.Tileable
+	options.fastMath = req.FastMath
+	if req.Mode != "" {
+		options.mode = req.Mode
+	}
+	if req.MinY < 0 || req.MaxY > req.Height || req.MinY >= req.MaxY || req.Width <= 0 || req.Samples <= 0 {
+		return nil, fmt.Errorf("invalid band [%d, %d) of a %dx%d frame", req.MinY, req.MaxY, req.Width, req.Height)
+	}
+	if req.Width > maxRemoteWidth || req.Height > maxRemoteHeight || req.Frames > maxRemoteFrames || req.Samples > maxRemoteSamples {
+		return nil, fmt.Errorf("a %dx%d frame of %d frames with %d samples is more than the %dx%d, %d frames and %d samples that workers render",
+			req.Width, req.Height, req.Frames, req.Samples, maxRemoteWidth, maxRemoteHeight, maxRemoteFrames, maxRemoteSamples)
+	}
+	if req.PixelTimeout < 0 {
+		return nil, fmt.Errorf("pixel timeout cannot be negative")
+	}
+	options.pixelTimeout = req.PixelTimeout
+
+	bounds := image.Rect(0, req.MinY, req.Width, req.MaxY)
+	var sampler image.Image
+	if req.Uniform != nil {
+		sampler = image.NewUniform(*req.Uniform)
+	} else {
+		if len(req.Src) != bounds.Dx()*bounds.Dy()*4 {
+			return nil, fmt.Errorf("source has %d bytes, expected %d", len(req.Src), bounds.Dx()*bounds.Dy()*4)
+		}
+		sampler = &image.NRGBA{Pix: req.Src, Stride: bounds.Dx() * 4, Rect: bounds}
+	}
+
+	root = hoist(root, options, req.Frame)
+	imgs := make([]*image.NRGBA, max(len(nodes.OutputNames(root)), 1))
+	for i := range imgs {
+		imgs[i] = image.NewNRGBA(bounds)
+	}
+	fs := &frameState{frame: req.Frame, sampler: sampler, imgs: imgs}
+	if err = renderBand(context.Background(), root, options, fs, bounds, runtime.NumCPU()); err != nil {
+		return nil, err
+	}
+
+	pix := make([][]byte, len(imgs))
+	for i, img := range imgs {
+		pix[i] = img.Pix
+	}
+	return pix, nil
+}
+
+func serveConn(conn net.Conn) {
+	defer conn.Close()
+	workerMetrics.connections.Add(1)
+	defer workerMetrics.connections.Add(-1)
+	dec, enc := gob.NewDecoder(conn), gob.NewEncoder(conn)
+	for {
+		var req remoteRequest
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+		var resp remoteResponse
+		workerMetrics.inFlight.Add(1)
+		start := time.Now()
+		pix, err := serveRequest(&req)
+		observeRequest(time.Since(start), err)
+		workerMetrics.inFlight.Add(-1)
+		if err != nil {
+			resp.Err = err.Error()
+		}
+		resp.Pix = pix
+		if err = enc.Encode(&resp); err != nil {
+			return
+		}
+	}
+}
+
+// Serve renders bands of frames for coordinators using WithRemoteWorkers
+// until the context is cancelled. Connections aren't authenticated, so workers
+// must only listen on trusted networks.
+func Serve(ctx context.Context, l net.Listener) error {
+	stop := context.AfterFunc(ctx, func() { _ = l.Close() })
+	defer stop()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return ctx.Err()
+			}
+			return err
+		}
+		go serveConn(conn)
+	}
+}
@@ -2,15 +2,23 @@ package render
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 	"image"
 	"image/color"
 	_ "image/jpeg"
 	_ "image/png"
 	"io"
 	"iter"
+	"log/slog"
 	"randomart/nodes"
+	"runtime"
 	"slices"
+	"strings"
 	"sync"
 	"time"
 )
@@ -21,6 +29,7 @@ type pool[J any, R any] struct {
 	jobs    chan J
 	results chan R
 	wg      *sync.WaitGroup
+	stop    sync.Once
 }
 
 func worker[J any, R any](ctx context.Context, jobs <-chan J, results chan<- R, process func(job J) R) {
@@ -29,12 +38,19 @@ func worker[J any, R any](ctx context.Context, jobs <-chan J, results chan<- R,
 		case <-ctx.Done():
 			return
 		case job, ok := <-jobs:
-			if !ok {
+			if !ok || ctx.Err() != nil {
 				return
 			}
 
+			// Results are kept if there's room for them after the pool has
+			// been stopped, so that they can be drained.
 			result := process(job)
 			select {
+			case results <- result:
+				continue
+			default:
+			}
+			select {
 			case <-ctx.Done():
 				return
 			case results <- result:
@@ -77,73 +93,595 @@ func (p *pool[J, R]) run(ctx context.Context, job J) error {
 	return nil
 }
 
+// stopAndWait stops the workers and waits for them to finish. Jobs aren't
+// closed as they may still be being sent, but the workers stop anyway.
 func (p *pool[J, R]) stopAndWait() {
-	p.cancel()
-	close(p.jobs)
-	p.wg.Wait()
-	close(p.results)
+	p.stop.Do(func() {
+		p.cancel()
+		p.wg.Wait()
+		close(p.results)
+	})
 }
 
-func renderPoint(root nodes.Node, s nodes.State) (color.Color, error) {
-	root, err := root.Eval(s)
-	if err != nil {
-		return nil, err
+type frameState struct {
+	frame   int
+	data    any
+	sampler image.Image
+	imgs    []*image.NRGBA
+	gray16  []*image.Gray16
+	heights [][]float64
+	colours [][][4]float64
+	states  []nodes.State
+	out     [][4]float64
+	arena   nodes.Arena
+}
+
+// newFrameState returns the state of the frame, with images of the given
+// bounds.
+func newFrameState(frame, outputs int, options *renderOptions, bounds image.Rectangle) (*frameState, error) {
+	fs := &frameState{
+		frame:   frame,
+		sampler: options.sampler,
+		imgs:    make([]*image.NRGBA, outputs),
 	}
-	r, g, b, err := nodes.IsRoot(root)
-	if err != nil {
-		return nil, err
+	if options.sequence != nil {
+		src, err := options.sequence(frame)
+		if err != nil {
+			return nil, fmt.Errorf("could not get source image for frame %d: %w", frame, err)
+		}
+		fs.sampler = newSampler(src, options.width, options.height)
 	}
-	return color.RGBA{
-		R: uint8((r + 1) / 2 * 255),
-		G: uint8((g + 1) / 2 * 255),
-		B: uint8((b + 1) / 2 * 255),
-		A: 255,
-	}, nil
+	if options.stateData != nil {
+		fs.data = options.stateData(frame)
+	}
+	fs.arena.FastMath = options.fastMath
+	for i := range fs.imgs {
+		fs.imgs[i] = options.buffers.get(bounds)
+	}
+	if options.dithering != NoDithering && options.mode != Gray16 && options.mode != NormalMap {
+		fs.colours = make([][][4]float64, outputs)
+		for i := range fs.colours {
+			fs.colours[i] = make([][4]float64, options.width*options.height)
+		}
+	}
+	if options.mode == NormalMap {
+		fs.heights = make([][]float64, outputs)
+		for i := range fs.heights {
+			fs.heights[i] = make([]float64, options.width*options.height)
+		}
+	}
+	if options.mode == Gray16 {
+		fs.gray16 = make([]*image.Gray16, outputs)
+		for i := range fs.gray16 {
+			fs.gray16[i] = image.NewGray16(image.Rect(0, 0, options.width, options.height))
+		}
+	}
+	return fs, nil
 }
 
-func points(width, height int) iter.Seq2[int, int] {
-	return func(yield func(int, int) bool) {
-		for y := 0; y < height; y++ {
-			for x := 0; x < width; x++ {
-				if !yield(x, y) {
-					return
+func (fs *frameState) images() []image.Image {
+	imgs := make([]image.Image, len(fs.imgs))
+	for i, img := range fs.imgs {
+		imgs[i] = img
+		if fs.gray16 != nil {
+			imgs[i] = fs.gray16[i]
+		}
+	}
+	return imgs
+}
+
+// hoist folds the parts of the root that are the same for every pixel of the
+// frame and then shares its common subexpressions, see nodes.Hoist and
+// nodes.Dedupe.
+func hoist(root nodes.Node, options *renderOptions, frame int) nodes.Node {
+	f := nodes.S(0, 0, options.width, options.height, frame, options.frames, color.White).F
+	fold := func(root nodes.Node) nodes.Node {
+		if options.motionBlur > 1 {
+			// f differs between the samples of a pixel, so can't be folded.
+			return nodes.Dedupe(root)
+		}
+		return nodes.Dedupe(nodes.Hoist(root, f))
+	}
+	if l, ok := root.(*layers); ok {
+		specs := slices.Clone(l.specs)
+		for i := range specs {
+			specs[i].Root = fold(specs[i].Root)
+		}
+		return &layers{specs: specs}
+	}
+	return fold(root)
+}
+
+// bindParams binds the parameters of the root, or of each of its layers.
+func bindParams(root nodes.Node, params map[string]float64) nodes.Node {
+	if l, ok := root.(*layers); ok {
+		specs := slices.Clone(l.specs)
+		for i := range specs {
+			specs[i].Root = nodes.Bind(specs[i].Root, params)
+		}
+		return &layers{specs: specs}
+	}
+	return nodes.Bind(root, params)
+}
+
+// FrameError is the error of evaluating the expression at a pixel of a frame.
+// X is -1 if the error isn't that of any one pixel of row Y.
+type FrameError struct {
+	Frame, X, Y int
+	Err         error
+}
+
+func (e *FrameError) Error() string {
+	if e.X < 0 {
+		return fmt.Sprintf("frame %d, row %d: %s", e.Frame, e.Y, e.Err)
+	}
+	return fmt.Sprintf("frame %d, pixel %d, %d: %s", e.Frame, e.X, e.Y, e.Err)
+}
+
+func (e *FrameError) Unwrap() error {
+	return e.Err
+}
+
+// rowError returns the error of evaluating a row as a FrameError, at the first
+// pixel whose states the root can't be evaluated at one by one.
+func rowError(root nodes.Node, err error, y int, xs []int, fs *frameState) *FrameError {
+	fe := &FrameError{Frame: fs.frame, X: -1, Y: y, Err: err}
+	outputs := max(len(nodes.OutputNames(root)), 1)
+	samples := len(fs.states) / max(len(xs), 1)
+	for i, state := range fs.states {
+		n, err := root.Eval(state)
+		for o := 0; err == nil && o < outputs; o++ {
+			_, _, _, _, err = nodes.IsOutput(n, o)
+		}
+		if err != nil {
+			fe.X, fe.Err = xs[i/samples], err
+			break
+		}
+	}
+	return fe
+}
+
+// fillErrors evaluates the states of the row one by one, giving those that
+// can't be evaluated the error colour and reporting the first error of each of
+// their pixels.
+func fillErrors(root nodes.Node, y int, xs []int, options *renderOptions, fs *frameState) {
+	var (
+		outputs  = len(fs.imgs)
+		samples  = len(fs.states) / max(len(xs), 1)
+		reported = -1
+	)
+	for i, state := range fs.states {
+		out := fs.out[i*outputs : (i+1)*outputs]
+		n, err := root.Eval(state)
+		for o := 0; err == nil && o < outputs; o++ {
+			c := &out[o]
+			c[0], c[1], c[2], c[3], err = nodes.IsOutput(n, o)
+		}
+		if err == nil {
+			continue
+		}
+		for o := range out {
+			out[o] = *options.errorColor
+		}
+		if pixel := i / samples; pixel != reported {
+			reported = pixel
+			options.pixelErrors.add(&FrameError{Frame: fs.frame, X: xs[pixel], Y: y, Err: err})
+		}
+	}
+}
+
+// maxPixelErrors is how many errors of pixels are kept for Stats.PixelErrors.
+const maxPixelErrors = 100
+
+// pixelErrors collects the errors of the pixels given the error colour.
+type pixelErrors struct {
+	mu     sync.Mutex
+	failed int
+	errs   []*FrameError
+}
+
+func (p *pixelErrors) add(err *FrameError) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failed++
+	p.errs = append(p.errs, err)
+	if len(p.errs) > maxPixelErrors {
+		// Only the first are kept, in the order of their frames and pixels,
+		// as rows are rendered concurrently.
+		slices.SortFunc(p.errs, compareFrameErrors)
+		p.errs = p.errs[:maxPixelErrors]
+	}
+}
+
+func compareFrameErrors(a, b *FrameError) int {
+	if a.Frame != b.Frame {
+		return a.Frame - b.Frame
+	}
+	if a.Y != b.Y {
+		return a.Y - b.Y
+	}
+	return a.X - b.X
+}
+
+// renderRow renders the pixels at the given xs of row y. The states of every
+// sample of every pixel are evaluated at once with the frame's arena.
+func renderRow(root nodes.Node, y int, xs []int, options *renderOptions, fs *frameState) error {
+	var (
+		outputs = len(fs.imgs)
+		samples = options.samplesPerPixel()
+		n       = len(xs) * samples
+	)
+	if options.mask != nil {
+		xs = slices.DeleteFunc(slices.Clone(xs), func(x int) bool {
+			return options.masked(x, y)
+		})
+		n = len(xs) * samples
+	}
+	fs.states = slices.Grow(fs.states[:0], n)[:n]
+	fs.out = slices.Grow(fs.out[:0], n*outputs)[:n*outputs]
+	for i, x := range xs {
+		src := fs.sampler.At(x, y)
+		for sample := range samples {
+			dx, dy := options.jitterOffset(x, y, fs.frame, sample%options.samples)
+			s := nodes.SF(
+				float64(x)+dx, float64(y)+dy,
+				options.width, options.height,
+				fs.frame, options.frames,
+				src,
+			)
+			if options.motionBlur > 1 {
+				s.F = options.subframeF(fs.frame, sample/options.samples)
+			}
+			if options.tileable {
+				s.X, s.Y = options.tile(s.X, s.Y)
+			}
+			s.X, s.Y = options.viewport.transform(s.X, s.Y)
+			s.Data = fs.data
+			fs.states[i*samples+sample] = s
+		}
+	}
+	if options.pixelTimeout > 0 {
+		fs.arena.Deadline = time.Now().Add(options.pixelTimeout * time.Duration(len(xs)))
+	}
+	if err := fs.arena.EvalRow(root, fs.states, fs.out); err != nil {
+		if errors.Is(err, nodes.ErrDeadlineExceeded) {
+			// Evaluating the pixels one by one would take too long too.
+			return &FrameError{Frame: fs.frame, X: -1, Y: y, Err: fmt.Errorf("%w, over %s a pixel", err, options.pixelTimeout)}
+		}
+		if options.errorColor == nil {
+			return rowError(root, err, y, xs, fs)
+		}
+		fillErrors(root, y, xs, options, fs)
+	}
+
+	// The pixels are written straight into the images' Pix rather than with
+	// Set, which converts colour models and checks bounds for every pixel.
+	for o, img := range fs.imgs {
+		row := img.PixOffset(0, y)
+		for i, x := range xs {
+			var acc [4]float64
+			for sample := range samples {
+				c := fs.out[(i*samples+sample)*outputs+o]
+				acc[0] += c[0]
+				acc[1] += c[1]
+				acc[2] += c[2]
+				acc[3] += c[3]
+			}
+			n := float64(samples)
+			c := [4]float64{acc[0] / n, acc[1] / n, acc[2] / n, acc[3] / n}
+			if options.mode.gray() {
+				l := luminance(c)
+				c[0], c[1], c[2] = l, l, l
+			}
+			if fs.gray16 != nil {
+				g, v := fs.gray16[o], gray16(c[0]).Y
+				p := g.Pix[g.PixOffset(x, y):]
+				p[0], p[1] = uint8(v>>8), uint8(v)
+			}
+			if fs.heights != nil {
+				fs.heights[o][y*options.width+x] = c[0]
+			}
+			if fs.colours != nil {
+				fs.colours[o][y*options.width+x] = c
+			}
+			p := img.Pix[row+x*4 : row+x*4+4 : row+x*4+4]
+			p[0] = uint8((c[0] + 1) / 2 * 255)
+			p[1] = uint8((c[1] + 1) / 2 * 255)
+			p[2] = uint8((c[2] + 1) / 2 * 255)
+			p[3] = uint8((c[3] + 1) / 2 * 255)
+		}
+	}
+	return nil
+}
+
+// progressiveStrides are the strides between the pixels evaluated in each pass
+// of a progressive render. Each pass only evaluates the pixels that were not
+// evaluated by the previous passes, so the final pass leaves an image that is
+// identical to a non-progressive render.
+var progressiveStrides = []int{8, 4, 2, 1}
+
+// progressiveRows yields the xs of the pixels to evaluate in each row of the
+// given pass.
+func progressiveRows(width, height, pass int) iter.Seq2[int, []int] {
+	stride := progressiveStrides[pass]
+	return func(yield func(int, []int) bool) {
+		xs := make([]int, 0, width/stride+1)
+		for y := 0; y < height; y += stride {
+			xs = xs[:0]
+			for x := 0; x < width; x += stride {
+				if pass > 0 && x%(stride*2) == 0 && y%(stride*2) == 0 {
+					continue
 				}
+				xs = append(xs, x)
+			}
+			if len(xs) > 0 && !yield(y, xs) {
+				return
 			}
 		}
 	}
 }
 
+// fillBlock fills the size by size block whose top left corner is at x and y
+// with the colour of that corner.
+func fillBlock(img *image.NRGBA, x, y, size int) {
+	c := img.NRGBAAt(x, y)
+	b := img.Bounds()
+	for by := y; by < min(y+size, b.Max.Y); by++ {
+		for bx := x; bx < min(x+size, b.Max.X); bx++ {
+			img.SetNRGBA(bx, by, c)
+		}
+	}
+}
+
+// Partial is an intermediate image of a frame emitted by a progressive render.
+// It has the resolution of the final image but with blocks of pixels that have
+// not been evaluated yet filled in by their neighbours.
+type Partial struct {
+	image.Image
+	Pass   int
+	Passes int
+}
+
+// renderFrame renders every pixel of the frame, calling partial after each
+// pass but the last if the render is progressive. Frames are rendered
+// concurrently, so the cores that aren't rendering a frame of their own share
+// the rows of the frames being rendered.
+func renderFrame(ctx context.Context, root nodes.Node, options *renderOptions, fs *frameState, partial func(pass int)) error {
+	if !options.progressive {
+		workers := max(runtime.NumCPU()/options.renderedFrames(), 1)
+		return renderBand(ctx, root, options, fs, image.Rect(0, 0, options.width, options.height), workers)
+	}
+
+	for pass, stride := range progressiveStrides {
+		for y, xs := range progressiveRows(options.width, options.height, pass) {
+			if err := options.controller.wait(ctx); err != nil {
+				return err
+			}
+			if err := renderRow(root, y, xs, options, fs); err != nil {
+				return err
+			}
+			for _, img := range fs.imgs {
+				for _, x := range xs {
+					fillBlock(img, x, y, stride)
+				}
+			}
+		}
+		if pass < len(progressiveStrides)-1 {
+			partial(pass)
+		}
+	}
+	return nil
+}
+
+// renderBand renders the rows of the frame's images within bounds on the
+// given number of goroutines, each with its own state. Rows are taken from a
+// queue as each goroutine finishes its last, so that rows that are expensive
+// to evaluate don't hold up the others.
+func renderBand(ctx context.Context, root nodes.Node, options *renderOptions, frame *frameState, bounds image.Rectangle, workers int) error {
+	var (
+		wg      sync.WaitGroup
+		errOnce sync.Once
+		err     error
+		rows    = make(chan int, bounds.Dy())
+		xs      = make([]int, bounds.Dx())
+	)
+	for i := range xs {
+		xs[i] = bounds.Min.X + i
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		rows <- y
+	}
+	close(rows)
+	if workers == 1 {
+		// The frame's own state is used when rendering on a single goroutine
+		// so that its arena is reused.
+		for y := range rows {
+			if err := options.controller.wait(ctx); err != nil {
+				return err
+			}
+			if err := renderRow(root, y, xs, options, frame); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fs := &frameState{
+				frame:   frame.frame,
+				data:    frame.data,
+				sampler: frame.sampler,
+				imgs:    frame.imgs,
+				gray16:  frame.gray16,
+				heights: frame.heights,
+				colours: frame.colours,
+			}
+			fs.arena.FastMath = options.fastMath
+			for y := range rows {
+				rowErr := options.controller.wait(ctx)
+				if rowErr == nil {
+					rowErr = renderRow(root, y, xs, options, fs)
+				}
+				if rowErr != nil {
+					errOnce.Do(func() { err = rowErr })
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return err
+}
+
 type frameResult struct {
 	frame     int
-	img       image.Image
+	imgs      []image.Image
 	timeTaken time.Duration
 	err       error
+	// cancelled is whether the frame was cancelled by the controller, so is
+	// skipped.
+	cancelled bool
 }
 
-func frames(ctx context.Context, root nodes.Node, options *renderOptions) iter.Seq2[image.Image, error] {
-	return func(yield func(image.Image, error) bool) {
-		framePool := newPool(ctx, max(options.frames, 10), func(frame int) frameResult {
+// frames renders the frames of the root, yielding the images of each with its
+// number, in order unless WithUnordered is given.
+func frames(ctx context.Context, root nodes.Node, options *renderOptions) iter.Seq2[frameResult, error] {
+	if options.interpolation > 1 {
+		return interpolatedFrames(ctx, root, options)
+	}
+	unbound := root
+	root = bindParams(root, options.params)
+	outputs := max(len(nodes.OutputNames(root)), 1)
+	return func(yield func(frameResult, error) bool) {
+		ctx, span := options.tracer.Start(ctx, "randomart.render", trace.WithAttributes(
+			attribute.Int("width", options.width),
+			attribute.Int("height", options.height),
+			attribute.Int("frames", options.frames),
+			attribute.Int("start_frame", options.startFrame),
+			attribute.Int("end_frame", options.endFrame),
+			attribute.Int("samples", options.samples),
+		))
+		var err error
+		defer func() { endSpan(span, err) }()
+		fail := func(e error) {
+			err = e
+			yield(frameResult{}, e)
+		}
+
+		if options.targetDuration > 0 {
+			fitResolution(root, options)
+		}
+
+		var remote *remoteWorkers
+		if len(options.remoteWorkers) > 0 {
+			if remote, err = dialRemoteWorkers(ctx, root, options); err != nil {
+				fail(err)
+				return
+			}
+			defer remote.close()
+		}
+
+		start := time.Now()
+		options.event(ctx, slog.LevelInfo, "render started",
+			"width", options.width, "height", options.height,
+			"frames", options.frames, "samples", options.samples,
+		)
+		partials := make(chan frameResult, runtime.NumCPU())
+		process := func(ctx context.Context, frame int) frameResult {
+			ctx, done := options.controller.frameContext(ctx, frame)
+			defer done()
 			start := time.Now()
-			img := image.NewRGBA(image.Rect(0, 0, options.width, options.height))
-			for x, y := range points(options.width, options.height) {
-				src := options.src.At(x, y)
-				c, err := renderPoint(root, nodes.S(
-					x, y,
-					options.width, options.height,
-					frame, options.frames,
-					src,
-				))
-				if err != nil {
-					return frameResult{frame: frame, timeTaken: time.Now().Sub(start), err: err}
+			root := root
+			if options.liveParams != nil {
+				root = bindParams(bindParams(unbound, options.liveParams.Values()), options.params)
+			}
+			fs, err := newFrameState(frame, outputs, options, image.Rect(0, 0, options.width, options.height))
+			if err != nil {
+				return frameResult{frame: frame, timeTaken: time.Now().Sub(start), err: err}
+			}
+			hoisted := hoist(root, options, frame)
+			if remote != nil {
+				err = remote.renderFrame(ctx, fs)
+			} else {
+				err = renderFrame(ctx, hoisted, options, fs, func(pass int) {
+					partial := frameResult{frame: frame, imgs: make([]image.Image, outputs)}
+					for i, img := range fs.imgs {
+						partial.imgs[i] = &Partial{
+							Image:  &image.NRGBA{Pix: slices.Clone(img.Pix), Stride: img.Stride, Rect: img.Rect},
+							Pass:   pass,
+							Passes: len(progressiveStrides),
+						}
+					}
+					// Partials are only previews so they are dropped rather than
+					// holding up the render when they aren't being consumed.
+					select {
+					case partials <- partial:
+					default:
+					}
+				})
+			}
+			if err == nil && fs.colours != nil {
+				applyDithering(options, fs)
+			}
+			if err == nil && fs.heights != nil {
+				if options.heightmaps != nil {
+					err = options.heightmaps(frame, heightmaps(options, fs))
 				}
-				img.Set(x, y, c)
+				applyNormalMap(options, fs)
+			}
+			if err == nil && options.costHeatmap != nil {
+				err = options.costHeatmap.add(hoisted, options, fs)
+			}
+			if err == nil && options.branchOverlay {
+				err = branchOverlay(root, options, fs)
+			}
+			if err == nil && options.lut != nil {
+				applyLUT(options, fs)
 			}
-			return frameResult{frame: frame, timeTaken: time.Now().Sub(start), img: img}
+			if err == nil && options.palette != nil {
+				applyPalette(options, fs)
+			}
+			if err == nil && options.mask != nil {
+				applyMask(options, fs)
+			}
+			if err != nil {
+				result := frameResult{frame: frame, timeTaken: time.Now().Sub(start), err: err}
+				if ctx.Err() != nil && options.flushPartialFrame {
+					result.imgs = fs.images()
+				}
+				return result
+			}
+			return frameResult{frame: frame, timeTaken: time.Now().Sub(start), imgs: fs.images()}
+		}
+		framePool := newPool(ctx, max(options.frames, 10), func(frame int) frameResult {
+			ctx, span := options.tracer.Start(ctx, "randomart.frame", trace.WithAttributes(attribute.Int("frame", frame)))
+			options.event(ctx, slog.LevelDebug, "frame started", "frame", frame)
+			result := process(ctx, frame)
+			if result.err != nil && options.controller.frameCancelled(frame) {
+				result.imgs, result.err, result.cancelled = nil, nil, true
+			}
+			endSpan(span, result.err)
+			if result.cancelled {
+				options.event(ctx, slog.LevelDebug, "frame cancelled", "frame", frame, "duration", result.timeTaken)
+			} else if result.err != nil {
+				options.event(ctx, slog.LevelError, "frame failed", "frame", frame, "duration", result.timeTaken, "error", result.err)
+			} else {
+				options.event(ctx, slog.LevelDebug, "frame finished", "frame", frame, "duration", result.timeTaken)
+			}
+			return result
 		})
 		defer framePool.stopAndWait()
 
+		keyframes := options.keyframes
+		if keyframes == nil {
+			for frame := options.startFrame; frame < options.endFrame; frame++ {
+				keyframes = append(keyframes, frame)
+			}
+		}
 		go func() {
-			for frame := range options.frames {
+			for _, frame := range keyframes {
 				if err := framePool.run(ctx, frame); err != nil {
 					return
 				}
@@ -151,43 +689,140 @@ func frames(ctx context.Context, root nodes.Node, options *renderOptions) iter.S
 		}()
 
 		var (
-			expectedFrame   int
-			buf             = make([]frameResult, 0, options.frames)
-			timeTakenFrames = make([]time.Duration, 0, options.frames)
+			expectedFrame  = keyframes[0]
+			delivered      int
+			buf            = make([]frameResult, 0, len(keyframes))
+			frameDurations = make([]time.Duration, len(keyframes))
+			received       = make([]bool, len(keyframes))
+			finished       bool
 		)
+		// finish writes the cost heatmap and reports the stats of the frames
+		// that were rendered.
+		finish := func() error {
+			finished = true
+			framePool.stopAndWait()
+			if options.costHeatmap != nil {
+				if err := options.costHeatmap.write(options); err != nil {
+					return fmt.Errorf("could not write cost heatmap: %w", err)
+				}
+			}
+
+			var durations []time.Duration
+			for i, d := range frameDurations {
+				if received[i] {
+					durations = append(durations, d)
+				}
+			}
+			stats := newStats(options, durations, time.Since(start))
+			options.logf("Average time taken per frame: %s\n", stats.AverageFrame)
+			options.logf("Max time taken for a frame: %s\n", stats.MaxFrame)
+			options.logf("Min time taken for a frame: %s\n", stats.MinFrame)
+			options.logf("Pixels rendered per second: %.0f\n", stats.PixelsPerSecond)
+			if stats.FailedPixels > 0 {
+				options.logf("Pixels that could not be evaluated: %d, the first at %s\n", stats.FailedPixels, stats.PixelErrors[0])
+			}
+			options.event(ctx, slog.LevelInfo, "render finished",
+				"frames", stats.Frames, "duration", stats.Duration,
+				"average_frame", stats.AverageFrame, "max_frame", stats.MaxFrame, "min_frame", stats.MinFrame,
+				"pixels_per_second", stats.PixelsPerSecond, "failed_pixels", stats.FailedPixels,
+			)
+			if options.statsCollector != nil {
+				options.statsCollector(stats)
+			}
+			return nil
+		}
+		// The frames that were rendered are still reported if the render stops
+		// early, such as when Render stops after the first frame, but then a
+		// failure to write the heatmap can only be recorded on the span.
+		defer func() {
+			if !finished && delivered > 0 {
+				if e := finish(); e != nil && err == nil {
+					err = e
+				}
+			}
+		}()
 		sortBuf := func() {
 			slices.SortFunc(buf, func(a, b frameResult) int {
 				return a.frame - b.frame
 			})
 		}
-		for expectedFrame < options.frames {
+		// recycle reuses the images of a frame once it has been yielded,
+		// unless they are being retained.
+		recycle := func(imgs []image.Image) {
+			if !options.retainFrames {
+				options.buffers.put(imgs)
+			}
+		}
+		// y yields a rendered frame, recycling its images afterwards, or skips
+		// it if it was cancelled.
+		y := func(result frameResult) bool {
+			ok := true
+			if !result.cancelled {
+				ok = yield(result, nil)
+				recycle(result.imgs)
+			}
+			if delivered++; delivered < len(keyframes) {
+				expectedFrame = keyframes[delivered]
+			}
+			return ok
+		}
+		// flush yields the frames that were rendered before the render was
+		// cancelled, in order, up to the first that wasn't and then the
+		// partially rendered frame if it was kept. Unordered renders yield
+		// every frame that was rendered.
+		flush := func() {
+			framePool.stopAndWait()
+			for result := range framePool.results {
+				buf = append(buf, result)
+			}
+			sortBuf()
+			for _, result := range buf {
+				rendered := result.imgs != nil || result.cancelled
+				if !rendered && options.unordered {
+					continue
+				}
+				if !rendered || result.frame != expectedFrame && !options.unordered {
+					break
+				}
+				if !y(result) || result.err != nil {
+					return
+				}
+			}
+		}
+		for delivered < len(keyframes) {
 			select {
 			case <-ctx.Done():
-				yield(nil, ctx.Err())
+				if options.flushOnCancel {
+					flush()
+				}
+				fail(ctx.Err())
 				return
+			case partial := <-partials:
+				if (partial.frame == expectedFrame || options.unordered) && !yield(partial, nil) {
+					return
+				}
 			case result, ok := <-framePool.results:
-				timeTakenFrames = append(timeTakenFrames, result.timeTaken)
 				if !ok {
-					yield(nil, fmt.Errorf("frame result channel closed"))
+					fail(fmt.Errorf("frame result channel closed"))
 					return
 				}
+				i, _ := slices.BinarySearch(keyframes, result.frame)
+				frameDurations[i], received[i] = result.timeTaken, true
 
 				if result.err != nil {
-					yield(nil, result.err)
+					if options.flushOnCancel && ctx.Err() != nil {
+						buf = append(buf, result)
+						flush()
+					}
+					fail(result.err)
 					return
 				}
 
-				if result.frame != expectedFrame {
+				if result.frame != expectedFrame && !options.unordered {
 					buf = append(buf, result)
 					sortBuf()
 				} else {
-					y := func(img image.Image) bool {
-						ok := yield(img, nil)
-						expectedFrame++
-						return ok
-					}
-
-					if !y(result.img) {
+					if !y(result) {
 						return
 					}
 					for len(buf) > 0 {
@@ -196,7 +831,7 @@ func frames(ctx context.Context, root nodes.Node, options *renderOptions) iter.S
 							break
 						}
 						buf = buf[1:]
-						if !y(f.img) {
+						if !y(f) {
 							return
 						}
 					}
@@ -204,29 +839,61 @@ func frames(ctx context.Context, root nodes.Node, options *renderOptions) iter.S
 			}
 		}
 
-		var avg, max, min time.Duration
-		for _, timeTakenFrame := range timeTakenFrames {
-			avg += timeTakenFrame
-			if timeTakenFrame > max {
-				max = timeTakenFrame
-			}
-			if timeTakenFrame < min || min == 0 {
-				min = timeTakenFrame
-			}
+		if err := finish(); err != nil {
+			fail(err)
 		}
-		avg /= time.Duration(len(timeTakenFrames))
-		options.logf("Average time taken per frame: %s\n", avg)
-		options.logf("Max time taken for a frame: %s\n", max)
-		options.logf("Min time taken for a frame: %s\n", min)
 	}
 }
 
 type renderOptions struct {
-	width  int
-	height int
-	frames int
-	src    image.Image
-	logger func(f string, args ...any)
+	width             int
+	height            int
+	resolutionSet     bool
+	frames            int
+	startFrame        int
+	endFrame          int
+	samples           int
+	jitter            float64
+	progressive       bool
+	fastMath          bool
+	branchOverlay     bool
+	costHeatmap       *costHeatmap
+	remoteWorkers     []string
+	viewport          viewport
+	src               image.Image
+	sequence          func(frame int) (image.Image, error)
+	stateData         func(frame int) any
+	params            map[string]float64
+	liveParams        *LiveParams
+	sampler           image.Image
+	tileable          bool
+	dithering         Dithering
+	mode              Mode
+	heightmaps        func(frame int, heightmaps []image.Image) error
+	mask              image.Image
+	lut               *lut
+	palette           []color.NRGBA
+	paletteDither     bool
+	logger            func(f string, args ...any)
+	slog              *slog.Logger
+	tracer            trace.Tracer
+	flushOnCancel     bool
+	retainFrames      bool
+	buffers           *bufferPool
+	flushPartialFrame bool
+	statsCollector    func(stats Stats)
+	pixelTimeout      time.Duration
+	targetDuration    time.Duration
+	unordered         bool
+	controller        *Controller
+	interpolation     int
+	motionBlur        int
+	shutter           float64
+	errorColor        *[4]float64
+	pixelErrors       *pixelErrors
+	// keyframes are the frames that are rendered, in order, or nil for every
+	// frame from startFrame to endFrame.
+	keyframes []int
 }
 
 func (r *renderOptions) apply(opts []RenderOption) (*renderOptions, error) {
@@ -235,22 +902,135 @@ func (r *renderOptions) apply(opts []RenderOption) (*renderOptions, error) {
 			return r, err
 		}
 	}
-	if _, ok := r.src.(*image.Uniform); !ok {
+	if _, ok := r.src.(*image.Uniform); !ok && !r.resolutionSet {
 		r.width = r.src.Bounds().Dx()
 		r.height = r.src.Bounds().Dy()
 	}
 	if r.frames <= 0 {
 		return r, fmt.Errorf("number of frames cannot be negative")
 	}
+	if r.endFrame == 0 {
+		r.endFrame = r.frames
+	}
+	if r.endFrame < 0 || r.endFrame > r.frames {
+		return r, fmt.Errorf("end frame must be between 1 and %d", r.frames)
+	}
+	if r.startFrame < 0 || r.startFrame >= r.endFrame {
+		return r, fmt.Errorf("start frame must be between 0 and %d", r.endFrame-1)
+	}
 	if r.width <= 0 {
 		return r, fmt.Errorf("width cannot be negative")
 	}
 	if r.height <= 0 {
 		return r, fmt.Errorf("height cannot be negative")
 	}
+	if r.samples <= 0 {
+		return r, fmt.Errorf("number of samples cannot be negative")
+	}
+	if r.jitter < 0 || r.jitter > 1 {
+		return r, fmt.Errorf("jitter must be between 0 and 1")
+	}
+	if r.viewport.minX >= r.viewport.maxX || r.viewport.minY >= r.viewport.maxY {
+		return r, fmt.Errorf("viewport cannot be empty")
+	}
+	if r.mode == Gray16 && (len(r.remoteWorkers) > 0 || r.branchOverlay || r.mask != nil || r.lut != nil || r.palette != nil) {
+		return r, fmt.Errorf("16-bit greyscale cannot be rendered by remote workers or with a branch overlay, mask, LUT or palette")
+	}
+	if r.dithering != NoDithering && len(r.remoteWorkers) > 0 {
+		return r, fmt.Errorf("dithered images cannot be rendered by remote workers")
+	}
+	if r.mode == NormalMap && len(r.remoteWorkers) > 0 {
+		return r, fmt.Errorf("normal maps cannot be rendered by remote workers")
+	}
+	if r.errorColor != nil && len(r.remoteWorkers) > 0 {
+		return r, fmt.Errorf("pixels cannot be given the error colour by remote workers")
+	}
+	if r.motionBlur > 1 && len(r.remoteWorkers) > 0 {
+		return r, fmt.Errorf("motion blur cannot be rendered by remote workers")
+	}
+	if r.liveParams != nil && len(r.remoteWorkers) > 0 {
+		return r, fmt.Errorf("live parameters cannot be rendered by remote workers")
+	}
+	if r.heightmaps != nil && r.mode != NormalMap {
+		return r, fmt.Errorf("heightmaps can only be rendered with normal maps")
+	}
+	r.resize(r.width, r.height)
 	return r, nil
 }
 
+// resize renders at the resolution, scaling the source and mask to it.
+func (r *renderOptions) resize(width, height int) {
+	r.width, r.height = width, height
+	r.sampler = newSampler(r.src, width, height)
+	if r.mask != nil {
+		r.mask = newSampler(r.mask, width, height)
+	}
+}
+
+type viewport struct {
+	minX, minY float64
+	maxX, maxY float64
+}
+
+// transform maps x and y from [-1, 1] into the viewport.
+func (v viewport) transform(x, y float64) (float64, float64) {
+	return v.minX + (x+1)/2*(v.maxX-v.minX), v.minY + (y+1)/2*(v.maxY-v.minY)
+}
+
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// samplesPerPixel returns how many times each pixel is evaluated, for each
+// sample at each sub-frame of the motion blur.
+func (r *renderOptions) samplesPerPixel() int {
+	return r.samples * max(r.motionBlur, 1)
+}
+
+// subframeF returns f at the sub-frame of the motion blur of the frame, which
+// are spread evenly over the shutter centred on the frame.
+func (r *renderOptions) subframeF(frame, subframe int) float64 {
+	if r.frames <= 1 {
+		return 0
+	}
+	t := float64(frame) + r.shutter*((float64(subframe)+0.5)/float64(r.motionBlur)-0.5)
+	return t/float64(r.frames-1)*2 - 1
+}
+
+// jitterOffset returns the offset of a sample from the pixel's position. The
+// offset is a hash of the pixel, frame and sample so that renders are
+// reproducible regardless of how work is scheduled.
+func (r *renderOptions) jitterOffset(x, y, frame, sample int) (float64, float64) {
+	if r.jitter == 0 {
+		return 0, 0
+	}
+	h := splitmix64(uint64(x)<<32 | uint64(uint32(y)))
+	h = splitmix64(h ^ uint64(frame)<<32 ^ uint64(sample))
+	dx := float64(h>>32)/(1<<32) - 0.5
+	dy := float64(uint32(h))/(1<<32) - 0.5
+	return dx * r.jitter, dy * r.jitter
+}
+
+// endSpan ends the span, recording the error if there is one.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// event logs a structured event with the logger given to WithSlog.
+func (r *renderOptions) event(ctx context.Context, level slog.Level, msg string, args ...any) {
+	if r.slog == nil {
+		return
+	}
+	r.slog.Log(ctx, level, msg, args...)
+}
+
 func (r *renderOptions) logf(f string, args ...any) {
 	if r.logger == nil {
 		return
@@ -258,12 +1038,27 @@ func (r *renderOptions) logf(f string, args ...any) {
 	r.logger(f, args...)
 }
 
+// renderedFrames returns how many frames are rendered rather than
+// interpolated.
+func (r *renderOptions) renderedFrames() int {
+	if r.keyframes != nil {
+		return len(r.keyframes)
+	}
+	return r.endFrame - r.startFrame
+}
+
 func defaultRenderOptions() *renderOptions {
 	return &renderOptions{
-		width:  400,
-		height: 400,
-		frames: 1,
-		src:    image.NewUniform(color.White),
+		width:     400,
+		height:    400,
+		frames:    1,
+		samples:   1,
+		viewport:  viewport{-1, -1, 1, 1},
+		mode:      RGBA,
+		tracer:    noop.NewTracerProvider().Tracer(""),
+		dithering: NoDithering,
+		src:       image.NewUniform(color.White),
+		buffers:   &bufferPool{},
 	}
 }
 
@@ -273,6 +1068,7 @@ func WithResolution(width, height int) RenderOption {
 	return func(options *renderOptions) error {
 		options.width = width
 		options.height = height
+		options.resolutionSet = true
 		return nil
 	}
 }
@@ -284,11 +1080,242 @@ func WithFrames(frames int) RenderOption {
 	}
 }
 
+// WithFrameRange only renders the frames from start up to but not including
+// end, so that the frames of an animation can be split between machines that
+// each render a range of them, or a render that was interrupted can be
+// resumed. The frames that are rendered are the same as they would be
+// otherwise and keep their frame numbers. An end of 0 is the last frame.
+func WithFrameRange(start, end int) RenderOption {
+	return func(options *renderOptions) error {
+		options.startFrame = start
+		options.endFrame = end
+		return nil
+	}
+}
+
+func WithSamples(samples int) RenderOption {
+	return func(options *renderOptions) error {
+		options.samples = samples
+		return nil
+	}
+}
+
+func WithJitter(amount float64) RenderOption {
+	return func(options *renderOptions) error {
+		options.jitter = amount
+		return nil
+	}
+}
+
+// WithProgressive renders each frame in passes, starting with every 8th pixel
+// and refining until every pixel has been rendered. The intermediate images
+// are passed to callbacks as a *Partial before the final image of the frame.
+func WithProgressive() RenderOption {
+	return func(options *renderOptions) error {
+		options.progressive = true
+		return nil
+	}
+}
+
+// WithFastMath evaluates expensive functions with faster approximations,
+// trading exactness for speed.
+func WithFastMath() RenderOption {
+	return func(options *renderOptions) error {
+		options.fastMath = true
+		return nil
+	}
+}
+
+// WithBranchOverlay tints each pixel by the branches of the if/then/else nodes
+// of the root taken to evaluate it, which shows which parts of the image come
+// from which branches. Pixels are evaluated again for the overlay, at their
+// centres and much more slowly than the render itself.
+func WithBranchOverlay() RenderOption {
+	return func(options *renderOptions) error {
+		options.branchOverlay = true
+		return nil
+	}
+}
+
+// WithCostHeatmap writes a greyscale PNG to w once the render finishes, or is
+// stopped early as Render does after the first frame, where the brightness of each pixel is the number of nodes that were
+// evaluated for it summed over every frame, scaled so that the cheapest pixel
+// is black and the most expensive white. The brightest parts of the heatmap
+// show where the most expensive subtrees of the root are taken.
+func WithCostHeatmap(w io.Writer) RenderOption {
+	return func(options *renderOptions) error {
+		options.costHeatmap = &costHeatmap{w: w}
+		return nil
+	}
+}
+
+// WithRemoteWorkers renders frames on the workers started with Serve listening
+// on the given addresses instead of locally. Each frame is split into a band of
+// rows for each worker. Progressive renders are not supported by workers so
+// only the final images are produced.
+func WithRemoteWorkers(addrs ...string) RenderOption {
+	return func(options *renderOptions) error {
+		options.remoteWorkers = addrs
+		return nil
+	}
+}
+
+// WithViewport sets the region of the x and y components that is rendered,
+// which defaults to [-1, 1] on both axes.
+func WithViewport(minX, minY, maxX, maxY float64) RenderOption {
+	return func(options *renderOptions) error {
+		options.viewport = viewport{minX: minX, minY: minY, maxX: maxX, maxY: maxY}
+		return nil
+	}
+}
+
 func WithSourceImage(r io.Reader) RenderOption {
 	return func(options *renderOptions) error {
-		var err error
-		options.src, _, err = image.Decode(r)
-		return err
+		src, _, err := image.Decode(r)
+		if err != nil {
+			return err
+		}
+		return WithSource(src)(options)
+	}
+}
+
+func WithSource(img image.Image) RenderOption {
+	return func(options *renderOptions) error {
+		if img == nil {
+			return fmt.Errorf("source image cannot be nil")
+		}
+		options.src = img
+		return nil
+	}
+}
+
+// WithSourceSequence samples a different source image for each frame. The
+// images are resampled to the render resolution and the given function may be
+// called concurrently.
+func WithSourceSequence(sequence func(frame int) (image.Image, error)) RenderOption {
+	return func(options *renderOptions) error {
+		options.sequence = sequence
+		return nil
+	}
+}
+
+// WithTileable maps x and y through a cosine so that they go across the
+// viewport and back again over the width and height of the image, which makes
+// the rendered images tile seamlessly by mirroring them.
+func WithTileable() RenderOption {
+	return func(options *renderOptions) error {
+		options.tileable = true
+		return nil
+	}
+}
+
+// WithDithering dithers the colours of the root when they are rounded to the
+// 8 bits of each channel of the rendered images, which hides the banding of
+// smooth gradients. Normal maps and 16-bit images aren't dithered.
+func WithDithering(dithering Dithering) RenderOption {
+	return func(options *renderOptions) error {
+		if !slices.Contains(Ditherings(), dithering) {
+			return fmt.Errorf("%q is not a supported dithering", dithering)
+		}
+		options.dithering = dithering
+		return nil
+	}
+}
+
+// WithMode sets how the colours of the root are written to the rendered
+// images. Roots that are numbers rather than triples are rendered as greyscale
+// in any mode.
+func WithMode(mode Mode) RenderOption {
+	return func(options *renderOptions) error {
+		if !slices.Contains(Modes(), mode) {
+			return fmt.Errorf("%q is not a supported mode", mode)
+		}
+		options.mode = mode
+		return nil
+	}
+}
+
+// WithHeightmaps calls f with the heights of each output of every frame that
+// normal maps are rendered from, as 16-bit greyscale images, before the normal
+// maps are passed to the callbacks of the render. It may be called
+// concurrently.
+func WithHeightmaps(f func(frame int, heightmaps []image.Image) error) RenderOption {
+	return func(options *renderOptions) error {
+		options.heightmaps = f
+		return nil
+	}
+}
+
+// WithMask only renders the pixels where the mask, which is resampled to the
+// render resolution, is opaque. The rest are copied from the source image if
+// there is one and are otherwise left transparent.
+func WithMask(img image.Image) RenderOption {
+	return func(options *renderOptions) error {
+		if img == nil {
+			return fmt.Errorf("mask cannot be nil")
+		}
+		options.mask = img
+		return nil
+	}
+}
+
+// WithLUT grades the colours of every frame with the 3D lookup table read from
+// a .cube file, before mapping them onto the palette given with WithPalette.
+func WithLUT(r io.Reader) RenderOption {
+	return func(options *renderOptions) error {
+		l, err := readLUT(r)
+		if err != nil {
+			return fmt.Errorf("could not read LUT: %w", err)
+		}
+		options.lut = l
+		return nil
+	}
+}
+
+// WithPalette maps the colour of every pixel onto the nearest colour of the
+// palette, keeping its alpha.
+func WithPalette(colors []color.Color) RenderOption {
+	return func(options *renderOptions) error {
+		if len(colors) == 0 {
+			return fmt.Errorf("palette cannot be empty")
+		}
+		options.palette = make([]color.NRGBA, len(colors))
+		for i, c := range colors {
+			options.palette[i] = color.NRGBAModel.Convert(c).(color.NRGBA)
+		}
+		return nil
+	}
+}
+
+// WithPaletteDither dithers the colours of the palette given with WithPalette
+// in an ordered pattern, so that gradients are mixed from its colours rather
+// than banded.
+func WithPaletteDither() RenderOption {
+	return func(options *renderOptions) error {
+		options.paletteDither = true
+		return nil
+	}
+}
+
+// WithParam binds the parameter with the given name, written $name in
+// grammars, to the value. Parameters that aren't bound are 0.
+func WithParam(name string, value float64) RenderOption {
+	return func(options *renderOptions) error {
+		if options.params == nil {
+			options.params = make(map[string]float64)
+		}
+		options.params[strings.TrimPrefix(name, "$")] = value
+		return nil
+	}
+}
+
+// WithStateData sets the Data of the states of each frame to what data returns
+// for the frame, for components added with nodes.RegisterComponent to read.
+// Data is not sent to remote workers.
+func WithStateData(data func(frame int) any) RenderOption {
+	return func(options *renderOptions) error {
+		options.stateData = data
+		return nil
 	}
 }
 
@@ -299,36 +1326,211 @@ func WithLogger(f func(f string, args ...any)) RenderOption {
 	}
 }
 
+// WithSlog logs structured events to the logger: when the render starts and
+// finishes, at info level, when each frame starts and finishes and when each
+// band rendered by a remote worker finishes, at debug level, and errors with
+// the frame that they happened in.
+func WithSlog(logger *slog.Logger) RenderOption {
+	return func(options *renderOptions) error {
+		options.slog = logger
+		return nil
+	}
+}
+
+// WithTracer starts a span around the render, each frame and each band
+// rendered by a remote worker, as children of the span of the render's
+// context.
+func WithTracer(tracer trace.Tracer) RenderOption {
+	return func(options *renderOptions) error {
+		if tracer == nil {
+			return fmt.Errorf("tracer cannot be nil")
+		}
+		options.tracer = tracer
+		return nil
+	}
+}
+
+// WithRetainFrames keeps the images of the frames passed to the callbacks of
+// the render valid after the callbacks return. Otherwise they are reused for
+// later frames, so must be copied by callbacks that keep them.
+func WithRetainFrames() RenderOption {
+	return func(options *renderOptions) error {
+		options.retainFrames = true
+		return nil
+	}
+}
+
+// WithFlushOnCancel passes the frames that were rendered before the render's
+// context was cancelled to the callbacks of the render, rather than only those
+// that were passed before, and then returns the context's error. If
+// partialFrame is true the first frame that wasn't finished is also passed,
+// with only the rows that were rendered.
+func WithFlushOnCancel(partialFrame bool) RenderOption {
+	return func(options *renderOptions) error {
+		options.flushOnCancel = true
+		options.flushPartialFrame = partialFrame
+		return nil
+	}
+}
+
+// WithStatsCollector calls f with the Stats of the frames that were rendered
+// once the render finishes, or is stopped early as Render does after the first
+// frame. It isn't called if the render fails before any frame is delivered.
+func WithStatsCollector(f func(stats Stats)) RenderOption {
+	return func(options *renderOptions) error {
+		options.statsCollector = f
+		return nil
+	}
+}
+
+// WithPixelTimeout fails the render with a FrameError wrapping
+// nodes.ErrDeadlineExceeded if evaluating a row takes longer than the timeout
+// for each of its pixels, so that expressions too large to render in any
+// reasonable time, such as those written by hand or mutated many times, can't
+// hold up a render indefinitely.
+func WithPixelTimeout(timeout time.Duration) RenderOption {
+	return func(options *renderOptions) error {
+		if timeout < 0 {
+			return fmt.Errorf("pixel timeout cannot be negative")
+		}
+		options.pixelTimeout = timeout
+		return nil
+	}
+}
+
+// WithInterpolatedFrames renders every factor'th frame, and the last, with the
+// expression and blends the frames between them from the two either side,
+// which suits long animations that change slowly. Frames are always delivered
+// in order, and partials aren't delivered.
+func WithInterpolatedFrames(factor int) RenderOption {
+	return func(options *renderOptions) error {
+		if factor < 1 {
+			return fmt.Errorf("interpolation factor must be at least 1")
+		}
+		options.interpolation = factor
+		return nil
+	}
+}
+
+// WithMotionBlur averages each pixel over the samples of f spread evenly
+// across the shutter, the fraction of the time between frames that it is open
+// for, centred on the frame. Each sample is also sampled as many times as
+// WithSamples gives.
+func WithMotionBlur(samples int, shutter float64) RenderOption {
+	return func(options *renderOptions) error {
+		if samples < 1 {
+			return fmt.Errorf("motion blur must have at least 1 sample")
+		}
+		if shutter <= 0 || shutter > 1 {
+			return fmt.Errorf("shutter must be greater than 0 and at most 1")
+		}
+		options.motionBlur, options.shutter = samples, shutter
+		return nil
+	}
+}
+
+// WithUnordered delivers frames to the callbacks of RenderCallback and
+// RenderOutputsCallback as soon as each is rendered, rather than holding them
+// back until the frames before them have been delivered. Each frame is still
+// the same as when delivered in order, along with its number, so it suits
+// callbacks that don't depend on the order, such as writing numbered files.
+func WithUnordered() RenderOption {
+	return func(options *renderOptions) error {
+		options.unordered = true
+		return nil
+	}
+}
+
+// WithTargetDuration lowers the resolution, keeping its aspect ratio, to the
+// largest that is estimated to render within d, from how long a grid of pixels
+// of the first frame takes to evaluate before rendering. The resolution given
+// is never exceeded, so the render is only quicker for it, and the image is
+// the size of the resolution picked.
+func WithTargetDuration(d time.Duration) RenderOption {
+	return func(options *renderOptions) error {
+		if d < 0 {
+			return fmt.Errorf("target duration cannot be negative")
+		}
+		options.targetDuration = d
+		return nil
+	}
+}
+
+// WithErrorColor gives the pixels that can't be evaluated, such as those where
+// a condition isn't a boolean, the colour c instead of failing the render. How
+// many there were and the errors of the first are given in the Stats of the
+// render.
+func WithErrorColor(c color.Color) RenderOption {
+	return func(options *renderOptions) error {
+		n := color.NRGBAModel.Convert(c).(color.NRGBA)
+		options.errorColor = &[4]float64{
+			float64(n.R)/255*2 - 1,
+			float64(n.G)/255*2 - 1,
+			float64(n.B)/255*2 - 1,
+			float64(n.A)/255*2 - 1,
+		}
+		options.pixelErrors = &pixelErrors{}
+		return nil
+	}
+}
+
 func Render(ctx context.Context, root nodes.Node, opts ...RenderOption) (image.Image, error) {
 	options, err := defaultRenderOptions().apply(opts)
 	if err != nil {
 		return nil, err
 	}
+	options.retainFrames = true
 
 	next, stop := iter.Pull2(frames(ctx, root, options))
 	defer stop()
-	img, err, _ := next()
-	return img, err
+	for {
+		result, err, _ := next()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := result.imgs[0].(*Partial); !ok {
+			return result.imgs[0], nil
+		}
+	}
 }
 
 func RenderCallback(ctx context.Context, root nodes.Node, callback func(no int, img image.Image) error, opts ...RenderOption) error {
+	return RenderOutputsCallback(ctx, root, func(no int, outputs map[string]image.Image) error {
+		var name string
+		if names := nodes.OutputNames(root); len(names) > 0 {
+			name = names[0]
+		}
+		return callback(no, outputs[name])
+	}, opts...)
+}
+
+// RenderOutputsCallback is RenderCallback but with all of the outputs declared
+// by the root. Roots without named outputs have a single output named "". The
+// images are only valid until the callback returns, unless WithRetainFrames
+// is given.
+func RenderOutputsCallback(ctx context.Context, root nodes.Node, callback func(no int, outputs map[string]image.Image) error, opts ...RenderOption) error {
 	options, err := defaultRenderOptions().apply(opts)
 	if err != nil {
 		return err
 	}
 
-	var (
-		frameNo int
-		frame   image.Image
-	)
-	for frame, err = range frames(ctx, root, options) {
+	names := nodes.OutputNames(root)
+	if len(names) == 0 {
+		names = []string{""}
+	}
+
+	var result frameResult
+	for result, err = range frames(ctx, root, options) {
 		if err != nil {
 			return err
 		}
-		if err = callback(frameNo, frame); err != nil {
+		outputs := make(map[string]image.Image, len(result.imgs))
+		for i, img := range result.imgs {
+			outputs[names[i]] = img
+		}
+		if err = callback(result.frame, outputs); err != nil {
 			return err
 		}
-		frameNo++
 	}
 	return nil
 }
@@ -0,0 +1,154 @@
+// Package rendertest renders expressions and grammars at fixed seeds and
+// resolutions and compares them against golden PNGs, for regression tests of
+// changes to grammars, operators and rendering.
+//
+//	func TestGrammar(t *testing.T) {
+//		img := rendertest.RenderGrammar(t, "grammar.bnf", 1, 64, 64)
+//		rendertest.AssertGolden(t, "testdata/grammar.png", img, 2)
+//	}
+//
+// Golden PNGs are written, rather than compared against, when the tests are
+// run with -rendertest.update.
+package rendertest
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"randomart/nodes"
+	"randomart/render"
+	"testing"
+)
+
+var update = flag.Bool("rendertest.update", false, "Write the golden PNGs of rendertest.AssertGolden instead of comparing against them")
+
+// Render renders the first frame of the root at the resolution, failing the
+// test if it can't be rendered.
+func Render(t testing.TB, root nodes.Node, width, height int, opts ...render.RenderOption) image.Image {
+	t.Helper()
+	opts = append([]render.RenderOption{render.WithResolution(width, height)}, opts...)
+	img, err := render.Render(context.Background(), root, opts...)
+	if err != nil {
+		t.Fatalf("could not render %s: %s", root, err)
+	}
+	return img
+}
+
+// Generate generates an expression from the grammar at the path with the
+// seed, failing the test if it can't be parsed or generated from.
+func Generate(t testing.TB, path string, seed uint64, opts ...nodes.GeneratorOption) nodes.Node {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("could not open grammar: %s", err)
+	}
+	defer f.Close()
+	g, err := nodes.Parse(f, path)
+	if err != nil {
+		t.Fatalf("could not parse grammar: %s", err)
+	}
+	root, _, err := g.Gen(append([]nodes.GeneratorOption{nodes.WithSeeds(seed)}, opts...)...)
+	if err != nil {
+		t.Fatalf("could not generate from %s with seed %d: %s", path, seed, err)
+	}
+	return root
+}
+
+// RenderGrammar renders the expression generated from the grammar at the path
+// with the seed, see Generate and Render.
+func RenderGrammar(t testing.TB, path string, seed uint64, width, height int, opts ...render.RenderOption) image.Image {
+	t.Helper()
+	return Render(t, Generate(t, path, seed), width, height, opts...)
+}
+
+// Compare returns an error describing how the images differ if they aren't the
+// same size or any channel of any pixel differs by more than the tolerance,
+// out of 255. A small tolerance allows for floating point differences between
+// machines.
+func Compare(got, want image.Image, tolerance int) error {
+	gb, wb := got.Bounds(), want.Bounds()
+	if gb.Size() != wb.Size() {
+		return fmt.Errorf("got a %dx%d image, want %dx%d", gb.Dx(), gb.Dy(), wb.Dx(), wb.Dy())
+	}
+	var (
+		differ int
+		first  error
+	)
+	for y := range gb.Dy() {
+		for x := range gb.Dx() {
+			g := color.NRGBAModel.Convert(got.At(gb.Min.X+x, gb.Min.Y+y)).(color.NRGBA)
+			w := color.NRGBAModel.Convert(want.At(wb.Min.X+x, wb.Min.Y+y)).(color.NRGBA)
+			if !within(g, w, tolerance) {
+				differ++
+				if first == nil {
+					first = fmt.Errorf("the first at %d, %d is %v, want %v", x, y, g, w)
+				}
+			}
+		}
+	}
+	if differ > 0 {
+		return fmt.Errorf("%d of %d pixels differ by more than %d, %w", differ, gb.Dx()*gb.Dy(), tolerance, first)
+	}
+	return nil
+}
+
+func within(a, b color.NRGBA, tolerance int) bool {
+	for _, d := range []int{
+		int(a.R) - int(b.R), int(a.G) - int(b.G), int(a.B) - int(b.B), int(a.A) - int(b.A),
+	} {
+		if d > tolerance || -d > tolerance {
+			return false
+		}
+	}
+	return true
+}
+
+// AssertGolden compares the image against the golden PNG at the path, see
+// Compare, failing the test if they differ. With -rendertest.update the image
+// is written to the path instead.
+func AssertGolden(t testing.TB, path string, img image.Image, tolerance int) {
+	t.Helper()
+	if *update {
+		if err := writePNG(path, img); err != nil {
+			t.Fatalf("could not write golden image: %s", err)
+		}
+		t.Logf("wrote golden image %s", path)
+		return
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("golden image %s does not exist, run the test with -rendertest.update to write it", path)
+	}
+	if err != nil {
+		t.Fatalf("could not open golden image: %s", err)
+	}
+	defer f.Close()
+	want, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("could not decode golden image %s: %s", path, err)
+	}
+	if err = Compare(img, want, tolerance); err != nil {
+		t.Errorf("%s: %s", path, err)
+	}
+}
+
+func writePNG(path string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err = png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,30 @@
+package rendertest
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	want := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	got := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	got.SetNRGBA(1, 0, color.NRGBA{R: 2})
+	if err := Compare(got, want, 2); err != nil {
+		t.Errorf("got %v within the tolerance", err)
+	}
+	if err := Compare(got, want, 1); err == nil {
+		t.Error("got no error outside of the tolerance")
+	}
+	if err := Compare(image.NewNRGBA(image.Rect(0, 0, 1, 2)), want, 255); err == nil {
+		t.Error("got no error comparing images of different sizes")
+	}
+}
+
+func TestGrammarGolden(t *testing.T) {
+	for _, seed := range []uint64{1, 2} {
+		img := RenderGrammar(t, "../../grammar.bnf", seed, 32, 32)
+		AssertGolden(t, fmt.Sprintf("testdata/grammar-%d.png", seed), img, 2)
+	}
+}
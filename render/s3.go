@@ -0,0 +1,129 @@
+package render
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// S3Sink uploads images to a bucket of S3, or any object storage compatible
+// with it, with the images' names as their keys.
+type S3Sink struct {
+	Bucket string
+	// Endpoint is the URL of the object storage, which defaults to that of
+	// S3 in Region. Buckets are addressed by path, which most storage
+	// compatible with S3 supports.
+	Endpoint        string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	HTTPSink
+}
+
+// NewS3SinkFromEnv returns an S3Sink for the bucket configured by the same
+// environment variables as the AWS CLI: AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN, AWS_REGION and
+// AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL.
+func NewS3SinkFromEnv(bucket string) (*S3Sink, error) {
+	s := &S3Sink{
+		Bucket:          bucket,
+		Endpoint:        os.Getenv("AWS_ENDPOINT_URL_S3"),
+		Region:          os.Getenv("AWS_REGION"),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if s.Endpoint == "" {
+		s.Endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	if s.Region == "" {
+		s.Region = "us-east-1"
+	}
+	if s.AccessKeyID == "" || s.SecretAccessKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set to upload to S3")
+	}
+	return s, nil
+}
+
+func (s *S3Sink) Create(ctx context.Context, name string) (io.WriteCloser, error) {
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + s.Region + ".amazonaws.com"
+	}
+	u := strings.TrimSuffix(endpoint, "/") + "/" + s.Bucket + "/" + strings.TrimPrefix(name, "/")
+	return &upload{put: func(body []byte) error {
+		return s.put(ctx, u, body, s.sign)
+	}}, nil
+}
+
+// sign signs the request with AWS Signature Version 4.
+func (s *S3Sink) sign(req *http.Request, body []byte) {
+	s.signAt(req, body, time.Now().UTC())
+}
+
+func (s *S3Sink) signAt(req *http.Request, body []byte, now time.Time) {
+	var (
+		payload = sha256.Sum256(body)
+		date    = now.Format("20060102")
+		scope   = date + "/" + s.Region + "/s3/aws4_request"
+	)
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payload[:]))
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	slices.Sort(names)
+	var canonical strings.Builder
+	fmt.Fprintf(&canonical, "%s\n%s\n%s\n", req.Method, s3Escape(req.URL.Path), req.URL.RawQuery)
+	for _, k := range names {
+		fmt.Fprintf(&canonical, "%s:%s\n", k, headers[k])
+	}
+	signed := strings.Join(names, ";")
+	fmt.Fprintf(&canonical, "\n%s\n%x", signed, payload)
+
+	hash := sha256.Sum256([]byte(canonical.String()))
+	toSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+	key := []byte("AWS4" + s.SecretAccessKey)
+	for _, part := range []string{date, s.Region, "s3", "aws4_request", toSign} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%x",
+		s.AccessKeyID, scope, signed, key,
+	))
+}
+
+// s3Escape escapes every byte of the path other than the unreserved
+// characters and slashes, as signatures require.
+func s3Escape(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-._~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
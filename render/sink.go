@@ -0,0 +1,136 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Sink is where encoded images are written to, so that they don't need to be
+// written to local files.
+type Sink interface {
+	// Create returns a writer for the image with the given name. The image
+	// has only been written once the writer has been closed without error.
+	Create(ctx context.Context, name string) (io.WriteCloser, error)
+}
+
+// FileSink writes images to files named relative to Dir, or the current
+// directory if it is empty.
+type FileSink struct {
+	Dir string
+}
+
+func (s FileSink) Create(ctx context.Context, name string) (io.WriteCloser, error) {
+	return os.Create(filepath.Join(s.Dir, name))
+}
+
+type writerSink struct {
+	w io.Writer
+}
+
+// WriterSink writes every image to w one after the other, such as to stdout
+// or a pipe, ignoring their names.
+func WriterSink(w io.Writer) Sink {
+	return writerSink{w: w}
+}
+
+func (s writerSink) Create(ctx context.Context, name string) (io.WriteCloser, error) {
+	return nopCloser{s.w}, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// HTTPSink uploads images with a PUT request to the URL that they are named
+// with.
+type HTTPSink struct {
+	// Client is used to send the requests, http.DefaultClient if nil.
+	Client *http.Client
+	Header http.Header
+}
+
+func (s HTTPSink) Create(ctx context.Context, name string) (io.WriteCloser, error) {
+	if _, err := url.Parse(name); err != nil {
+		return nil, err
+	}
+	return &upload{put: func(body []byte) error {
+		return s.put(ctx, name, body, nil)
+	}}, nil
+}
+
+func (s HTTPSink) put(ctx context.Context, u string, body []byte, sign func(req *http.Request, body []byte)) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range s.Header {
+		req.Header[k] = v
+	}
+	if sign != nil {
+		sign(req, body)
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("could not upload to %s: %s: %s", u, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// upload buffers an image until it is closed, as the whole image is needed to
+// upload it.
+type upload struct {
+	bytes.Buffer
+	put func(body []byte) error
+}
+
+func (u *upload) Close() error {
+	return u.put(u.Bytes())
+}
+
+// ParseSink returns the sink that output refers to and the name of the image
+// within it. Outputs can be s3://bucket/key URLs, which are uploaded with
+// NewS3SinkFromEnv, http:// or https:// URLs, which are uploaded with
+// HTTPSink, or otherwise local files.
+func ParseSink(output string) (Sink, string, error) {
+	u, err := url.Parse(output)
+	if err != nil || u.Scheme == "" || len(u.Scheme) == 1 {
+		// Windows drive letters look like schemes.
+		return FileSink{}, output, nil
+	}
+	switch u.Scheme {
+	case "s3":
+		key := strings.TrimPrefix(u.Path, "/")
+		if u.Host == "" || key == "" {
+			return nil, "", fmt.Errorf("%q must be of the form s3://bucket/key", output)
+		}
+		sink, err := NewS3SinkFromEnv(u.Host)
+		if err != nil {
+			return nil, "", err
+		}
+		return sink, key, nil
+	case "http", "https":
+		return HTTPSink{}, output, nil
+	case "file":
+		return FileSink{}, u.Path, nil
+	default:
+		return nil, "", fmt.Errorf("%q is not a supported output scheme", u.Scheme)
+	}
+}
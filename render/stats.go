@@ -0,0 +1,61 @@
+package render
+
+import (
+	"slices"
+	"time"
+)
+
+// Stats are how long each frame of a render took, passed to the function given
+// to WithStatsCollector once the render finishes.
+type Stats struct {
+	Frames int
+	// Pixels is the number of pixels rendered over every frame.
+	Pixels int
+	// Duration is how long the render took from start to finish. Frames are
+	// rendered concurrently, so it is usually less than the sum of
+	// FrameDurations.
+	Duration time.Duration
+	// FrameDurations are how long each frame took to render, in frame order.
+	FrameDurations []time.Duration
+	AverageFrame   time.Duration
+	MaxFrame       time.Duration
+	MinFrame       time.Duration
+	// PixelsPerSecond is the number of pixels rendered per second of
+	// Duration.
+	PixelsPerSecond float64
+	// FailedPixels is the number of pixels that couldn't be evaluated and
+	// were given the colour of WithErrorColor.
+	FailedPixels int
+	// PixelErrors are the errors of the first of the FailedPixels, up to
+	// 100, in the order of their frames, rows and columns.
+	PixelErrors []*FrameError
+}
+
+func newStats(options *renderOptions, frameDurations []time.Duration, duration time.Duration) Stats {
+	s := Stats{
+		Frames:         len(frameDurations),
+		Pixels:         len(frameDurations) * options.width * options.height,
+		Duration:       duration,
+		FrameDurations: frameDurations,
+	}
+	for _, d := range frameDurations {
+		s.AverageFrame += d
+		s.MaxFrame = max(s.MaxFrame, d)
+		if d < s.MinFrame || s.MinFrame == 0 {
+			s.MinFrame = d
+		}
+	}
+	if len(frameDurations) > 0 {
+		s.AverageFrame /= time.Duration(len(frameDurations))
+	}
+	if p := options.pixelErrors; p != nil {
+		p.mu.Lock()
+		s.FailedPixels = p.failed
+		s.PixelErrors = slices.SortedFunc(slices.Values(p.errs), compareFrameErrors)
+		p.mu.Unlock()
+	}
+	if duration > 0 {
+		s.PixelsPerSecond = float64(s.Pixels) / duration.Seconds()
+	}
+	return s
+}
@@ -0,0 +1,147 @@
+package render
+
+import (
+	"bufio"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"randomart/nodes"
+	"runtime"
+)
+
+// streamBandRows is the number of rows rendered and encoded at once by
+// RenderPNG.
+const streamBandRows = 64
+
+// RenderPNG renders the first frame and encodes it to w as a PNG a band of
+// rows at a time, so that the whole image is never held in memory. This is
+// for resolutions too large to render with Render, such as prints, so only
+// the options that work on each pixel by itself are supported. Roots with
+// multiple outputs only have their first encoded.
+func RenderPNG(ctx context.Context, root nodes.Node, w io.Writer, opts ...RenderOption) error {
+	options, err := defaultRenderOptions().apply(opts)
+	if err != nil {
+		return err
+	}
+	if len(options.remoteWorkers) > 0 || options.dithering != NoDithering || options.mode == Gray16 || options.mode == NormalMap || options.costHeatmap != nil || options.branchOverlay {
+		return fmt.Errorf("streamed PNGs cannot be rendered by remote workers or with dithering, 16-bit greyscale, normal maps, a cost heatmap or a branch overlay")
+	}
+
+	if options.liveParams != nil {
+		root = bindParams(root, options.liveParams.Values())
+	}
+	root = bindParams(root, options.params)
+	if options.targetDuration > 0 {
+		fitResolution(root, options)
+	}
+	var (
+		frame = options.startFrame
+		rows  = min(streamBandRows, options.height)
+	)
+	fs, err := newFrameState(frame, max(len(nodes.OutputNames(root)), 1), options, image.Rect(0, 0, options.width, rows))
+	if err != nil {
+		return err
+	}
+	hoisted := hoist(root, options, frame)
+
+	enc, err := newPNGStream(w, options.width, options.height)
+	if err != nil {
+		return err
+	}
+	for y := 0; y < options.height; y += rows {
+		bounds := image.Rect(0, y, options.width, min(y+rows, options.height))
+		// The band's images are reused, the last band may be shorter.
+		for _, img := range fs.imgs {
+			img.Rect = bounds
+			img.Pix = img.Pix[:bounds.Dy()*img.Stride]
+		}
+		if err = renderBand(ctx, hoisted, options, fs, bounds, runtime.NumCPU()); err != nil {
+			return err
+		}
+		if options.lut != nil {
+			applyLUT(options, fs)
+		}
+		if options.palette != nil {
+			applyPalette(options, fs)
+		}
+		if options.mask != nil {
+			applyMask(options, fs)
+		}
+		if err = enc.writeRows(fs.imgs[0]); err != nil {
+			return err
+		}
+	}
+	return enc.close()
+}
+
+// pngStream encodes the rows of an 8-bit RGBA PNG as they are written.
+type pngStream struct {
+	w    io.Writer
+	idat *bufio.Writer
+	zw   *zlib.Writer
+	cur  []byte
+	prev []byte
+	row  []byte
+}
+
+func newPNGStream(w io.Writer, width, height int) (*pngStream, error) {
+	if _, err := io.WriteString(w, pngHeader); err != nil {
+		return nil, err
+	}
+	ihdr := make([]byte, 0, 13)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, uint32(width))
+	ihdr = binary.BigEndian.AppendUint32(ihdr, uint32(height))
+	ihdr = append(ihdr, 8, pngColorRGBA, 0, 0, 0)
+	if err := writeChunk(w, "IHDR", ihdr); err != nil {
+		return nil, err
+	}
+	// Every buffer of compressed rows is written as an IDAT chunk.
+	idat := bufio.NewWriterSize(chunkWriter{w: w, name: "IDAT"}, 1<<16)
+	return &pngStream{
+		w:    w,
+		idat: idat,
+		zw:   zlib.NewWriter(idat),
+		cur:  make([]byte, width*4),
+		prev: make([]byte, width*4),
+		row:  make([]byte, 1+width*4),
+	}, nil
+}
+
+// writeRows encodes the rows of img, which follow those previously written.
+func (p *pngStream) writeRows(img *image.NRGBA) error {
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		copy(p.cur, img.Pix[img.PixOffset(img.Rect.Min.X, y):])
+		filterRow(p.row, p.cur, p.prev, 4)
+		if _, err := p.zw.Write(p.row); err != nil {
+			return err
+		}
+		p.cur, p.prev = p.prev, p.cur
+	}
+	return nil
+}
+
+func (p *pngStream) close() error {
+	if err := p.zw.Close(); err != nil {
+		return err
+	}
+	if err := p.idat.Flush(); err != nil {
+		return err
+	}
+	return writeChunk(p.w, "IEND", nil)
+}
+
+// chunkWriter writes everything written to it as a chunk.
+type chunkWriter struct {
+	w    io.Writer
+	name string
+}
+
+func (c chunkWriter) Write(b []byte) (int, error) {
+	if err := writeChunk(c.w, c.name, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
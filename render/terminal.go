@@ -0,0 +1,242 @@
+package render
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/image/draw"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"strings"
+)
+
+type TerminalProtocol string
+
+const (
+	HalfBlocks TerminalProtocol = "halfblocks"
+	Kitty      TerminalProtocol = "kitty"
+	ITerm      TerminalProtocol = "iterm"
+	Sixel      TerminalProtocol = "sixel"
+)
+
+func TerminalProtocols() []TerminalProtocol {
+	return []TerminalProtocol{
+		HalfBlocks,
+		Kitty,
+		ITerm,
+		Sixel,
+	}
+}
+
+func ParseTerminalProtocol(protocol string) (TerminalProtocol, error) {
+	for _, p := range TerminalProtocols() {
+		if string(p) == strings.ToLower(protocol) {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("%q is not a supported terminal protocol", protocol)
+}
+
+// DetectTerminalProtocol guesses the best image protocol supported by the
+// current terminal from its environment, falling back to ANSI half blocks
+// which only need truecolor support.
+func DetectTerminalProtocol() TerminalProtocol {
+	term := os.Getenv("TERM")
+	termProgram := os.Getenv("TERM_PROGRAM")
+	switch {
+	case os.Getenv("KITTY_WINDOW_ID") != "" || term == "xterm-kitty" || termProgram == "ghostty":
+		return Kitty
+	case termProgram == "iTerm.app" || termProgram == "WezTerm" || os.Getenv("LC_TERMINAL") == "iTerm2":
+		return ITerm
+	case strings.Contains(term, "sixel") || termProgram == "mlterm" || term == "foot" || term == "yaft-256color":
+		return Sixel
+	}
+	return HalfBlocks
+}
+
+func downscale(img image.Image, maxWidth int) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= maxWidth {
+		return img
+	}
+	height := max(b.Dy()*maxWidth/b.Dx(), 1)
+	dst := image.NewNRGBA(image.Rect(0, 0, maxWidth, height))
+	draw.BiLinear.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// EncodeTerminal writes a preview of the image to a terminal using the given
+// protocol. The image is downscaled to at most the preview width given by
+// WithPreviewWidth.
+func EncodeTerminal(w io.Writer, img image.Image, protocol TerminalProtocol, opts ...EncodeOption) error {
+	options := defaultEncodeOptions()
+	for _, opt := range opts {
+		if err := opt(options); err != nil {
+			return err
+		}
+	}
+
+	previewWidth := options.previewWidth
+	if previewWidth == 0 {
+		previewWidth = 480
+		if protocol == HalfBlocks {
+			previewWidth = 80
+		}
+	}
+	img = downscale(img, previewWidth)
+
+	bw := bufio.NewWriter(w)
+	var err error
+	switch protocol {
+	case HalfBlocks:
+		err = encodeHalfBlocks(bw, img)
+	case Kitty:
+		err = encodeKitty(bw, img)
+	case ITerm:
+		err = encodeITerm(bw, img)
+	case Sixel:
+		err = encodeSixel(bw, img)
+	default:
+		err = fmt.Errorf("%q terminal protocol is not handled", protocol)
+	}
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func encodeHalfBlocks(w *bufio.Writer, img image.Image) error {
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y += 2 {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			top := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if y+1 < b.Max.Y {
+				bottom := color.NRGBAModel.Convert(img.At(x, y+1)).(color.NRGBA)
+				_, _ = fmt.Fprintf(w, "\x1b[38;2;%d;%d;%dm\x1b[48;2;%d;%d;%dm▀", top.R, top.G, top.B, bottom.R, bottom.G, bottom.B)
+			} else {
+				_, _ = fmt.Fprintf(w, "\x1b[38;2;%d;%d;%dm\x1b[49m▀", top.R, top.G, top.B)
+			}
+		}
+		if _, err := w.WriteString("\x1b[0m\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeKitty(w *bufio.Writer, img image.Image) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	data := base64.StdEncoding.EncodeToString(buf.Bytes())
+	const chunkSize = 4096
+	for i := 0; i < len(data); i += chunkSize {
+		chunk := data[i:min(i+chunkSize, len(data))]
+		more := 0
+		if i+chunkSize < len(data) {
+			more = 1
+		}
+		if i == 0 {
+			_, _ = fmt.Fprintf(w, "\x1b_Gf=100,a=T,m=%d;%s\x1b\\", more, chunk)
+		} else {
+			_, _ = fmt.Fprintf(w, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+		}
+	}
+	_, err := w.WriteString("\n")
+	return err
+}
+
+func encodeITerm(w *bufio.Writer, img image.Image) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(
+		w, "\x1b]1337;File=inline=1;size=%d;width=%dpx;height=%dpx:%s\a\n",
+		buf.Len(), img.Bounds().Dx(), img.Bounds().Dy(),
+		base64.StdEncoding.EncodeToString(buf.Bytes()),
+	)
+	return err
+}
+
+// encodeSixel writes the image as sixels using a fixed 6x6x6 colour cube as
+// the palette.
+func encodeSixel(w *bufio.Writer, img image.Image) error {
+	const levels = 6
+	b := img.Bounds()
+	_, _ = w.WriteString("\x1bPq")
+	_, _ = fmt.Fprintf(w, "\"1;1;%d;%d", b.Dx(), b.Dy())
+	for i := range levels * levels * levels {
+		r, g, bl := i/(levels*levels), i/levels%levels, i%levels
+		_, _ = fmt.Fprintf(w, "#%d;2;%d;%d;%d", i, r*100/(levels-1), g*100/(levels-1), bl*100/(levels-1))
+	}
+
+	index := func(c color.Color) int {
+		n := color.NRGBAModel.Convert(c).(color.NRGBA)
+		q := func(v uint8) int { return (int(v)*(levels-1) + 127) / 255 }
+		return q(n.R)*levels*levels + q(n.G)*levels + q(n.B)
+	}
+
+	band := make([]int, b.Dx()*6)
+	for y0 := b.Min.Y; y0 < b.Max.Y; y0 += 6 {
+		used := make(map[int]bool)
+		for dy := range 6 {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				i := -1
+				if y0+dy < b.Max.Y {
+					i = index(img.At(x, y0+dy))
+					used[i] = true
+				}
+				band[dy*b.Dx()+x-b.Min.X] = i
+			}
+		}
+
+		first := true
+		for i := range levels * levels * levels {
+			if !used[i] {
+				continue
+			}
+			if !first {
+				_ = w.WriteByte('$')
+			}
+			first = false
+			_, _ = fmt.Fprintf(w, "#%d", i)
+
+			var run int
+			var prev byte
+			flush := func() {
+				if run > 3 {
+					_, _ = fmt.Fprintf(w, "!%d%c", run, prev)
+				} else {
+					for range run {
+						_ = w.WriteByte(prev)
+					}
+				}
+			}
+			for x := range b.Dx() {
+				var bits byte
+				for dy := range 6 {
+					if band[dy*b.Dx()+x] == i {
+						bits |= 1 << dy
+					}
+				}
+				c := 63 + bits
+				if run > 0 && c != prev {
+					flush()
+					run = 0
+				}
+				prev = c
+				run++
+			}
+			flush()
+		}
+		_ = w.WriteByte('-')
+	}
+	_, err := w.WriteString("\x1b\\\n")
+	return err
+}
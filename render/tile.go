@@ -0,0 +1,16 @@
+package render
+
+import "math"
+
+// tile maps x and y, which are between -1 and 1, to go from -1 to 1 and back
+// again over the width and height of the image, so that the pixel after the
+// last in each row and column would be the first. The cosine is smooth across
+// the edges, so they don't crease.
+func (r *renderOptions) tile(x, y float64) (float64, float64) {
+	wave := func(v float64, size int) float64 {
+		// The pixels span a pixel less than the period.
+		u := (v + 1) / 2 * float64(size-1) / float64(size)
+		return -math.Cos(2 * math.Pi * u)
+	}
+	return wave(x, r.width), wave(y, r.height)
+}
@@ -0,0 +1,152 @@
+package render
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math/bits"
+)
+
+const webpMaxDimension = 1 << 14
+
+type bitWriter struct {
+	buf   bytes.Buffer
+	acc   uint64
+	nBits uint
+}
+
+func (w *bitWriter) write(v uint64, n uint) {
+	w.acc |= v << w.nBits
+	w.nBits += n
+	for w.nBits >= 8 {
+		w.buf.WriteByte(byte(w.acc))
+		w.acc >>= 8
+		w.nBits -= 8
+	}
+}
+
+func (w *bitWriter) flush() []byte {
+	if w.nBits > 0 {
+		w.buf.WriteByte(byte(w.acc))
+		w.acc, w.nBits = 0, 0
+	}
+	return w.buf.Bytes()
+}
+
+// writeFlatCode writes a normal prefix code in which the first 256 symbols
+// have a code length of 8 and the remaining symbols of the alphabet are
+// unused. The code length code itself only needs the lengths 0 and 8, which
+// are both given a length of 1.
+func (w *bitWriter) writeFlatCode(alphabetSize int) {
+	w.write(0, 1)
+	// The code length code order is 17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, ...
+	// so 12 entries are needed to reach the length for 8.
+	w.write(12-4, 4)
+	for _, l := range []uint64{0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 1} {
+		w.write(l, 3)
+	}
+	w.write(0, 1)
+	for s := range alphabetSize {
+		if s < 256 {
+			w.write(1, 1)
+		} else {
+			w.write(0, 1)
+		}
+	}
+}
+
+// writeSingleCode writes a simple prefix code containing only the given
+// symbol, which then takes zero bits to encode.
+func (w *bitWriter) writeSingleCode(symbol uint8) {
+	w.write(1, 1)
+	w.write(0, 1)
+	if symbol < 2 {
+		w.write(0, 1)
+		w.write(uint64(symbol), 1)
+	} else {
+		w.write(1, 1)
+		w.write(uint64(symbol), 8)
+	}
+}
+
+func (w *bitWriter) writeSymbol(symbol uint8) {
+	w.write(uint64(bits.Reverse8(symbol)), 8)
+}
+
+// encodeWebP writes the image as a lossless (VP8L) WebP. No transforms or
+// backward references are used, so the output trades size for simplicity.
+func encodeWebP(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	if b.Dx() > webpMaxDimension || b.Dy() > webpMaxDimension {
+		return fmt.Errorf("webp images cannot be larger than %dx%d", webpMaxDimension, webpMaxDimension)
+	}
+
+	pixels := make([]color.NRGBA, 0, b.Dx()*b.Dy())
+	opaque := true
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			opaque = opaque && c.A == 0xFF
+			pixels = append(pixels, c)
+		}
+	}
+
+	var bw bitWriter
+	bw.write(0x2f, 8)
+	bw.write(uint64(b.Dx()-1), 14)
+	bw.write(uint64(b.Dy()-1), 14)
+	if opaque {
+		bw.write(0, 1)
+	} else {
+		bw.write(1, 1)
+	}
+	bw.write(0, 3)
+	// No transforms, no colour cache and no meta prefix codes.
+	bw.write(0, 1)
+	bw.write(0, 1)
+	bw.write(0, 1)
+
+	bw.writeFlatCode(256 + 24)
+	bw.writeFlatCode(256)
+	bw.writeFlatCode(256)
+	if opaque {
+		bw.writeSingleCode(0xFF)
+	} else {
+		bw.writeFlatCode(256)
+	}
+	bw.writeSingleCode(0)
+
+	for _, p := range pixels {
+		bw.writeSymbol(p.G)
+		bw.writeSymbol(p.R)
+		bw.writeSymbol(p.B)
+		if !opaque {
+			bw.writeSymbol(p.A)
+		}
+	}
+	data := bw.flush()
+
+	chunkSize := uint32(len(data))
+	padded := chunkSize + chunkSize&1
+	header := make([]byte, 0, 20)
+	header = append(header, "RIFF"...)
+	header = binary.LittleEndian.AppendUint32(header, 4+8+padded)
+	header = append(header, "WEBP"...)
+	header = append(header, "VP8L"...)
+	header = binary.LittleEndian.AppendUint32(header, chunkSize)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if padded != chunkSize {
+		if _, err := w.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"math/rand/v2"
+	"randomart/nodes"
+	"randomart/render"
+	"strconv"
+	"strings"
+)
+
+const replHelp = `Commands:
+  gen            generate a new expression from a random seed
+  seed <n>       generate a new expression from the given seed
+  mutate         regenerate a random subtree of the current expression
+  expr <expr>    use the given expression, as printed, as the current expression
+  render [WxH]   render the current expression, at the given resolution if given
+  save <file>    save the last render, rendering first if needed
+  preview        print the last render to the terminal, rendering first if needed
+  options        print the generator options of the current expression
+  reload         re-read the grammar file
+  help           print this message
+  quit           exit the REPL
+`
+
+type repl struct {
+	grammar       *nodes.Grammar
+	state         *nodes.GeneratorState
+	node          nodes.Node
+	img           image.Image
+	width, height int
+	out           io.Writer
+}
+
+func (r *repl) printf(f string, args ...any) {
+	_, _ = fmt.Fprintf(r.out, f, args...)
+}
+
+func (r *repl) reload() error {
+	grammar, err := loadGrammar(*grammarFilename)
+	if err != nil {
+		return err
+	}
+	r.grammar = grammar
+	r.printf("%s", grammar)
+	return nil
+}
+
+func (r *repl) gen(seed uint64) error {
+	node, state, err := r.grammar.Gen(nodes.WithSeeds(seed))
+	if err != nil {
+		return fmt.Errorf("could not generate random AST: %w", err)
+	}
+	r.node, r.state, r.img = node, state, nil
+	return nil
+}
+
+func (r *repl) render(ctx context.Context) error {
+	img, err := render.Render(
+		ctx, r.node,
+		append([]render.RenderOption{
+			render.WithResolution(r.width, r.height),
+			render.WithSamples(*samples),
+			render.WithJitter(*jitter),
+		}, paramOptions()...)...,
+	)
+	if err != nil {
+		return fmt.Errorf("could not render image: %w", err)
+	}
+	r.img = img
+	r.printf("rendered %dx%d image\n", r.width, r.height)
+	return nil
+}
+
+func (r *repl) exec(ctx context.Context, command string, args []string) (err error) {
+	needsNode := func() error {
+		if r.node == nil {
+			return fmt.Errorf("no expression has been generated yet, use gen or seed")
+		}
+		return nil
+	}
+
+	switch command {
+	case "help":
+		r.printf(replHelp)
+		return nil
+	case "reload":
+		return r.reload()
+	case "gen":
+		err = r.gen(rand.Uint64())
+	case "seed":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: seed <n>")
+		}
+		seed, parseErr := strconv.ParseUint(args[0], 10, 64)
+		if parseErr != nil {
+			return fmt.Errorf("invalid seed %q: %w", args[0], parseErr)
+		}
+		err = r.gen(seed)
+	case "expr":
+		node, err := nodes.ParseExpression(strings.NewReader(strings.Join(args, " ")), "expr")
+		if err != nil {
+			return fmt.Errorf("could not parse expression: %w", err)
+		}
+		r.node, r.state, r.img = node, nil, nil
+	case "mutate":
+		if err = needsNode(); err != nil {
+			return err
+		}
+		if r.state == nil {
+			return fmt.Errorf("the expression was not generated so cannot be mutated")
+		}
+		node, err := r.state.Mutate(r.node)
+		if err != nil {
+			return fmt.Errorf("could not mutate expression: %w", err)
+		}
+		r.node, r.img = node, nil
+	case "render":
+		if err = needsNode(); err != nil {
+			return err
+		}
+		if len(args) == 1 {
+			if _, err = fmt.Sscanf(args[0], "%dx%d", &r.width, &r.height); err != nil {
+				return fmt.Errorf("invalid resolution %q, expected WxH", args[0])
+			}
+		}
+		err = r.render(ctx)
+	case "save":
+		if err = needsNode(); err != nil {
+			return err
+		}
+		if len(args) != 1 {
+			return fmt.Errorf("usage: save <file>")
+		}
+		if r.img == nil {
+			if err = r.render(ctx); err != nil {
+				return err
+			}
+		}
+		format, err := render.FormatFromFilename(args[0])
+		if err != nil {
+			return err
+		}
+		if err = writeImage(args[0], r.img, format, render.WithQuality(*quality)); err != nil {
+			return err
+		}
+		r.printf("saved to %s\n", args[0])
+		return nil
+	case "preview":
+		if err = needsNode(); err != nil {
+			return err
+		}
+		if r.img == nil {
+			if err = r.render(ctx); err != nil {
+				return err
+			}
+		}
+		protocol, err := terminalProtocol()
+		if err != nil {
+			return err
+		}
+		return render.EncodeTerminal(r.out, r.img, protocol)
+	case "options":
+		if err = needsNode(); err != nil {
+			return err
+		}
+		if r.state == nil {
+			return fmt.Errorf("the expression was not generated so has no options")
+		}
+		r.printf("%s", r.state.Options())
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q, use help to list commands", command)
+	}
+	if err != nil {
+		return err
+	}
+	r.printf("%s\n", r.node)
+	return nil
+}
+
+func runREPL(ctx context.Context, in io.Reader, out io.Writer) error {
+	r := &repl{
+		width:  *width,
+		height: *height,
+		out:    out,
+	}
+	if err := r.reload(); err != nil {
+		return err
+	}
+	r.printf("Type help to list commands.\n")
+
+	scanner := bufio.NewScanner(in)
+	for {
+		r.printf("> ")
+		if !scanner.Scan() {
+			r.printf("\n")
+			return scanner.Err()
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "quit" || fields[0] == "exit" {
+			return nil
+		}
+		if err := r.exec(ctx, fields[0], fields[1:]); err != nil {
+			r.printf("error: %s\n", err)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package rpc
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"google.golang.org/grpc"
+	"maps"
+	"net/http"
+	"path"
+	"slices"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the buckets of the
+// histograms of how long requests take. They go higher than those of the
+// workers as requests render whole frames, and streams every frame.
+var latencyBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// serverMetrics are the metrics of the requests to each method of Server, by
+// the method's name.
+var serverMetrics = struct {
+	requests *expvar.Map
+	errors   *expvar.Map
+	inFlight *expvar.Map
+
+	mu        sync.Mutex
+	latencies map[string]*latency
+}{
+	requests:  expvar.NewMap("randomart_rpc_requests_total"),
+	errors:    expvar.NewMap("randomart_rpc_request_errors_total"),
+	inFlight:  expvar.NewMap("randomart_rpc_requests_in_flight"),
+	latencies: make(map[string]*latency),
+}
+
+// latency is the histogram of how long the requests to a method took.
+type latency struct {
+	buckets []uint64
+	sum     float64
+}
+
+// observe records a request to the method with the given full name, such as
+// /randomart.Randomart/GenerateArt, from when it started until call returns.
+func observe(fullMethod string, call func() error) error {
+	method := path.Base(fullMethod)
+	serverMetrics.inFlight.Add(method, 1)
+	start := time.Now()
+	err := call()
+	d := time.Since(start)
+	serverMetrics.inFlight.Add(method, -1)
+
+	serverMetrics.requests.Add(method, 1)
+	if err != nil {
+		serverMetrics.errors.Add(method, 1)
+	}
+	serverMetrics.mu.Lock()
+	defer serverMetrics.mu.Unlock()
+	l, ok := serverMetrics.latencies[method]
+	if !ok {
+		l = &latency{buckets: make([]uint64, len(latencyBuckets)+1)}
+		serverMetrics.latencies[method] = l
+	}
+	i := 0
+	for i < len(latencyBuckets) && d.Seconds() > latencyBuckets[i] {
+		i++
+	}
+	l.buckets[i]++
+	l.sum += d.Seconds()
+	return err
+}
+
+// UnaryMetricsInterceptor records the metrics of unary requests, such as
+// GenerateArt, served by MetricsHandler.
+func UnaryMetricsInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	err = observe(info.FullMethod, func() error {
+		resp, err = handler(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+// StreamMetricsInterceptor records the metrics of streaming requests, such as
+// RenderFrames, served by MetricsHandler. They take until the last message is
+// sent.
+func StreamMetricsInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return observe(info.FullMethod, func() error {
+		return handler(srv, ss)
+	})
+}
+
+// MetricsHandler serves the metrics of the requests recorded by
+// UnaryMetricsInterceptor and StreamMetricsInterceptor, such as how many have
+// been made to each method, how many failed, how many are being served and how
+// long they took, in the Prometheus text format. The counters are also
+// published with expvar.
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		metric := func(name, kind, help string, m *expvar.Map) {
+			fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+			m.Do(func(kv expvar.KeyValue) {
+				fmt.Fprintf(w, "%s{method=%q} %s\n", name, kv.Key, kv.Value)
+			})
+		}
+		metric("randomart_rpc_requests_total", "counter", "Requests served.", serverMetrics.requests)
+		metric("randomart_rpc_request_errors_total", "counter", "Requests that failed.", serverMetrics.errors)
+		metric("randomart_rpc_requests_in_flight", "gauge", "Requests being served.", serverMetrics.inFlight)
+
+		serverMetrics.mu.Lock()
+		defer serverMetrics.mu.Unlock()
+		const name = "randomart_rpc_request_duration_seconds"
+		fmt.Fprintf(w, "# HELP %s How long requests took to serve.\n# TYPE %s histogram\n", name, name)
+		for _, method := range slices.Sorted(maps.Keys(serverMetrics.latencies)) {
+			l := serverMetrics.latencies[method]
+			var count uint64
+			for i, le := range latencyBuckets {
+				count += l.buckets[i]
+				fmt.Fprintf(w, "%s_bucket{method=%q,le=\"%g\"} %d\n", name, method, le, count)
+			}
+			count += l.buckets[len(latencyBuckets)]
+			fmt.Fprintf(w, "%s_bucket{method=%q,le=\"+Inf\"} %d\n", name, method, count)
+			fmt.Fprintf(w, "%s_sum{method=%q} %g\n%s_count{method=%q} %d\n", name, method, l.sum, name, method, count)
+		}
+	})
+}
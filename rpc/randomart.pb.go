@@ -0,0 +1,500 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: randomart.proto
+
+package rpc
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Resolution struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Width         int32                  `protobuf:"varint,1,opt,name=width,proto3" json:"width,omitempty"`
+	Height        int32                  `protobuf:"varint,2,opt,name=height,proto3" json:"height,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Resolution) Reset() {
+	*x = Resolution{}
+	mi := &file_randomart_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Resolution) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Resolution) ProtoMessage() {}
+
+func (x *Resolution) ProtoReflect() protoreflect.Message {
+	mi := &file_randomart_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Resolution.ProtoReflect.Descriptor instead.
+func (*Resolution) Descriptor() ([]byte, []int) {
+	return file_randomart_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Resolution) GetWidth() int32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *Resolution) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+type GenerateArtRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// grammar is the source of the grammar to generate from, the server's
+	// grammar is used if it is empty.
+	Grammar string `protobuf:"bytes,1,opt,name=grammar,proto3" json:"grammar,omitempty"`
+	// seed seeds the generator, seed_string is hashed into the seed if it is
+	// given instead and the seed is random if neither is.
+	Seed       uint64      `protobuf:"varint,2,opt,name=seed,proto3" json:"seed,omitempty"`
+	SeedString string      `protobuf:"bytes,3,opt,name=seed_string,json=seedString,proto3" json:"seed_string,omitempty"`
+	Resolution *Resolution `protobuf:"bytes,4,opt,name=resolution,proto3" json:"resolution,omitempty"`
+	Samples    int32       `protobuf:"varint,5,opt,name=samples,proto3" json:"samples,omitempty"`
+	// format is the format the image is encoded as, PNG if it is empty.
+	Format        string `protobuf:"bytes,6,opt,name=format,proto3" json:"format,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GenerateArtRequest) Reset() {
+	*x = GenerateArtRequest{}
+	mi := &file_randomart_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GenerateArtRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GenerateArtRequest) ProtoMessage() {}
+
+func (x *GenerateArtRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_randomart_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GenerateArtRequest.ProtoReflect.Descriptor instead.
+func (*GenerateArtRequest) Descriptor() ([]byte, []int) {
+	return file_randomart_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GenerateArtRequest) GetGrammar() string {
+	if x != nil {
+		return x.Grammar
+	}
+	return ""
+}
+
+func (x *GenerateArtRequest) GetSeed() uint64 {
+	if x != nil {
+		return x.Seed
+	}
+	return 0
+}
+
+func (x *GenerateArtRequest) GetSeedString() string {
+	if x != nil {
+		return x.SeedString
+	}
+	return ""
+}
+
+func (x *GenerateArtRequest) GetResolution() *Resolution {
+	if x != nil {
+		return x.Resolution
+	}
+	return nil
+}
+
+func (x *GenerateArtRequest) GetSamples() int32 {
+	if x != nil {
+		return x.Samples
+	}
+	return 0
+}
+
+func (x *GenerateArtRequest) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+type GenerateArtResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// expression is the generated expression, which can be rendered again with
+	// RenderFrames.
+	Expression string `protobuf:"bytes,1,opt,name=expression,proto3" json:"expression,omitempty"`
+	// options are the options of the generator as JSON, which reproduce the
+	// expression from the same grammar.
+	Options       string `protobuf:"bytes,2,opt,name=options,proto3" json:"options,omitempty"`
+	Image         []byte `protobuf:"bytes,3,opt,name=image,proto3" json:"image,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GenerateArtResponse) Reset() {
+	*x = GenerateArtResponse{}
+	mi := &file_randomart_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GenerateArtResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GenerateArtResponse) ProtoMessage() {}
+
+func (x *GenerateArtResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_randomart_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GenerateArtResponse.ProtoReflect.Descriptor instead.
+func (*GenerateArtResponse) Descriptor() ([]byte, []int) {
+	return file_randomart_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GenerateArtResponse) GetExpression() string {
+	if x != nil {
+		return x.Expression
+	}
+	return ""
+}
+
+func (x *GenerateArtResponse) GetOptions() string {
+	if x != nil {
+		return x.Options
+	}
+	return ""
+}
+
+func (x *GenerateArtResponse) GetImage() []byte {
+	if x != nil {
+		return x.Image
+	}
+	return nil
+}
+
+type RenderFramesRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Source:
+	//
+	//	*RenderFramesRequest_Expression
+	//	*RenderFramesRequest_Generate
+	Source        isRenderFramesRequest_Source `protobuf_oneof:"source"`
+	Resolution    *Resolution                  `protobuf:"bytes,3,opt,name=resolution,proto3" json:"resolution,omitempty"`
+	Frames        int32                        `protobuf:"varint,4,opt,name=frames,proto3" json:"frames,omitempty"`
+	Samples       int32                        `protobuf:"varint,5,opt,name=samples,proto3" json:"samples,omitempty"`
+	Format        string                       `protobuf:"bytes,6,opt,name=format,proto3" json:"format,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RenderFramesRequest) Reset() {
+	*x = RenderFramesRequest{}
+	mi := &file_randomart_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RenderFramesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RenderFramesRequest) ProtoMessage() {}
+
+func (x *RenderFramesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_randomart_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RenderFramesRequest.ProtoReflect.Descriptor instead.
+func (*RenderFramesRequest) Descriptor() ([]byte, []int) {
+	return file_randomart_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *RenderFramesRequest) GetSource() isRenderFramesRequest_Source {
+	if x != nil {
+		return x.Source
+	}
+	return nil
+}
+
+func (x *RenderFramesRequest) GetExpression() string {
+	if x != nil {
+		if x, ok := x.Source.(*RenderFramesRequest_Expression); ok {
+			return x.Expression
+		}
+	}
+	return ""
+}
+
+func (x *RenderFramesRequest) GetGenerate() *GenerateArtRequest {
+	if x != nil {
+		if x, ok := x.Source.(*RenderFramesRequest_Generate); ok {
+			return x.Generate
+		}
+	}
+	return nil
+}
+
+func (x *RenderFramesRequest) GetResolution() *Resolution {
+	if x != nil {
+		return x.Resolution
+	}
+	return nil
+}
+
+func (x *RenderFramesRequest) GetFrames() int32 {
+	if x != nil {
+		return x.Frames
+	}
+	return 0
+}
+
+func (x *RenderFramesRequest) GetSamples() int32 {
+	if x != nil {
+		return x.Samples
+	}
+	return 0
+}
+
+func (x *RenderFramesRequest) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+type isRenderFramesRequest_Source interface {
+	isRenderFramesRequest_Source()
+}
+
+type RenderFramesRequest_Expression struct {
+	Expression string `protobuf:"bytes,1,opt,name=expression,proto3,oneof"`
+}
+
+type RenderFramesRequest_Generate struct {
+	Generate *GenerateArtRequest `protobuf:"bytes,2,opt,name=generate,proto3,oneof"`
+}
+
+func (*RenderFramesRequest_Expression) isRenderFramesRequest_Source() {}
+
+func (*RenderFramesRequest_Generate) isRenderFramesRequest_Source() {}
+
+type Frame struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Number        int32                  `protobuf:"varint,1,opt,name=number,proto3" json:"number,omitempty"`
+	Image         []byte                 `protobuf:"bytes,2,opt,name=image,proto3" json:"image,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Frame) Reset() {
+	*x = Frame{}
+	mi := &file_randomart_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Frame) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Frame) ProtoMessage() {}
+
+func (x *Frame) ProtoReflect() protoreflect.Message {
+	mi := &file_randomart_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Frame.ProtoReflect.Descriptor instead.
+func (*Frame) Descriptor() ([]byte, []int) {
+	return file_randomart_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Frame) GetNumber() int32 {
+	if x != nil {
+		return x.Number
+	}
+	return 0
+}
+
+func (x *Frame) GetImage() []byte {
+	if x != nil {
+		return x.Image
+	}
+	return nil
+}
+
+var File_randomart_proto protoreflect.FileDescriptor
+
+const file_randomart_proto_rawDesc = "" +
+	"\n" +
+	"\x0frandomart.proto\x12\trandomart\":\n" +
+	"\n" +
+	"Resolution\x12\x14\n" +
+	"\x05width\x18\x01 \x01(\x05R\x05width\x12\x16\n" +
+	"\x06height\x18\x02 \x01(\x05R\x06height\"\xcc\x01\n" +
+	"\x12GenerateArtRequest\x12\x18\n" +
+	"\agrammar\x18\x01 \x01(\tR\agrammar\x12\x12\n" +
+	"\x04seed\x18\x02 \x01(\x04R\x04seed\x12\x1f\n" +
+	"\vseed_string\x18\x03 \x01(\tR\n" +
+	"seedString\x125\n" +
+	"\n" +
+	"resolution\x18\x04 \x01(\v2\x15.randomart.ResolutionR\n" +
+	"resolution\x12\x18\n" +
+	"\asamples\x18\x05 \x01(\x05R\asamples\x12\x16\n" +
+	"\x06format\x18\x06 \x01(\tR\x06format\"e\n" +
+	"\x13GenerateArtResponse\x12\x1e\n" +
+	"\n" +
+	"expression\x18\x01 \x01(\tR\n" +
+	"expression\x12\x18\n" +
+	"\aoptions\x18\x02 \x01(\tR\aoptions\x12\x14\n" +
+	"\x05image\x18\x03 \x01(\fR\x05image\"\xff\x01\n" +
+	"\x13RenderFramesRequest\x12 \n" +
+	"\n" +
+	"expression\x18\x01 \x01(\tH\x00R\n" +
+	"expression\x12;\n" +
+	"\bgenerate\x18\x02 \x01(\v2\x1d.randomart.GenerateArtRequestH\x00R\bgenerate\x125\n" +
+	"\n" +
+	"resolution\x18\x03 \x01(\v2\x15.randomart.ResolutionR\n" +
+	"resolution\x12\x16\n" +
+	"\x06frames\x18\x04 \x01(\x05R\x06frames\x12\x18\n" +
+	"\asamples\x18\x05 \x01(\x05R\asamples\x12\x16\n" +
+	"\x06format\x18\x06 \x01(\tR\x06formatB\b\n" +
+	"\x06source\"5\n" +
+	"\x05Frame\x12\x16\n" +
+	"\x06number\x18\x01 \x01(\x05R\x06number\x12\x14\n" +
+	"\x05image\x18\x02 \x01(\fR\x05image2\x9d\x01\n" +
+	"\tRandomart\x12L\n" +
+	"\vGenerateArt\x12\x1d.randomart.GenerateArtRequest\x1a\x1e.randomart.GenerateArtResponse\x12B\n" +
+	"\fRenderFrames\x12\x1e.randomart.RenderFramesRequest\x1a\x10.randomart.Frame0\x01B\x0fZ\rrandomart/rpcb\x06proto3"
+
+var (
+	file_randomart_proto_rawDescOnce sync.Once
+	file_randomart_proto_rawDescData []byte
+)
+
+func file_randomart_proto_rawDescGZIP() []byte {
+	file_randomart_proto_rawDescOnce.Do(func() {
+		file_randomart_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_randomart_proto_rawDesc), len(file_randomart_proto_rawDesc)))
+	})
+	return file_randomart_proto_rawDescData
+}
+
+var file_randomart_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_randomart_proto_goTypes = []any{
+	(*Resolution)(nil),          // 0: randomart.Resolution
+	(*GenerateArtRequest)(nil),  // 1: randomart.GenerateArtRequest
+	(*GenerateArtResponse)(nil), // 2: randomart.GenerateArtResponse
+	(*RenderFramesRequest)(nil), // 3: randomart.RenderFramesRequest
+	(*Frame)(nil),               // 4: randomart.Frame
+}
+var file_randomart_proto_depIdxs = []int32{
+	0, // 0: randomart.GenerateArtRequest.resolution:type_name -> randomart.Resolution
+	1, // 1: randomart.RenderFramesRequest.generate:type_name -> randomart.GenerateArtRequest
+	0, // 2: randomart.RenderFramesRequest.resolution:type_name -> randomart.Resolution
+	1, // 3: randomart.Randomart.GenerateArt:input_type -> randomart.GenerateArtRequest
+	3, // 4: randomart.Randomart.RenderFrames:input_type -> randomart.RenderFramesRequest
+	2, // 5: randomart.Randomart.GenerateArt:output_type -> randomart.GenerateArtResponse
+	4, // 6: randomart.Randomart.RenderFrames:output_type -> randomart.Frame
+	5, // [5:7] is the sub-list for method output_type
+	3, // [3:5] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_randomart_proto_init() }
+func file_randomart_proto_init() {
+	if File_randomart_proto != nil {
+		return
+	}
+	file_randomart_proto_msgTypes[3].OneofWrappers = []any{
+		(*RenderFramesRequest_Expression)(nil),
+		(*RenderFramesRequest_Generate)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_randomart_proto_rawDesc), len(file_randomart_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_randomart_proto_goTypes,
+		DependencyIndexes: file_randomart_proto_depIdxs,
+		MessageInfos:      file_randomart_proto_msgTypes,
+	}.Build()
+	File_randomart_proto = out.File
+	file_randomart_proto_goTypes = nil
+	file_randomart_proto_depIdxs = nil
+}
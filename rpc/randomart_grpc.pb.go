@@ -0,0 +1,175 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: randomart.proto
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Randomart_GenerateArt_FullMethodName  = "/randomart.Randomart/GenerateArt"
+	Randomart_RenderFrames_FullMethodName = "/randomart.Randomart/RenderFrames"
+)
+
+// RandomartClient is the client API for Randomart service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Randomart generates expressions from grammars and renders them.
+type RandomartClient interface {
+	// GenerateArt generates an expression from a grammar and renders it.
+	GenerateArt(ctx context.Context, in *GenerateArtRequest, opts ...grpc.CallOption) (*GenerateArtResponse, error)
+	// RenderFrames renders each frame of an expression, or of one generated
+	// from a grammar, sending each as soon as it and those before it have
+	// been rendered.
+	RenderFrames(ctx context.Context, in *RenderFramesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Frame], error)
+}
+
+type randomartClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRandomartClient(cc grpc.ClientConnInterface) RandomartClient {
+	return &randomartClient{cc}
+}
+
+func (c *randomartClient) GenerateArt(ctx context.Context, in *GenerateArtRequest, opts ...grpc.CallOption) (*GenerateArtResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GenerateArtResponse)
+	err := c.cc.Invoke(ctx, Randomart_GenerateArt_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *randomartClient) RenderFrames(ctx context.Context, in *RenderFramesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Frame], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Randomart_ServiceDesc.Streams[0], Randomart_RenderFrames_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[RenderFramesRequest, Frame]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Randomart_RenderFramesClient = grpc.ServerStreamingClient[Frame]
+
+// RandomartServer is the server API for Randomart service.
+// All implementations must embed UnimplementedRandomartServer
+// for forward compatibility.
+//
+// Randomart generates expressions from grammars and renders them.
+type RandomartServer interface {
+	// GenerateArt generates an expression from a grammar and renders it.
+	GenerateArt(context.Context, *GenerateArtRequest) (*GenerateArtResponse, error)
+	// RenderFrames renders each frame of an expression, or of one generated
+	// from a grammar, sending each as soon as it and those before it have
+	// been rendered.
+	RenderFrames(*RenderFramesRequest, grpc.ServerStreamingServer[Frame]) error
+	mustEmbedUnimplementedRandomartServer()
+}
+
+// UnimplementedRandomartServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedRandomartServer struct{}
+
+func (UnimplementedRandomartServer) GenerateArt(context.Context, *GenerateArtRequest) (*GenerateArtResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GenerateArt not implemented")
+}
+func (UnimplementedRandomartServer) RenderFrames(*RenderFramesRequest, grpc.ServerStreamingServer[Frame]) error {
+	return status.Errorf(codes.Unimplemented, "method RenderFrames not implemented")
+}
+func (UnimplementedRandomartServer) mustEmbedUnimplementedRandomartServer() {}
+func (UnimplementedRandomartServer) testEmbeddedByValue()                   {}
+
+// UnsafeRandomartServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RandomartServer will
+// result in compilation errors.
+type UnsafeRandomartServer interface {
+	mustEmbedUnimplementedRandomartServer()
+}
+
+func RegisterRandomartServer(s grpc.ServiceRegistrar, srv RandomartServer) {
+	// If the following call pancis, it indicates UnimplementedRandomartServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Randomart_ServiceDesc, srv)
+}
+
+func _Randomart_GenerateArt_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GenerateArtRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RandomartServer).GenerateArt(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Randomart_GenerateArt_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RandomartServer).GenerateArt(ctx, req.(*GenerateArtRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Randomart_RenderFrames_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(RenderFramesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RandomartServer).RenderFrames(m, &grpc.GenericServerStream[RenderFramesRequest, Frame]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Randomart_RenderFramesServer = grpc.ServerStreamingServer[Frame]
+
+// Randomart_ServiceDesc is the grpc.ServiceDesc for Randomart service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Randomart_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "randomart.Randomart",
+	HandlerType: (*RandomartServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GenerateArt",
+			Handler:    _Randomart_GenerateArt_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "RenderFrames",
+			Handler:       _Randomart_RenderFrames_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "randomart.proto",
+}
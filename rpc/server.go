@@ -0,0 +1,204 @@
+// Package rpc is the Randomart gRPC service, which generates and renders
+// randomart for other services.
+package rpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative randomart.proto
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"image"
+	"randomart/nodes"
+	"randomart/render"
+	"strings"
+	"time"
+)
+
+// Server implements the Randomart service. Requests that don't give a grammar
+// are generated from the server's.
+type Server struct {
+	UnimplementedRandomartServer
+	grammar *nodes.Grammar
+	// PixelTimeout is how long rendering may take a pixel before the request
+	// fails with ResourceExhausted, if not 0.
+	PixelTimeout time.Duration
+	// LiveParams, if not nil, are bound at the start of each frame rendered.
+	LiveParams *render.LiveParams
+	// MaxWidth, MaxHeight, MaxFrames and MaxSamples are the largest values
+	// that requests may give, which are rejected with InvalidArgument if they
+	// are over. The defaults are used for those that are 0.
+	MaxWidth, MaxHeight, MaxFrames, MaxSamples int
+}
+
+// The limits of requests used when those of the Server are 0.
+const (
+	DefaultMaxWidth   = 4096
+	DefaultMaxHeight  = 4096
+	DefaultMaxFrames  = 600
+	DefaultMaxSamples = 64
+)
+
+func NewServer(grammar *nodes.Grammar) *Server {
+	return &Server{grammar: grammar}
+}
+
+func (s *Server) GenerateArt(ctx context.Context, req *GenerateArtRequest) (*GenerateArtResponse, error) {
+	format, err := parseFormat(req.GetFormat())
+	if err != nil {
+		return nil, err
+	}
+	opts, err := s.renderOptions(req.GetResolution(), 1, req.GetSamples())
+	if err != nil {
+		return nil, err
+	}
+	root, state, err := s.generate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	img, err := render.Render(ctx, root, opts...)
+	if err != nil {
+		return nil, renderError(ctx, err)
+	}
+	data, err := encode(img, format)
+	if err != nil {
+		return nil, err
+	}
+	return &GenerateArtResponse{Expression: root.String(), Options: state.Options(), Image: data}, nil
+}
+
+func (s *Server) RenderFrames(req *RenderFramesRequest, stream grpc.ServerStreamingServer[Frame]) error {
+	ctx := stream.Context()
+	format, err := parseFormat(req.GetFormat())
+	if err != nil {
+		return err
+	}
+	opts, err := s.renderOptions(req.GetResolution(), req.GetFrames(), req.GetSamples())
+	if err != nil {
+		return err
+	}
+	var root nodes.Node
+	switch source := req.GetSource().(type) {
+	case *RenderFramesRequest_Expression:
+		if root, err = nodes.ParseExpression(strings.NewReader(source.Expression), "expression"); err != nil {
+			return status.Errorf(codes.InvalidArgument, "could not parse expression: %s", err)
+		}
+	case *RenderFramesRequest_Generate:
+		if root, _, err = s.generate(ctx, source.Generate); err != nil {
+			return err
+		}
+	default:
+		return status.Error(codes.InvalidArgument, "an expression or a grammar to generate one from must be given")
+	}
+
+	err = render.RenderCallback(ctx, root, func(no int, img image.Image) error {
+		data, err := encode(img, format)
+		if err != nil {
+			return err
+		}
+		return stream.Send(&Frame{Number: int32(no), Image: data})
+	}, opts...)
+	return renderError(ctx, err)
+}
+
+// generate generates an expression from the request's grammar, or the
+// server's if it doesn't have one.
+func (s *Server) generate(ctx context.Context, req *GenerateArtRequest) (nodes.Node, *nodes.GeneratorState, error) {
+	grammar := s.grammar
+	if req.GetGrammar() != "" {
+		var err error
+		if grammar, err = nodes.Parse(strings.NewReader(req.GetGrammar()), "grammar"); err != nil {
+			return nil, nil, status.Errorf(codes.InvalidArgument, "could not parse grammar: %s", err)
+		}
+	}
+	if grammar == nil {
+		return nil, nil, status.Error(codes.InvalidArgument, "a grammar must be given as the server doesn't have one")
+	}
+
+	var opts []nodes.GeneratorOption
+	if req.GetSeedString() != "" {
+		opts = append(opts, nodes.WithSeedString(req.GetSeedString()))
+	} else if req.GetSeed() != 0 {
+		opts = append(opts, nodes.WithSeeds(req.GetSeed()))
+	}
+	root, state, err := grammar.GenContext(ctx, opts...)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, status.FromContextError(ctx.Err()).Err()
+		}
+		return nil, nil, status.Errorf(codes.FailedPrecondition, "could not generate an expression: %s", err)
+	}
+	return root, state, nil
+}
+
+// renderOptions returns the options to render a request with, or an
+// InvalidArgument error if it is over the server's limits.
+func (s *Server) renderOptions(resolution *Resolution, frames, samples int32) ([]render.RenderOption, error) {
+	for _, limit := range []struct {
+		name       string
+		value, max int
+	}{
+		{"width", int(resolution.GetWidth()), cmp.Or(s.MaxWidth, DefaultMaxWidth)},
+		{"height", int(resolution.GetHeight()), cmp.Or(s.MaxHeight, DefaultMaxHeight)},
+		{"frames", int(frames), cmp.Or(s.MaxFrames, DefaultMaxFrames)},
+		{"samples", int(samples), cmp.Or(s.MaxSamples, DefaultMaxSamples)},
+	} {
+		if limit.value > limit.max {
+			return nil, status.Errorf(codes.InvalidArgument, "%s cannot be more than %d", limit.name, limit.max)
+		}
+	}
+	opts := []render.RenderOption{render.WithPixelTimeout(s.PixelTimeout)}
+	if resolution != nil {
+		opts = append(opts, render.WithResolution(int(resolution.GetWidth()), int(resolution.GetHeight())))
+	}
+	if frames > 0 {
+		opts = append(opts, render.WithFrames(int(frames)))
+	}
+	if samples > 0 {
+		opts = append(opts, render.WithSamples(int(samples)))
+	}
+	if s.LiveParams != nil {
+		opts = append(opts, render.WithLiveParams(s.LiveParams))
+	}
+	return opts, nil
+}
+
+// renderError returns the status of an error returned by a render.
+func renderError(ctx context.Context, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() != nil:
+		return status.FromContextError(ctx.Err()).Err()
+	case status.Code(err) != codes.Unknown:
+		return err
+	case errors.Is(err, nodes.ErrDeadlineExceeded):
+		return status.Errorf(codes.ResourceExhausted, "could not render: %s", err)
+	default:
+		return status.Errorf(codes.InvalidArgument, "could not render: %s", err)
+	}
+}
+
+func parseFormat(format string) (render.Format, error) {
+	if format == "" {
+		return render.PNG, nil
+	}
+	f, err := render.ParseFormat(format)
+	if err != nil {
+		return "", status.Error(codes.InvalidArgument, err.Error())
+	}
+	return f, nil
+}
+
+func encode(img image.Image, format render.Format) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := render.Encode(&buf, img, format); err != nil {
+		return nil, fmt.Errorf("could not encode %s: %w", format, err)
+	}
+	return buf.Bytes(), nil
+}
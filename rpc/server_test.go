@@ -0,0 +1,181 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"image"
+	"image/png"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"randomart/nodes"
+	"strings"
+	"testing"
+)
+
+// newClient serves the server over an in-memory connection and returns a
+// client of it.
+func newClient(t *testing.T, s *Server, opts ...grpc.ServerOption) RandomartClient {
+	t.Helper()
+	l := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(opts...)
+	RegisterRandomartServer(server, s)
+	go server.Serve(l)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return l.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewRandomartClient(conn)
+}
+
+func testServer(t *testing.T) *Server {
+	t.Helper()
+	f, err := os.Open("../grammar.bnf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	g, err := nodes.Parse(f, "grammar.bnf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewServer(g)
+}
+
+func decodePNG(t *testing.T, data []byte) image.Image {
+	t.Helper()
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestGenerateArt(t *testing.T) {
+	client := newClient(t, testServer(t))
+	resp, err := client.GenerateArt(context.Background(), &GenerateArtRequest{
+		SeedString: "alice",
+		Resolution: &Resolution{Width: 8, Height: 6},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetExpression() == "" || resp.GetOptions() == "" {
+		t.Errorf("got expression %q and options %q, want both", resp.GetExpression(), resp.GetOptions())
+	}
+	if b := decodePNG(t, resp.GetImage()).Bounds(); b.Dx() != 8 || b.Dy() != 6 {
+		t.Errorf("got a %dx%d image, want 8x6", b.Dx(), b.Dy())
+	}
+}
+
+func TestRenderFrames(t *testing.T) {
+	client := newClient(t, testServer(t))
+	stream, err := client.RenderFrames(context.Background(), &RenderFramesRequest{
+		Source:     &RenderFramesRequest_Expression{Expression: "(x, y, f)"},
+		Resolution: &Resolution{Width: 4, Height: 4},
+		Frames:     3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var frames int32
+	for {
+		frame, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if frame.GetNumber() != frames {
+			t.Errorf("got frame %d, want %d", frame.GetNumber(), frames)
+		}
+		decodePNG(t, frame.GetImage())
+		frames++
+	}
+	if frames != 3 {
+		t.Errorf("got %d frames, want 3", frames)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	s := testServer(t)
+	s.MaxWidth, s.MaxFrames = 16, 4
+	client := newClient(t, s)
+	for name, req := range map[string]*RenderFramesRequest{
+		"width":   {Resolution: &Resolution{Width: 17, Height: 4}},
+		"height":  {Resolution: &Resolution{Width: 4, Height: DefaultMaxHeight + 1}},
+		"frames":  {Resolution: &Resolution{Width: 4, Height: 4}, Frames: 5},
+		"samples": {Resolution: &Resolution{Width: 4, Height: 4}, Samples: DefaultMaxSamples + 1},
+	} {
+		req.Source = &RenderFramesRequest_Expression{Expression: "(x, y, f)"}
+		stream, err := client.RenderFrames(context.Background(), req)
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%s: got %v, want InvalidArgument", name, err)
+		}
+	}
+	_, err := client.GenerateArt(context.Background(), &GenerateArtRequest{Resolution: &Resolution{Width: 17, Height: 4}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("GenerateArt: got %v, want InvalidArgument", err)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	client := newClient(t, testServer(t),
+		grpc.ChainUnaryInterceptor(UnaryMetricsInterceptor),
+		grpc.ChainStreamInterceptor(StreamMetricsInterceptor),
+	)
+	ctx := context.Background()
+	if _, err := client.GenerateArt(ctx, &GenerateArtRequest{SeedString: "alice", Resolution: &Resolution{Width: 4, Height: 4}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GenerateArt(ctx, &GenerateArtRequest{Resolution: &Resolution{Width: DefaultMaxWidth + 1, Height: 4}}); err == nil {
+		t.Fatal("rendered a request over the limits")
+	}
+	stream, err := client.RenderFrames(ctx, &RenderFramesRequest{
+		Source:     &RenderFramesRequest_Expression{Expression: "(x, y, f)"},
+		Resolution: &Resolution{Width: 4, Height: 4},
+		Frames:     2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for err == nil {
+		_, err = stream.Recv()
+	}
+	if err != io.EOF {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		`randomart_rpc_requests_total{method="GenerateArt"} 2`,
+		`randomart_rpc_requests_total{method="RenderFrames"} 1`,
+		`randomart_rpc_request_errors_total{method="GenerateArt"} 1`,
+		`randomart_rpc_requests_in_flight{method="RenderFrames"} 0`,
+		`randomart_rpc_request_duration_seconds_count{method="GenerateArt"} 2`,
+		`randomart_rpc_request_duration_seconds_count{method="RenderFrames"} 1`,
+	} {
+		if !strings.Contains(rec.Body.String(), want+"\n") {
+			t.Errorf("got metrics:\n%s\nwant %s", rec.Body, want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"os"
+	"randomart/nodes"
+	"randomart/render"
+	"slices"
+	"time"
+)
+
+// watchInterval is how often -watch checks whether the grammar file has
+// changed.
+const watchInterval = 500 * time.Millisecond
+
+// runSweep renders the expressions generated from the same seed with -steps
+// weights between -from and -to of an alternative of -rule, tiled into a grid
+// written to -output. With -watch the sweep is rendered again whenever the
+// grammar file changes, until interrupted.
+func runSweep(ctx context.Context) error {
+	if *sweepRule == "" {
+		return fmt.Errorf("-rule must be given to sweep the weights of")
+	}
+	if *sweepSteps < 1 {
+		return fmt.Errorf("steps must be at least 1")
+	}
+	for _, w := range []float64{*sweepFrom, *sweepTo} {
+		if w < 0 || w > 1 {
+			return fmt.Errorf("weight %g is not between 0 and 1", w)
+		}
+	}
+	if *watch && *grammarFilename == "-" {
+		return fmt.Errorf("cannot watch a grammar read from stdin")
+	}
+	var (
+		format render.Format
+		err    error
+	)
+	if *outputFormat != "" {
+		format, err = render.ParseFormat(*outputFormat)
+	} else {
+		format, err = render.FormatFromFilename(*outputFilename)
+	}
+	if err != nil {
+		return fmt.Errorf("could not determine output format: %w", err)
+	}
+	optionsFile, err := readOptionsFile()
+	if err != nil {
+		return err
+	}
+	genOpts, err := generatorOptions(optionsFile)
+	if err != nil {
+		return err
+	}
+	// Fix the seed so every step generates from the same one, unless it is
+	// given by -ioptions or -seed-string.
+	genOpts = append([]nodes.GeneratorOption{nodes.WithSeeds(uint64(time.Now().Unix()))}, genOpts...)
+
+	var modified time.Time
+	if *watch {
+		info, err := os.Stat(*grammarFilename)
+		if err != nil {
+			return fmt.Errorf("could not watch grammar file: %w", err)
+		}
+		modified = info.ModTime()
+	}
+	for {
+		err := sweep(ctx, genOpts, format)
+		if !*watch {
+			return err
+		}
+		if err != nil {
+			fmt.Println(err)
+		}
+		fmt.Printf("watching %s for changes...\n", *grammarFilename)
+		if modified, err = waitForChange(ctx, *grammarFilename, modified); err != nil {
+			return nil
+		}
+	}
+}
+
+// sweep loads the grammar and renders the sweep of it.
+func sweep(ctx context.Context, genOpts []nodes.GeneratorOption, format render.Format) error {
+	grammar, err := loadGrammar(*grammarFilename)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(grammar.Productions, func(p *nodes.Production) bool {
+		return p.Name == *sweepRule
+	})
+	if i < 0 {
+		return fmt.Errorf("%w: %s", nodes.ErrRuleDoesNotExist, *sweepRule)
+	}
+	prod := grammar.Productions[i]
+	if len(prod.Alternatives) < 2 {
+		return fmt.Errorf("production %s only has one alternative", prod.Name)
+	}
+	if *sweepAlternative < 0 || *sweepAlternative >= len(prod.Alternatives) {
+		return fmt.Errorf("production %s has no alternative %d, it has %d", prod.Name, *sweepAlternative, len(prod.Alternatives))
+	}
+	// Generating sorts the alternatives by weight, so they are held on to
+	// before the first generation.
+	swept := prod.Alternatives[*sweepAlternative]
+	others := slices.Delete(slices.Clone(prod.Alternatives), *sweepAlternative, *sweepAlternative+1)
+	weights := make([]float64, len(others))
+	for i, a := range others {
+		weights[i] = a.Probability
+	}
+
+	renOpts := []render.RenderOption{
+		render.WithResolution(*width, *height),
+		render.WithSamples(*samples),
+		render.WithJitter(*jitter),
+	}
+	renOpts = append(renOpts, paramOptions()...)
+	if *fastMath {
+		renOpts = append(renOpts, render.WithFastMath())
+	}
+
+	imgs := make([]image.Image, 0, *sweepSteps)
+	for step := range *sweepSteps {
+		w := *sweepFrom
+		if *sweepSteps > 1 {
+			w += (*sweepTo - *sweepFrom) * float64(step) / float64(*sweepSteps-1)
+		}
+		setWeight(swept, w, others, weights)
+		node, _, err := generate(ctx, grammar, genOpts)
+		if err != nil {
+			return fmt.Errorf("could not generate with %s weighted %.3g: %w", swept.Alternate, w, err)
+		}
+		fmt.Printf("%s %%%.3g: %s\n", swept.Alternate, w, node)
+		img, err := render.Render(ctx, node, renOpts...)
+		if err != nil {
+			return fmt.Errorf("could not render with %s weighted %.3g: %w", swept.Alternate, w, err)
+		}
+		imgs = append(imgs, img)
+	}
+
+	cols := *grid
+	if cols == 0 {
+		cols = *sweepSteps
+	}
+	if err = writeImage(*outputFilename, render.Grid(imgs, cols), format, render.WithQuality(*quality)); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %d weights to %s\n", len(imgs), *outputFilename)
+	return nil
+}
+
+// setWeight weights the alternative w and the others by what remains, in
+// proportion to their weights in the grammar or evenly if those are all 0.
+func setWeight(alt *nodes.AlternateWithProb, w float64, others []*nodes.AlternateWithProb, weights []float64) {
+	var total float64
+	for _, weight := range weights {
+		total += weight
+	}
+	// Weights are scaled down a hair so that rounding can't take their sum
+	// over 1.
+	const shrink = 1 - 1e-9
+	alt.Probability = w * shrink
+	for i, a := range others {
+		if total == 0 {
+			a.Probability = (1 - w) / float64(len(others)) * shrink
+		} else {
+			a.Probability = (1 - w) * weights[i] / total * shrink
+		}
+	}
+}
+
+// waitForChange returns the modification time of the file once it is no
+// longer the one given, or the context's error if it is done first.
+func waitForChange(ctx context.Context, filename string, since time.Time) (time.Time, error) {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return since, ctx.Err()
+		case <-ticker.C:
+		}
+		// Editors may replace the file when saving it, so it may briefly
+		// not exist.
+		info, err := os.Stat(filename)
+		if err == nil && !info.ModTime().Equal(since) {
+			return info.ModTime(), nil
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// videoSource decodes the frames of a video by piping raw RGBA frames out of
+// ffmpeg. Frames are decoded in order and held until they have been requested
+// so that frames rendered out of order by the renderer's workers can still be
+// served.
+type videoSource struct {
+	cmd     *exec.Cmd
+	r       io.Reader
+	width   int
+	height  int
+	frames  int
+	mu      sync.Mutex
+	next    int
+	decoded map[int]*image.RGBA
+}
+
+func probeVideo(ctx context.Context, filename string) (width, height, frames int, err error) {
+	out, err := exec.CommandContext(
+		ctx, "ffprobe",
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-count_packets",
+		"-show_entries", "stream=width,height,nb_read_packets",
+		"-of", "csv=p=0",
+		filename,
+	).Output()
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("could not probe video %q: %w", filename, err)
+	}
+
+	fields := strings.Split(strings.TrimSpace(string(out)), ",")
+	if len(fields) != 3 {
+		return 0, 0, 0, fmt.Errorf("unexpected ffprobe output for video %q: %q", filename, out)
+	}
+	values := make([]int, len(fields))
+	for i, field := range fields {
+		if values[i], err = strconv.Atoi(field); err != nil {
+			return 0, 0, 0, fmt.Errorf("unexpected ffprobe output for video %q: %w", filename, err)
+		}
+	}
+	return values[0], values[1], values[2], nil
+}
+
+func openVideo(ctx context.Context, filename string) (*videoSource, error) {
+	width, height, frames, err := probeVideo(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(
+		ctx, "ffmpeg",
+		"-v", "error",
+		"-i", filename,
+		"-f", "rawvideo",
+		"-pix_fmt", "rgba",
+		"-",
+	)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not start ffmpeg: %w", err)
+	}
+	return &videoSource{
+		cmd:     cmd,
+		r:       bufio.NewReaderSize(stdout, width*height*4),
+		width:   width,
+		height:  height,
+		frames:  frames,
+		decoded: make(map[int]*image.RGBA),
+	}, nil
+}
+
+func (v *videoSource) frame(no int) (image.Image, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for v.next <= no {
+		img := image.NewRGBA(image.Rect(0, 0, v.width, v.height))
+		if _, err := io.ReadFull(v.r, img.Pix); err != nil {
+			return nil, fmt.Errorf("could not decode video frame %d: %w", v.next, err)
+		}
+		v.decoded[v.next] = img
+		v.next++
+	}
+
+	img, ok := v.decoded[no]
+	if !ok {
+		return nil, fmt.Errorf("video frame %d has already been read", no)
+	}
+	delete(v.decoded, no)
+	return img, nil
+}
+
+func (v *videoSource) Close() error {
+	_ = v.cmd.Process.Kill()
+	_ = v.cmd.Wait()
+	return nil
+}